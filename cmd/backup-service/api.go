@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+)
+
+// webFS holds the dashboard served on / by the API server.
+//
+//go:embed web
+var webFS embed.FS
+
+// apiLogLines is the number of log lines a client streaming the logs receives on connecting.
+const apiLogLines = 500
+
+// apiServer answers the HTTP API of the daemon with the same functions as the commands, and serves
+// the dashboard using it.
+type apiServer struct {
+	cfg     *config.Config
+	nextRun func() time.Time
+	logs    *logging.Broadcast
+	// ctx bounds the backups started through the API, which outlive their requests.
+	ctx  context.Context
+	runs sync.WaitGroup
+}
+
+func newAPIServer(ctx context.Context, cfg *config.Config, nextRun func() time.Time, logs *logging.Broadcast) *apiServer {
+	return &apiServer{cfg: cfg, nextRun: nextRun, logs: logs, ctx: ctx}
+}
+
+// handler routes the API, which requires the token, and the dashboard, which does not: it asks
+// for the token and keeps it in the browser.
+func (s *apiServer) handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/status", s.status)
+	api.HandleFunc("GET /api/sets", s.sets)
+	api.HandleFunc("GET /api/sets/{set}/backups", s.backups)
+	api.HandleFunc("POST /api/sets/{set}/verify", s.verify)
+	api.HandleFunc("POST /api/backups", s.startBackup)
+	api.HandleFunc("GET /api/history", s.history)
+	api.HandleFunc("GET /api/logs", s.streamLogs)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(api))
+	ui, _ := fs.Sub(webFS, "web")
+	mux.Handle("/", http.FileServerFS(ui))
+	return mux
+}
+
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.API.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="backup-service"`)
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAPIJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeAPIJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// apiStatus is the answer of GET /api/status.
+type apiStatus struct {
+	Schedule string    `json:"schedule"`
+	NextRun  time.Time `json:"next_run,omitzero"`
+	serviceStatus
+}
+
+func (s *apiServer) status(w http.ResponseWriter, _ *http.Request) {
+	st, err := collectStatus(s.cfg, defaultMaxAge, time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, apiStatus{Schedule: s.cfg.Schedule, NextRun: s.nextRun(), serviceStatus: *st})
+}
+
+// apiSet describes a configured backup set.
+type apiSet struct {
+	Name         string        `json:"name"`
+	Type         string        `json:"type"`
+	Destinations []string      `json:"destinations"`
+	MaxAge       time.Duration `json:"max_age,omitempty"`
+}
+
+func (s *apiServer) sets(w http.ResponseWriter, _ *http.Request) {
+	sets := make([]apiSet, len(s.cfg.Backups))
+	for i := range s.cfg.Backups {
+		b := &s.cfg.Backups[i]
+		sets[i] = apiSet{Name: b.Name, Type: b.Type, Destinations: s.cfg.SetDestinations(b), MaxAge: b.MaxAge}
+	}
+	writeAPIJSON(w, http.StatusOK, sets)
+}
+
+// backups lists the restore points of a set, oldest first, like the list command.
+func (s *apiServer) backups(w http.ResponseWriter, r *http.Request) {
+	set := r.PathValue("set")
+	if _, ok := s.cfg.BackupSet(set); !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown backup set %q", set))
+		return
+	}
+	dest := r.URL.Query().Get("destination")
+	if _, ok := s.cfg.Destination(dest); dest != "" && !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown destination %q", dest))
+		return
+	}
+	backups, err := listBackups(r.Context(), s.cfg, dest, set)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]any{"set": set, "backups": backups})
+}
+
+// verify checks a backup of a set like the verify command, answering once it is done.
+func (s *apiServer) verify(w http.ResponseWriter, r *http.Request) {
+	set := r.PathValue("set")
+	if _, ok := s.cfg.BackupSet(set); !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown backup set %q", set))
+		return
+	}
+	q := r.URL.Query()
+	ctx, _ := logging.With(r.Context(), "run_id", logging.NewRunID())
+	res, err := verifySet(ctx, s.cfg, q.Get("destination"), set, q.Get("key"))
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, res)
+}
+
+// backupRequest is the optional body of POST /api/backups.
+type backupRequest struct {
+	Sets []string `json:"sets"` // Empty for all sets
+	Full bool     `json:"full"`
+}
+
+// startBackup starts a run in the background, like the backup command. Its outcome shows in the
+// logs, the history and the notifications.
+func (s *apiServer) startBackup(w http.ResponseWriter, r *http.Request) {
+	var req backupRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	for _, name := range req.Sets {
+		if _, ok := s.cfg.BackupSet(name); !ok {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("unknown backup set %q", name))
+			return
+		}
+	}
+	running, err := runningBackup(s.cfg)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if running != "" {
+		writeAPIError(w, http.StatusConflict, fmt.Errorf("a backup is already running: %s", running))
+		return
+	}
+
+	s.runs.Go(func() {
+		slog.Info("Starting backup requested over the API", "sets", strings.Join(req.Sets, ","), "full", req.Full)
+		if _, err := executeBackup(s.ctx, s.cfg, req.Full, req.Sets); err != nil {
+			slog.Error("Backup requested over the API failed", "error", err)
+		}
+	})
+	writeAPIJSON(w, http.StatusAccepted, map[string]any{"started": true, "sets": req.Sets, "full": req.Full})
+}
+
+func (s *apiServer) history(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 20
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+			return
+		}
+		limit = n
+	}
+	db, err := openHistory(s.cfg)
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	runs, err := db.Runs(limit, q.Get("set"))
+	_ = db.Close()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, newAPIRuns(runs))
+}
+
+// apiRun is a run report in GET /api/history, with the statuses the history command shows, so
+// that the dashboard does not work them out itself.
+type apiRun struct {
+	*report.Report
+	Status string      `json:"status"`
+	Sets   []apiRunSet `json:"sets"`
+}
+
+type apiRunSet struct {
+	report.Set
+	Status string `json:"status"`
+}
+
+func newAPIRuns(runs []*report.Report) []apiRun {
+	out := make([]apiRun, len(runs))
+	for i, r := range runs {
+		out[i] = apiRun{Report: r, Status: r.Status(), Sets: make([]apiRunSet, len(r.Sets))}
+		for j, s := range r.Sets {
+			out[i].Sets[j] = apiRunSet{Set: s, Status: s.Status()}
+		}
+	}
+	return out
+}
+
+// streamLogs sends the recent log records, then each new one as it is logged, as server-sent
+// events whose data is the record in JSON.
+func (s *apiServer) streamLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	backlog, lines, cancel := s.logs.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	for _, line := range backlog {
+		fmt.Fprintf(w, "data: %s\n\n", line)
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case line := <-lines:
+			fmt.Fprintf(w, "data: %s\n\n", line)
+			flusher.Flush()
+		}
+	}
+}
+
+// serve serves the API on cfg.API.Listen until ctx is done, then waits for the backups it
+// started.
+func (s *apiServer) serve(ctx context.Context) error {
+	defer s.runs.Wait()
+	srv := &http.Server{Addr: s.cfg.API.Listen, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	slog.Info("Serving the API and dashboard", "address", s.cfg.API.Listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+)
+
+func TestAPI(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Schedule = "0 3 * * *"
+	cfg.API = config.APIConfig{Listen: "127.0.0.1:0", Token: "secret"}
+
+	next := time.Date(2030, 1, 2, 3, 0, 0, 0, time.UTC)
+	logs := logging.NewBroadcast(10)
+	api := newAPIServer(context.Background(), cfg, func() time.Time { return next }, logs)
+	srv := httptest.NewServer(api.handler())
+	defer srv.Close()
+
+	call := func(method, path, token string, body io.Reader, v any) int {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if code := call("GET", "/api/sets", token, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 with token %q, got %d", token, code)
+		}
+	}
+
+	var sets []apiSet
+	if code := call("GET", "/api/sets", "secret", nil, &sets); code != http.StatusOK ||
+		len(sets) != 1 || sets[0].Name != "docs" || len(sets[0].Destinations) != 1 {
+		t.Errorf("unexpected sets %d %+v", code, sets)
+	}
+	if code := call("POST", "/api/backups", "secret", strings.NewReader(`{"sets":["nope"]}`), nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown set, got %d", code)
+	}
+
+	if code := call("POST", "/api/backups", "secret", strings.NewReader(`{"sets":["docs"]}`), nil); code != http.StatusAccepted {
+		t.Fatalf("expected the backup to start, got %d", code)
+	}
+	api.runs.Wait()
+
+	var runs []apiRun
+	if code := call("GET", "/api/history?limit=5&set=docs", "secret", nil, &runs); code != http.StatusOK ||
+		len(runs) != 1 || runs[0].Status != report.StatusSuccess || len(runs[0].Sets) != 1 || runs[0].Sets[0].Status != report.StatusSuccess {
+		t.Fatalf("unexpected history %d %+v", code, runs)
+	}
+	if code := call("GET", "/api/history?limit=x", "secret", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid limit, got %d", code)
+	}
+
+	var st apiStatus
+	if code := call("GET", "/api/status", "secret", nil, &st); code != http.StatusOK ||
+		st.Schedule != cfg.Schedule || !st.NextRun.Equal(next) || len(st.Sets) != 1 || st.Sets[0].Health != healthOK || st.Sets[0].Status != report.StatusSuccess {
+		t.Errorf("unexpected status %d %+v", code, st)
+	}
+
+	var backups struct {
+		Set     string   `json:"set"`
+		Backups []string `json:"backups"`
+	}
+	if code := call("GET", "/api/sets/docs/backups", "secret", nil, &backups); code != http.StatusOK || len(backups.Backups) != 1 {
+		t.Fatalf("unexpected backups %d %+v", code, backups)
+	}
+	if code := call("GET", "/api/sets/nope/backups", "secret", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown set, got %d", code)
+	}
+
+	var res verifyResult
+	if code := call("POST", "/api/sets/docs/verify", "secret", nil, &res); code != http.StatusOK ||
+		res.Key != backups.Backups[0] || res.Files == 0 {
+		t.Errorf("unexpected verification %d %+v", code, res)
+	}
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "/api/status") {
+		t.Errorf("expected the dashboard, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPILogs(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Token: "secret"}}
+	logs := logging.NewBroadcast(10)
+	_, _ = logs.Write([]byte(`{"msg":"before"}` + "\n"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := httptest.NewServer(newAPIServer(ctx, cfg, time.Now, logs).handler())
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/logs", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	events := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		for events.Scan() {
+			if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+				return data
+			}
+		}
+		t.Fatalf("stream ended: %v", events.Err())
+		return ""
+	}
+	if got := next(); got != `{"msg":"before"}` {
+		t.Errorf("expected the backlog first, got %q", got)
+	}
+	_, _ = logs.Write([]byte(`{"msg":"after"}` + "\n"))
+	if got := next(); got != `{"msg":"after"}` {
+		t.Errorf("expected the new line, got %q", got)
+	}
+}
+
+func TestNewAPIRunsStatus(t *testing.T) {
+	runs := newAPIRuns([]*report.Report{{Sets: []report.Set{
+		{Name: "logs", Warnings: []string{"/var/log/app.log: file changed as we read it"}},
+		{Name: "docs"},
+	}}})
+	data, err := json.Marshal(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []struct {
+		Status string `json:"status"`
+		Sets   []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"sets"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Status != report.StatusWarning || len(got[0].Sets) != 2 ||
+		got[0].Sets[0].Status != report.StatusWarning || got[0].Sets[1].Status != report.StatusSuccess {
+		t.Errorf("unexpected statuses in %s", data)
+	}
+	if data, _ := json.Marshal(newAPIRuns(nil)); string(data) != "[]" {
+		t.Errorf("expected an empty history to be [], got %s", data)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/hooks"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/mikhail-angelov/backup-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// forEachSet calls fn for every backup set, highest priority first, running up to cfg.Workers sets at a time.
+func forEachSet(cfg *config.Config, fn func(b *config.BackupSet)) {
+	sets := make([]*config.BackupSet, len(cfg.Backups))
+	for i := range cfg.Backups {
+		sets[i] = &cfg.Backups[i]
+	}
+	sort.SliceStable(sets, func(i, j int) bool { return sets[i].Priority > sets[j].Priority })
+
+	queue := make(chan *config.BackupSet)
+	var wg sync.WaitGroup
+	for range max(cfg.Workers, 1) {
+		wg.Go(func() {
+			for b := range queue {
+				fn(b)
+			}
+		})
+	}
+	for _, b := range sets {
+		queue <- b
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// setResult is the outcome of backing up one set.
+type setResult struct {
+	// Report describes the set for notifications; its Errors mirror Errors.
+	Report report.Set
+	Errors []error
+}
+
+// backupSet runs the hooks of one backup set around archiving and uploading it. Its progress is logged
+// with the set name as attribute, so that the output of sets running in parallel can be told apart.
+func backupSet(ctx context.Context, cfg *config.Config, engine *backup.Engine, stores map[string]storage.Backend, existingBackups map[string][]string, b *config.BackupSet, forceFull bool) (res setResult) {
+	ctx, logger := logging.With(ctx, "set", b.Name)
+	ctx, span := tracing.Start(ctx, "backup.set", attribute.String("set", b.Name), attribute.String("set.type", b.Type))
+	defer func() {
+		span.SetAttributes(
+			attribute.String("backup_type", res.Report.BackupType),
+			attribute.Int64("bytes", res.Report.Size),
+			attribute.String("status", res.Report.Status()),
+		)
+		if res.Report.Stage != "" {
+			span.SetAttributes(attribute.String("stage", res.Report.Stage))
+		}
+		tracing.End(span, errors.Join(res.Errors...))
+	}()
+	if b.Heartbeat.URL != "" {
+		var finish func(rep *report.Set)
+		ctx, finish = startHeartbeat(ctx, b)
+		logger = logging.FromContext(ctx)
+		// Registered first so that it runs last, once the report is complete.
+		defer func() { finish(&res.Report) }()
+	}
+	start := time.Now()
+	res.Report = report.Set{Name: b.Name, Type: b.Type}
+	defer func() {
+		res.Report.Duration = time.Since(start)
+		for _, err := range res.Errors {
+			res.Report.Errors = append(res.Report.Errors, err.Error())
+		}
+	}()
+	targets := availableDestinations(cfg.SetDestinations(b), stores)
+	if len(targets) == 0 {
+		res.Errors = []error{fmt.Errorf("backup %s skipped: no destination available", b.Name)}
+		res.Report.Stage = "destination"
+		return res
+	}
+
+	// Database dumps are always complete.
+	isFull := forceFull || b.IsDatabase()
+	if !isFull {
+		currentMonth := time.Now().Format("200601")
+		if !hasFullBackup(existingBackups[targets[0]], b.Name, currentMonth) {
+			logger.Info("No full backup found this month, forcing full backup", "month", currentMonth)
+			isFull = true
+		}
+	}
+
+	runner := &hooks.Runner{Timeout: b.Hooks.Timeout, Logger: logger}
+	env := map[string]string{
+		"BACKUP_SET":          b.Name,
+		"BACKUP_TYPE":         map[bool]string{true: "full", false: "inc"}[isFull],
+		"BACKUP_DESTINATIONS": strings.Join(targets, ","),
+	}
+	// Hooks that undo a pre_backup step must run even when the run is being cancelled.
+	cleanupCtx := context.WithoutCancel(ctx)
+
+	var errs []error
+	if err := runner.Run(ctx, "pre_backup", b.Hooks.PreBackup, env); err != nil {
+		errs = append(errs, fmt.Errorf("backup %s aborted: %w", b.Name, err))
+		res.Report.Stage = "hook"
+	} else {
+		errs = archiveAndUpload(ctx, cfg, engine, stores, b, targets, isFull, logger, &res.Report)
+		env["BACKUP_ARCHIVE"] = res.Report.Archive
+		switch res.Report.BackupType {
+		case "full":
+			res.Report.Chain = 1
+		case "inc":
+			res.Report.Chain = chainLength(existingBackups[targets[0]], b.Name) + 1
+		}
+		setStatus(env, errs)
+		if err := runner.Run(cleanupCtx, "post_backup", b.Hooks.PostBackup, env); err != nil {
+			errs = append(errs, fmt.Errorf("backup %s: %w", b.Name, err))
+			if res.Report.Stage == "" {
+				res.Report.Stage = "hook"
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		setStatus(env, errs)
+		if err := runner.Run(cleanupCtx, "on_failure", b.Hooks.OnFailure, env); err != nil {
+			errs = append(errs, fmt.Errorf("backup %s: %w", b.Name, err))
+		}
+	}
+	res.Errors = errs
+	return res
+}
+
+// hasFullBackup reports whether keys contain a full backup of a set taken in the given month,
+// formatted as YYYYMM.
+func hasFullBackup(keys []string, set, month string) bool {
+	for _, key := range keys {
+		name, timestamp, backupType := backup.ParseArchiveName(key)
+		if name == set && backupType == "full" && strings.HasPrefix(timestamp, month) {
+			return true
+		}
+	}
+	return false
+}
+
+// chainLength returns the number of archives in the latest chain of a set among keys: its latest
+// full backup and the incrementals that followed it.
+func chainLength(keys []string, set string) int {
+	keys = slices.Clone(keys)
+	sortByTimestamp(keys)
+	n := 0
+	for _, key := range keys {
+		name, _, backupType := backup.ParseArchiveName(key)
+		switch {
+		case name != set:
+		case backupType == "full":
+			n = 1
+		case backupType == "inc" && n > 0:
+			n++
+		}
+	}
+	return n
+}
+
+// fileSize returns the size of a file, or 0 when it cannot be read.
+func fileSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// setStatus describes the outcome of an operation to hooks.
+func setStatus(env map[string]string, errs []error) {
+	env["BACKUP_STATUS"] = "success"
+	delete(env, "BACKUP_ERROR")
+	if len(errs) > 0 {
+		env["BACKUP_STATUS"] = "failure"
+		env["BACKUP_ERROR"] = errors.Join(errs...).Error()
+	}
+}
+
+// archiveAndUpload creates, encrypts and uploads the archive of a backup set, recording the archive,
+// its size and file count, the uploads and the tar warnings the set's policy asks to report in rep.
+func archiveAndUpload(ctx context.Context, cfg *config.Config, engine *backup.Engine, stores map[string]storage.Backend, b *config.BackupSet, targets []string, isFull bool, logger *slog.Logger, rep *report.Set) []error {
+	var archive backup.ArchiveResult
+	var err error
+	archiveCtx, span := tracing.Start(ctx, "backup.archive", attribute.String("set", b.Name), attribute.String("set.type", b.Type))
+	if b.IsDatabase() {
+		logger.Info("Dumping database", "type", b.Type)
+		archive.Type = "full"
+		archive.Path, err = engine.DumpDatabase(b.Name, databaseOf(b))
+	} else {
+		logger.Info("Backing up", "backup_type", map[bool]string{true: "full", false: "inc"}[isFull])
+		snapshotFile := filepath.Join(os.TempDir(), fmt.Sprintf("%s.snar", b.Name))
+		switch {
+		case b.Type == "docker":
+			archive, err = archiveDockerSet(archiveCtx, engine, b, snapshotFile, isFull, logger)
+		case b.Snapshot.Type != "":
+			archive, err = archiveFromSnapshot(archiveCtx, engine, b, snapshotFile, isFull, logger)
+		default:
+			archive, err = engine.Archive(backup.ArchiveSpec{
+				Name:         b.Name,
+				Folders:      b.Folders,
+				Exclude:      b.Exclude,
+				SnapshotFile: snapshotFile,
+				IsFull:       isFull,
+			})
+		}
+	}
+	var warning *backup.ArchiveWarning
+	if errors.As(err, &warning) && err == error(warning) && b.TarWarnings != "fail" {
+		if b.TarWarnings == "ignore" {
+			logger.Info("Ignoring tar warnings", "warning", warning)
+		} else {
+			logger.Warn("Archive created with warnings", "warning", warning)
+			rep.Warnings = warning.Messages
+		}
+		err = nil
+	}
+	span.SetAttributes(
+		attribute.String("backup_type", archive.Type),
+		attribute.Int("files", archive.Files),
+		attribute.Int64("bytes", fileSize(archive.Path)),
+	)
+	tracing.End(span, err)
+	if err != nil {
+		if archive.Path != "" {
+			_ = os.Remove(archive.Path)
+		}
+		rep.Stage = "archive"
+		return []error{fmt.Errorf("backup %s failed: %w", b.Name, err)}
+	}
+	rep.BackupType, rep.Files = archive.Type, archive.Files
+
+	uploadPath := archive.Path
+	if cfg.Encryption.Enabled {
+		logger.Info("Encrypting archive", "path", archive.Path)
+		_, span := tracing.Start(ctx, "backup.encrypt", attribute.String("set", b.Name), attribute.Int64("bytes", fileSize(archive.Path)))
+		encryptedPath, err := engine.Encrypt(archive.Path, cfg.Encryption.Passphrase)
+		span.SetAttributes(attribute.Int64("encrypted_bytes", fileSize(encryptedPath)))
+		tracing.End(span, err)
+		_ = os.Remove(archive.Path)
+		if err != nil {
+			rep.Stage = "encrypt"
+			return []error{fmt.Errorf("encryption of %s failed: %w", b.Name, err)}
+		}
+		uploadPath = encryptedPath
+	}
+	rep.Archive = filepath.Base(uploadPath)
+	rep.Size = fileSize(uploadPath)
+
+	logger.Info("Uploading archive", "path", uploadPath, "destinations", strings.Join(targets, ","))
+	var errs []error
+	uploaded := 0
+	var failed []string
+	for _, res := range uploadToDestinations(ctx, cfg, stores, targets, uploadPath) {
+		upload := report.Upload{Destination: res.name, Bytes: rep.Size, Duration: res.duration}
+		rep.Uploads = append(rep.Uploads, upload)
+		if res.err != nil {
+			rep.Uploads[len(rep.Uploads)-1].Error = res.err.Error()
+			errs = append(errs, fmt.Errorf("upload %s to %s failed: %w", b.Name, res.name, res.err))
+			failed = append(failed, res.name)
+			continue
+		}
+		uploaded++
+	}
+	if len(failed) > 0 {
+		rep.Stage = "upload"
+		if err := spoolUpload(ctx, cfg, uploadPath, failed); err != nil {
+			errs = append(errs, fmt.Errorf("failed to keep %s for a later upload: %w", b.Name, err))
+		}
+	}
+	_ = os.Remove(uploadPath)
+	if uploaded > 0 {
+		logger.Info("Backup completed", "backup_type", archive.Type, "stored", uploaded, "destinations", len(targets))
+	}
+	return errs
+}
+
+// databaseOf describes the database of a postgres or mysql backup set to the backup engine.
+func databaseOf(b *config.BackupSet) *backup.Database {
+	return &backup.Database{
+		Kind:           b.Type,
+		Host:           b.Database.Host,
+		Port:           b.Database.Port,
+		User:           b.Database.User,
+		Password:       b.Database.Password,
+		Name:           b.Database.Name,
+		All:            b.Database.All,
+		Options:        b.Database.Options,
+		DumpCommand:    b.Database.DumpCommand,
+		RestoreCommand: b.Database.RestoreCommand,
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/localfs"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+func hookTestSetup(t *testing.T) (*config.Config, map[string]storage.Backend, string) {
+	t.Helper()
+	store, err := localfs.NewClient(localfs.Options{Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StateDir:     t.TempDir(),
+		Destinations: []config.Destination{{Name: "local", Type: "local"}},
+	}
+	cfg.Retry.Attempts = 1
+	return cfg, map[string]storage.Backend{"local": store}, t.TempDir()
+}
+
+func readHookLog(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBackupSetHooks(t *testing.T) {
+	cfg, stores, dir := hookTestSetup(t)
+	hookLog := filepath.Join(dir, "hooks.log")
+	record := `echo "$BACKUP_HOOK $BACKUP_SET $BACKUP_TYPE $BACKUP_STATUS $BACKUP_ARCHIVE" >> ` + hookLog
+
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	set := &config.BackupSet{
+		Name:    "app",
+		Folders: []string{src},
+		Hooks: config.Hooks{
+			PreBackup:  []string{record},
+			PostBackup: []string{record},
+			OnFailure:  []string{record},
+		},
+	}
+
+	errs := backupSet(context.Background(), cfg, backup.NewEngine(t.TempDir()), stores, nil, set, true).Errors
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	lines := strings.Split(strings.TrimSpace(readHookLog(t, hookLog)), "\n")
+	if len(lines) != 2 || strings.TrimSpace(lines[0]) != "pre_backup app full" || !strings.HasPrefix(lines[1], "post_backup app full success app_") {
+		t.Errorf("unexpected hook calls: %q", lines)
+	}
+}
+
+func TestBackupSetPreHookAborts(t *testing.T) {
+	cfg, stores, dir := hookTestSetup(t)
+	hookLog := filepath.Join(dir, "hooks.log")
+	record := `echo "$BACKUP_HOOK $BACKUP_STATUS" >> ` + hookLog
+
+	set := &config.BackupSet{
+		Name:    "app",
+		Folders: []string{"/nonexistent"},
+		Hooks: config.Hooks{
+			PreBackup:  []string{"exit 1"},
+			PostBackup: []string{record},
+			OnFailure:  []string{record},
+		},
+	}
+
+	errs := backupSet(context.Background(), cfg, backup.NewEngine(t.TempDir()), stores, nil, set, true).Errors
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "aborted") {
+		t.Fatalf("expected the backup to be aborted, got %v", errs)
+	}
+	if got := strings.TrimSpace(readHookLog(t, hookLog)); got != "on_failure failure" {
+		t.Errorf("expected only on_failure to run, got %q", got)
+	}
+	keys, _ := stores["local"].List(context.Background())
+	if len(keys) != 0 {
+		t.Errorf("expected no archive to be uploaded, got %v", keys)
+	}
+}
+
+func TestBackupSetTarWarnings(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho data\necho 'tar: /var/log/app.log: file changed as we read it' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "tar"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	for _, policy := range []string{"warn", "ignore", "fail"} {
+		cfg, stores, _ := hookTestSetup(t)
+		set := &config.BackupSet{Name: "logs", Folders: []string{"/var/log"}, TarWarnings: policy}
+		res := backupSet(context.Background(), cfg, backup.NewEngine(t.TempDir()), stores, nil, set, true)
+		keys, _ := stores["local"].List(context.Background())
+
+		switch policy {
+		case "warn":
+			if len(res.Errors) > 0 || len(keys) != 1 || len(res.Report.Warnings) != 1 || res.Report.Warnings[0] != "/var/log/app.log: file changed as we read it" {
+				t.Errorf("warn: expected an uploaded archive with one warning, got %+v, %v", res, keys)
+			}
+		case "ignore":
+			if len(res.Errors) > 0 || len(keys) != 1 || len(res.Report.Warnings) != 0 {
+				t.Errorf("ignore: expected an uploaded archive without warnings, got %+v, %v", res, keys)
+			}
+		case "fail":
+			if len(res.Errors) != 1 || len(keys) != 0 {
+				t.Errorf("fail: expected an error and no archive, got %+v, %v", res, keys)
+			}
+		}
+	}
+}
+
+func TestBackupSetIncrementalWithoutPrefix(t *testing.T) {
+	cfg, stores, dir := hookTestSetup(t)
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine := backup.NewEngine(t.TempDir())
+	set := &config.BackupSet{Name: "docs", Folders: []string{dir}}
+
+	ctx := context.Background()
+	if res := backupSet(ctx, cfg, engine, stores, nil, set, false); len(res.Errors) > 0 || res.Report.BackupType != "full" {
+		t.Fatalf("expected a full first backup, got %+v", res)
+	}
+	keys, err := stores["local"].List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := backupSet(ctx, cfg, engine, stores, map[string][]string{"local": keys}, set, false)
+	if len(res.Errors) > 0 || res.Report.BackupType != "inc" || res.Report.Chain != 2 {
+		t.Errorf("expected an incremental continuing the chain of %v, got %+v", keys, res)
+	}
+}
+
+func TestHasFullBackup(t *testing.T) {
+	keys := []string{"web_app_20250103000000.inc.tar.gz", "web_app_20250101000000.full.tar.gz", "web_20241201000000.full.tar.gz"}
+	if !hasFullBackup(keys, "web_app", "202501") {
+		t.Error("expected the full backup of web_app to be found")
+	}
+	if hasFullBackup(keys, "web", "202501") || hasFullBackup(keys, "app", "202501") {
+		t.Error("expected no full backup of web or app this month")
+	}
+}
+
+func TestChainLength(t *testing.T) {
+	keys := []string{
+		"h/web_20250103000000.inc.tar.gz", "h/web_20250101000000.full.tar.gz", "h/web_20250102000000.inc.tar.gz",
+		"h/db_20250104000000.full.sql.gz", "h/web_20241201000000.full.tar.gz",
+	}
+	if n := chainLength(keys, "web"); n != 3 {
+		t.Errorf("expected a chain of 3, got %d", n)
+	}
+	if n := chainLength(keys, "db"); n != 1 {
+		t.Errorf("expected a chain of 1, got %d", n)
+	}
+	if n := chainLength(nil, "web"); n != 0 {
+		t.Errorf("expected no chain, got %d", n)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/mikhail-angelov/backup-service/internal/telegram"
+)
+
+// botListLimit is the number of archives /list shows, newest last.
+const botListLimit = 20
+
+const botHelp = `/status – schedule, running backup and last run
+/list &lt;set&gt; – archives of a set
+/backup [set] – back up one set, or all of them
+/verify &lt;set&gt; – check that the latest backup of a set decrypts and unpacks
+/last – report of the last run`
+
+// botCommands answers the Telegram bot with the same functions the CLI commands use.
+type botCommands struct {
+	cfg *config.Config
+	// nextRun returns when the next scheduled backup starts.
+	nextRun func() time.Time
+}
+
+// newBot creates the Telegram bot of daemon mode.
+func newBot(cfg *config.Config, nextRun func() time.Time) *telegram.Bot {
+	c := &botCommands{cfg: cfg, nextRun: nextRun}
+	help := func(context.Context, *telegram.Request) string { return botHelp }
+	return &telegram.Bot{
+		Client:       telegram.NewClient(cfg.TelegramBot.BotToken, ""),
+		AllowedChats: cfg.TelegramBot.AllowedChats,
+		PollTimeout:  cfg.TelegramBot.PollTimeout,
+		Handlers: map[string]telegram.Handler{
+			"start":  help,
+			"help":   help,
+			"status": c.status,
+			"list":   c.list,
+			"backup": c.backup,
+			"verify": c.verify,
+			"last":   c.last,
+		},
+		Unknown: func(_ context.Context, req *telegram.Request) string {
+			return fmt.Sprintf("Unknown command /%s\n\n%s", esc(req.Command), botHelp)
+		},
+	}
+}
+
+func esc(s string) string {
+	return report.Escape(report.FormatHTML, s)
+}
+
+// reportText renders a run report the way Telegram notifications show it.
+func reportText(rep *report.Report) string {
+	return reportMessage(config.NotificationChannel{Name: "bot", Type: "telegram"}, rep).Text()
+}
+
+func (c *botCommands) status(_ context.Context, _ *telegram.Request) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", report.Bold(report.FormatHTML, "Backup service"))
+	fmt.Fprintf(&b, "Schedule: <code>%s</code>", esc(c.cfg.Schedule))
+	if next := c.nextRun(); !next.IsZero() {
+		fmt.Fprintf(&b, ", next run %s", esc(next.Format("2006-01-02 15:04")))
+	}
+
+	if running, err := runningBackup(c.cfg); err == nil && running == "" {
+		b.WriteString("\nNo backup running")
+	} else if running != "" {
+		fmt.Fprintf(&b, "\n⏳ Backup running: %s", esc(running))
+	}
+
+	fmt.Fprintf(&b, "\nSets: %d, destinations: %d", len(c.cfg.Backups), len(c.cfg.Destinations))
+	rep, err := loadLastReport(c.cfg)
+	switch {
+	case err != nil:
+		fmt.Fprintf(&b, "\nLast run: %s", esc(err.Error()))
+	case rep == nil:
+		b.WriteString("\nLast run: none yet")
+	default:
+		fmt.Fprintf(&b, "\nLast run: %s at %s, took %s", esc(rep.Subject()),
+			esc(rep.Started.Format("2006-01-02 15:04")), esc(rep.Duration().Round(time.Second).String()))
+	}
+	return b.String()
+}
+
+func (c *botCommands) list(ctx context.Context, req *telegram.Request) string {
+	if len(req.Args) != 1 {
+		return "Usage: /list &lt;set&gt;"
+	}
+	backups, err := listBackups(ctx, c.cfg, "", req.Args[0])
+	if err != nil {
+		return "❌ " + esc(err.Error())
+	}
+	if len(backups) == 0 {
+		return fmt.Sprintf("No backups of %s", esc(req.Args[0]))
+	}
+	var b strings.Builder
+	if len(backups) > botListLimit {
+		fmt.Fprintf(&b, "… %d older\n", len(backups)-botListLimit)
+		backups = backups[len(backups)-botListLimit:]
+	}
+	for _, key := range backups {
+		fmt.Fprintf(&b, "<code>%s</code>\n", esc(key))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (c *botCommands) backup(ctx context.Context, req *telegram.Request) string {
+	what := "all sets"
+	if len(req.Args) > 0 {
+		what = strings.Join(req.Args, ", ")
+	}
+	req.Reply(fmt.Sprintf("⏳ Starting backup of %s…", esc(what)))
+	rep, err := executeBackup(ctx, c.cfg, false, req.Args)
+	if rep == nil {
+		return "❌ " + esc(err.Error())
+	}
+	return reportText(rep)
+}
+
+func (c *botCommands) verify(ctx context.Context, req *telegram.Request) string {
+	if len(req.Args) != 1 {
+		return "Usage: /verify &lt;set&gt;"
+	}
+	req.Reply(fmt.Sprintf("⏳ Verifying the latest backup of %s…", esc(req.Args[0])))
+	ctx, _ = logging.With(ctx, "run_id", logging.NewRunID())
+	res, err := verifySet(ctx, c.cfg, "", req.Args[0], "")
+	if err != nil {
+		return "❌ Verification failed: " + esc(err.Error())
+	}
+	return fmt.Sprintf("✅ <code>%s</code> in %s is intact: %d archive(s), %d files",
+		esc(res.Key), esc(res.Destination), res.Archives, res.Files)
+}
+
+func (c *botCommands) last(_ context.Context, _ *telegram.Request) string {
+	rep, err := loadLastReport(c.cfg)
+	if err != nil {
+		return "❌ " + esc(err.Error())
+	}
+	if rep == nil {
+		return "No backup has run yet"
+	}
+	return reportText(rep)
+}
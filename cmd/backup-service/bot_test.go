@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/telegram/telegramtest"
+)
+
+func TestBotCommands(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Schedule = "0 3 * * *"
+	cfg.TelegramBot = config.TelegramBotConfig{Enabled: true, BotToken: "T", AllowedChats: []string{"42"}, PollTimeout: time.Second}
+
+	srv := telegramtest.NewServer(t)
+	next := time.Date(2030, 1, 2, 3, 0, 0, 0, time.Local)
+	bot := newBot(cfg, func() time.Time { return next })
+	bot.Client.BaseURL = srv.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = bot.Run(ctx) }()
+
+	srv.Send(42, "/last")
+	if sent := srv.Wait(t, 1, 5*time.Second); sent[0].Text != "No backup has run yet" {
+		t.Errorf("unexpected /last reply %q", sent[0].Text)
+	}
+
+	srv.Send(42, "/backup docs")
+	sent := srv.Wait(t, 3, 30*time.Second)
+	if !strings.Contains(sent[1].Text, "Starting backup of docs") || !strings.Contains(sent[2].Text, "Backup completed successfully") {
+		t.Fatalf("unexpected /backup replies %q, %q", sent[1].Text, sent[2].Text)
+	}
+
+	srv.Send(42, "/list docs")
+	sent = srv.Wait(t, 4, 5*time.Second)
+	if !strings.Contains(sent[3].Text, "<code>srv1/docs_") || !strings.Contains(sent[3].Text, ".full.tar.gz</code>") {
+		t.Errorf("unexpected /list reply %q", sent[3].Text)
+	}
+
+	srv.Send(42, "/verify docs")
+	sent = srv.Wait(t, 6, 30*time.Second)
+	if !strings.Contains(sent[5].Text, "is intact: 1 archive(s), 1 files") {
+		t.Errorf("unexpected /verify reply %q", sent[5].Text)
+	}
+
+	srv.Send(42, "/status")
+	sent = srv.Wait(t, 7, 5*time.Second)
+	for _, want := range []string{"next run 2030-01-02 03:00", "No backup running", "Last run: ✅ Backup completed successfully"} {
+		if !strings.Contains(sent[6].Text, want) {
+			t.Errorf("/status reply lacks %q:\n%s", want, sent[6].Text)
+		}
+	}
+
+	srv.Send(42, "/last")
+	if sent := srv.Wait(t, 8, 5*time.Second); !strings.Contains(sent[7].Text, "<b>docs</b>") {
+		t.Errorf("unexpected /last reply %q", sent[7].Text)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+)
+
+func daemonCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "daemon",
+		Short: "Run backups on the configured schedule and apply the bandwidth schedule",
+		Run: func(_ *cobra.Command, _ []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			stopTracing := setupTracing(ctx, cfg)
+			err = runDaemon(ctx, cfg)
+			stopTracing()
+			if err != nil {
+				fatal("Daemon failed", "error", err)
+			}
+		},
+	}
+}
+
+// runDaemon runs backups according to cfg.Schedule, and the API server and Telegram bot when
+// enabled, until ctx is done. A run that is still going when the next one is due causes that one
+// to be skipped.
+func runDaemon(ctx context.Context, cfg *config.Config) error {
+	scheduler := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
+	backupEntry, err := scheduler.AddFunc(cfg.Schedule, func() {
+		slog.Info("Starting scheduled backup")
+		if _, err := executeBackup(ctx, cfg, false, nil); err != nil {
+			slog.Error("Scheduled backup failed", "error", err)
+			return
+		}
+		slog.Info("Scheduled backup completed successfully")
+	})
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", cfg.Schedule, err)
+	}
+
+	for _, ch := range cfg.Notifications {
+		if ch.Digest.Schedule == "" {
+			continue
+		}
+		if _, err := scheduler.AddFunc(ch.Digest.Schedule, func() { flushDigests(ctx, cfg, time.Now()) }); err != nil {
+			return fmt.Errorf("invalid digest schedule of %s: %w", ch.Name, err)
+		}
+	}
+	// Records also go to clients streaming the logs, at the level of the other output. The tee is
+	// in place before the scheduler starts, so that an early run is streamed too. The default
+	// logger is the one built by logging.Setup, which does not write back to the standard logger.
+	var logs *logging.Broadcast
+	if cfg.API.Listen != "" {
+		handlerOpts, err := logOpts.HandlerOptions()
+		if err != nil {
+			return err
+		}
+		logs = logging.NewBroadcast(apiLogLines)
+		slog.SetDefault(slog.New(logging.Tee(slog.Default().Handler(), slog.NewJSONHandler(logs, handlerOpts))))
+	}
+
+	scheduler.Start()
+	slog.Info("Daemon started", "schedule", cfg.Schedule)
+	logBandwidthLimits(cfg, time.Now())
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	if cfg.Metrics.Listen != "" {
+		wg.Go(func() {
+			if err := serveMetrics(ctx, cfg); err != nil {
+				slog.Warn("Metrics endpoint stopped", "error", err)
+			}
+		})
+	}
+	nextRun := func() time.Time { return scheduler.Entry(backupEntry).Next }
+	if cfg.API.Listen != "" {
+		api := newAPIServer(ctx, cfg, nextRun, logs)
+		wg.Go(func() {
+			if err := api.serve(ctx); err != nil {
+				slog.Warn("API server stopped", "error", err)
+			}
+		})
+	}
+	if cfg.TelegramBot.Enabled {
+		bot := newBot(cfg, nextRun)
+		wg.Go(func() {
+			slog.Info("Telegram bot started")
+			_ = bot.Run(ctx)
+		})
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Shutting down, waiting for running backups and bot commands to stop")
+			<-scheduler.Stop().Done()
+			return nil
+		case now := <-ticker.C:
+			logBandwidthLimits(cfg, now)
+		}
+	}
+}
+
+// logBandwidthLimits applies the bandwidth schedule and logs when the limits change.
+func logBandwidthLimits(cfg *config.Config, now time.Time) {
+	if !applyBandwidthLimits(cfg, now) {
+		return
+	}
+	slog.Info("Bandwidth limits changed",
+		"upload", describeRate(uploadLimiter.Rate()), "download", describeRate(downloadLimiter.Rate()))
+}
+
+func describeRate(bytesPerSecond int64) string {
+	if bytesPerSecond == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.1f KB/s", float64(bytesPerSecond)/1024)
+}
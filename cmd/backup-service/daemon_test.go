@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+)
+
+func TestRunDaemonInvalidSchedule(t *testing.T) {
+	cfg := &config.Config{Schedule: "every night"}
+	if err := runDaemon(context.Background(), cfg); err == nil {
+		t.Fatal("expected error for invalid schedule")
+	}
+}
+
+func TestApplyBandwidthLimits(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Transfer.UploadLimit = 1 << 20
+	cfg.Transfer.Schedule = []config.BandwidthWindow{{From: "08:00", To: "19:00", UploadLimit: 64 << 10}}
+	t.Cleanup(func() { applyBandwidthLimits(&config.Config{}, time.Now()) })
+
+	night := time.Date(2025, 1, 1, 23, 0, 0, 0, time.Local)
+	if !applyBandwidthLimits(cfg, night) || uploadLimiter.Rate() != 1<<20 {
+		t.Errorf("expected default upload limit at night, got %d", uploadLimiter.Rate())
+	}
+	if applyBandwidthLimits(cfg, night.Add(time.Minute)) {
+		t.Error("expected no change within the same window")
+	}
+	noon := time.Date(2025, 1, 2, 12, 0, 0, 0, time.Local)
+	if !applyBandwidthLimits(cfg, noon) || uploadLimiter.Rate() != 64<<10 {
+		t.Errorf("expected office hours upload limit, got %d", uploadLimiter.Rate())
+	}
+}
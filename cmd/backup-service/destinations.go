@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/azure"
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/gcs"
+	"github.com/mikhail-angelov/backup-service/internal/localfs"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/retry"
+	"github.com/mikhail-angelov/backup-service/internal/s3"
+	"github.com/mikhail-angelov/backup-service/internal/sftp"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/mikhail-angelov/backup-service/internal/tracing"
+	"github.com/mikhail-angelov/backup-service/internal/webdav"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func syncCmd() *cobra.Command {
+	var from string
+	cmd := &cobra.Command{
+		Use:   "sync [destination]",
+		Short: "Copy archives that a destination missed from another destination",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+
+			ctx, logger := logging.With(context.Background(), "run_id", logging.NewRunID())
+			copied, err := syncDestination(ctx, cfg, from, args[0])
+			if err != nil {
+				fatalContext(ctx, "Sync failed", "copied", copied, "error", err)
+			}
+			logger.Info("Sync completed", "copied", copied)
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "destination to copy from (default is the first other destination)")
+	return cmd
+}
+
+// syncDestination copies archives present in the source destination but missing in the target,
+// limited to backup sets that are configured to upload to the target.
+func syncDestination(ctx context.Context, cfg *config.Config, sourceName, targetName string) (int, error) {
+	if _, ok := cfg.Destination(targetName); !ok {
+		return 0, fmt.Errorf("unknown destination %q", targetName)
+	}
+	if sourceName == "" {
+		for _, d := range cfg.Destinations {
+			if d.Name != targetName {
+				sourceName = d.Name
+				break
+			}
+		}
+	}
+	if sourceName == "" || sourceName == targetName {
+		return 0, fmt.Errorf("no source destination to sync %s from", targetName)
+	}
+
+	sets := make(map[string]bool)
+	for i := range cfg.Backups {
+		for _, name := range cfg.SetDestinations(&cfg.Backups[i]) {
+			if name == targetName {
+				sets[cfg.Backups[i].Name] = true
+			}
+		}
+	}
+
+	source, err := openDestination(ctx, cfg, sourceName)
+	if err != nil {
+		return 0, err
+	}
+	defer closeStorage(source)
+	target, err := openDestination(ctx, cfg, targetName)
+	if err != nil {
+		return 0, err
+	}
+	defer closeStorage(target)
+
+	sourceKeys, err := listWithRetry(ctx, cfg, source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", sourceName, err)
+	}
+	targetKeys, err := listWithRetry(ctx, cfg, target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", targetName, err)
+	}
+	present := make(map[string]bool, len(targetKeys))
+	for _, key := range targetKeys {
+		present[filepath.Base(key)] = true
+	}
+
+	// Copy in chronological order so that an interrupted sync never leaves an incremental without its base.
+	sort.Strings(sourceKeys)
+	copied := 0
+	for _, key := range sourceKeys {
+		base := filepath.Base(key)
+		name, _ := getBackupNameAndTimestamp(key)
+		if present[base] || !sets[name] || !(strings.Contains(base, ".tar.gz") || strings.Contains(base, backup.DumpExtension)) {
+			continue
+		}
+
+		logging.FromContext(ctx).Info("Copying archive", "key", base, "from", sourceName, "to", targetName)
+		tempPath := filepath.Join(os.TempDir(), base)
+		if err := withRetry(ctx, cfg, func(ctx context.Context) error { return source.Get(ctx, key, tempPath) }); err != nil {
+			_ = os.Remove(tempPath)
+			return copied, fmt.Errorf("failed to download %s: %w", key, err)
+		}
+		err := withRetry(ctx, cfg, func(ctx context.Context) error { return target.Put(ctx, tempPath) })
+		_ = os.Remove(tempPath)
+		if err != nil {
+			return copied, fmt.Errorf("failed to upload %s: %w", base, err)
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// newStorage creates the storage backend described by a destination.
+func newStorage(ctx context.Context, cfg *config.Config, d *config.Destination) (storage.Backend, error) {
+	var (
+		store storage.Backend
+		err   error
+	)
+	switch d.Type {
+	case "s3":
+		store, err = s3.NewClient(ctx, s3.Options{
+			Bucket:          d.S3.Bucket,
+			Region:          d.S3.Region,
+			Endpoint:        d.S3.Endpoint,
+			AccessKeyID:     d.S3.AccessKeyID,
+			SecretAccessKey: d.S3.SecretAccessKey,
+			SessionToken:    d.S3.SessionToken,
+			Profile:         d.S3.Profile,
+			RoleARN:         d.S3.RoleARN,
+			ExternalID:      d.S3.ExternalID,
+			RoleSessionName: d.S3.RoleSessionName,
+			Prefix:          d.S3.Prefix,
+			Upload:          s3UploadOptions(&d.S3.S3UploadConfig),
+			Full:            s3UploadOptions(&d.S3.Full),
+			Incremental:     s3UploadOptions(&d.S3.Incremental),
+			StateDir:        cfg.StateDir,
+			PartSize:        int64(cfg.Transfer.PartSize),
+			Concurrency:     cfg.Transfer.Concurrency,
+			UploadLimiter:   uploadLimiter,
+			DownloadLimiter: downloadLimiter,
+		})
+	case "local":
+		store, err = localfs.NewClient(localfs.Options{
+			Path:            d.Local.Path,
+			Prefix:          d.Local.Prefix,
+			UploadLimiter:   uploadLimiter,
+			DownloadLimiter: downloadLimiter,
+		})
+	case "sftp":
+		store, err = sftp.NewClient(ctx, sftp.Options{
+			Host:                  d.SFTP.Host,
+			Port:                  d.SFTP.Port,
+			User:                  d.SFTP.User,
+			Password:              d.SFTP.Password,
+			PrivateKeyPath:        d.SFTP.PrivateKeyPath,
+			KnownHostsPath:        d.SFTP.KnownHostsPath,
+			InsecureIgnoreHostKey: d.SFTP.InsecureIgnoreHostKey,
+			Path:                  d.SFTP.Path,
+			Prefix:                d.SFTP.Prefix,
+			UploadLimiter:         uploadLimiter,
+			DownloadLimiter:       downloadLimiter,
+		})
+	case "webdav":
+		store, err = webdav.NewClient(webdav.Options{
+			URL:             d.WebDAV.URL,
+			Username:        d.WebDAV.Username,
+			Password:        d.WebDAV.Password,
+			Prefix:          d.WebDAV.Prefix,
+			UploadLimiter:   uploadLimiter,
+			DownloadLimiter: downloadLimiter,
+		})
+	case "azure":
+		store, err = azure.NewClient(azure.Options{
+			ConnectionString: d.Azure.ConnectionString,
+			AccountName:      d.Azure.AccountName,
+			AccountKey:       d.Azure.AccountKey,
+			Endpoint:         d.Azure.Endpoint,
+			Container:        d.Azure.Container,
+			Prefix:           d.Azure.Prefix,
+			UploadLimiter:    uploadLimiter,
+			DownloadLimiter:  downloadLimiter,
+		})
+	case "gcs":
+		store, err = gcs.NewClient(ctx, gcs.Options{
+			Bucket:          d.GCS.Bucket,
+			Prefix:          d.GCS.Prefix,
+			CredentialsFile: d.GCS.CredentialsFile,
+			CredentialsJSON: d.GCS.CredentialsJSON,
+			Endpoint:        d.GCS.Endpoint,
+			Anonymous:       d.GCS.Anonymous,
+			UploadLimiter:   uploadLimiter,
+			DownloadLimiter: downloadLimiter,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", d.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// uploadLimiter and downloadLimiter are shared by all destinations, so that parallel transfers
+// together stay within the configured bandwidth.
+var (
+	uploadLimiter   = ratelimit.New(0)
+	downloadLimiter = ratelimit.New(0)
+)
+
+// applyBandwidthLimits sets the shared limiters to the limits in effect at the given time and
+// reports whether they changed.
+func applyBandwidthLimits(cfg *config.Config, now time.Time) bool {
+	up, down := cfg.Transfer.Limits(now)
+	if up == uploadLimiter.Rate() && down == downloadLimiter.Rate() {
+		return false
+	}
+	uploadLimiter.SetRate(up)
+	downloadLimiter.SetRate(down)
+	return true
+}
+
+func s3UploadOptions(u *config.S3UploadConfig) s3.UploadOptions {
+	return s3.UploadOptions{
+		StorageClass:   u.StorageClass,
+		SSE:            u.SSE,
+		SSEKMSKeyID:    u.SSEKMSKeyID,
+		ObjectLockMode: u.ObjectLockMode,
+		ObjectLockDays: u.ObjectLockDays,
+		Tags:           u.Tags,
+	}
+}
+
+// closeStorage releases connections held by backends such as SFTP.
+func closeStorage(store storage.Backend) {
+	if closer, ok := store.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+// openDestination creates the storage backend of a named destination.
+func openDestination(ctx context.Context, cfg *config.Config, name string) (storage.Backend, error) {
+	d, ok := cfg.Destination(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown destination %q", name)
+	}
+	applyBandwidthLimits(cfg, time.Now())
+	store, err := newStorage(ctx, cfg, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to destination %s: %w", name, err)
+	}
+	return store, nil
+}
+
+// openDestinations connects to every configured destination. A destination that cannot be
+// reached is reported as an error and left out, so that it does not block the others.
+func openDestinations(ctx context.Context, cfg *config.Config) (map[string]storage.Backend, []error) {
+	stores := make(map[string]storage.Backend, len(cfg.Destinations))
+	var errs []error
+	for _, d := range cfg.Destinations {
+		store, err := openDestination(ctx, cfg, d.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		stores[d.Name] = store
+	}
+	return stores, errs
+}
+
+func closeDestinations(stores map[string]storage.Backend) {
+	for _, store := range stores {
+		closeStorage(store)
+	}
+}
+
+// findDestination opens the named destination, or the first destination holding key when name is empty,
+// and returns it together with its listing.
+func findDestination(ctx context.Context, cfg *config.Config, name, key string) (storage.Backend, []string, error) {
+	candidates := []string{name}
+	if name == "" {
+		candidates = candidates[:0]
+		for _, d := range cfg.Destinations {
+			candidates = append(candidates, d.Name)
+		}
+	}
+
+	var errs []error
+	for _, candidate := range candidates {
+		store, err := openDestination(ctx, cfg, candidate)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys, err := listWithRetry(ctx, cfg, store)
+		if err != nil {
+			closeStorage(store)
+			errs = append(errs, fmt.Errorf("failed to list %s: %w", candidate, err))
+			continue
+		}
+		for _, k := range keys {
+			if k == key {
+				return store, keys, nil
+			}
+		}
+		closeStorage(store)
+	}
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("%s not found, some destinations failed: %v", key, errs)
+	}
+	return nil, nil, fmt.Errorf("%s not found in any destination", key)
+}
+
+// availableDestinations filters names down to the destinations that were opened successfully.
+func availableDestinations(names []string, stores map[string]storage.Backend) []string {
+	available := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := stores[name]; ok {
+			available = append(available, name)
+		}
+	}
+	return available
+}
+
+type uploadResult struct {
+	name     string
+	err      error
+	duration time.Duration
+}
+
+// uploadToDestinations uploads a file to several destinations in parallel and reports the outcome of each.
+func uploadToDestinations(ctx context.Context, cfg *config.Config, stores map[string]storage.Backend, names []string, filePath string) []uploadResult {
+	results := make([]uploadResult, len(names))
+	var wg sync.WaitGroup
+	set, _ := getBackupNameAndTimestamp(filePath)
+	size := fileSize(filePath)
+	for i, name := range names {
+		wg.Go(func() {
+			ctx, span := tracing.Start(ctx, "backup.upload", attribute.String("set", set),
+				attribute.String("destination", name), attribute.Int64("bytes", size))
+			start := time.Now()
+			attempts := 0
+			err := withRetry(ctx, cfg, func(ctx context.Context) error {
+				attempts++
+				return stores[name].Put(ctx, filePath)
+			})
+			span.SetAttributes(attribute.Int("retries", attempts-1))
+			tracing.End(span, err)
+			results[i] = uploadResult{name: name, err: err, duration: time.Since(start)}
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// withRetry runs a storage operation, retrying failures with the configured exponential backoff.
+// Missing objects are reported right away.
+func withRetry(ctx context.Context, cfg *config.Config, fn func(ctx context.Context) error) error {
+	policy := retry.Policy{
+		Attempts:     cfg.Retry.Attempts,
+		InitialDelay: cfg.Retry.InitialDelay,
+		MaxDelay:     cfg.Retry.MaxDelay,
+	}
+	attempt := 0
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		attempt++
+		err := fn(ctx)
+		if errors.Is(err, storage.ErrNotFound) {
+			return retry.Permanent(err)
+		}
+		if err != nil && attempt < policy.Attempts {
+			logging.FromContext(ctx).Warn("Storage operation failed, retrying", "attempt", attempt, "error", err)
+			trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt), attribute.String("error", err.Error())))
+		}
+		return err
+	})
+}
+
+func listWithRetry(ctx context.Context, cfg *config.Config, store storage.Backend) ([]string, error) {
+	var keys []string
+	err := withRetry(ctx, cfg, func(ctx context.Context) error {
+		var err error
+		keys, err = store.List(ctx)
+		return err
+	})
+	return keys, err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/notify"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/mikhail-angelov/backup-service/internal/state"
+	"github.com/robfig/cron/v3"
+)
+
+// digestMu serializes access to the digest state files, which both backup runs and the daemon's
+// digest schedule update.
+var digestMu sync.Mutex
+
+// digestState holds the reports a digest channel has collected since its last summary.
+type digestState struct {
+	LastSent time.Time       `json:"last_sent,omitempty"`
+	Runs     []report.Report `json:"runs,omitempty"`
+}
+
+func digestStore(cfg *config.Config) (*state.Store, error) {
+	return state.NewStore(filepath.Join(cfg.StateDir, "digests"))
+}
+
+// queueDigest adds a run report to the digest of a channel.
+func queueDigest(cfg *config.Config, ch config.NotificationChannel, rep *report.Report) error {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+
+	store, err := digestStore(cfg)
+	if err != nil {
+		return err
+	}
+	var st digestState
+	if err := store.Load(ch.Name+".json", &st); err != nil {
+		return err
+	}
+	if st.LastSent.IsZero() && len(st.Runs) == 0 {
+		// The first period starts with the first report.
+		st.LastSent = rep.Started
+	}
+	st.Runs = append(st.Runs, *rep)
+	return store.Save(ch.Name+".json", &st)
+}
+
+// flushDigests sends the digest of every channel whose schedule came due since its last summary.
+// Periods without any run are skipped silently.
+func flushDigests(ctx context.Context, cfg *config.Config, now time.Time) {
+	for _, ch := range cfg.Notifications {
+		if ch.Digest.Schedule == "" {
+			continue
+		}
+		if err := flushDigest(ctx, cfg, ch, now); err != nil {
+			logging.FromContext(ctx).Warn("Digest failed", "channel", ch.Name, "error", err)
+		}
+	}
+}
+
+func flushDigest(ctx context.Context, cfg *config.Config, ch config.NotificationChannel, now time.Time) error {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+
+	schedule, err := cron.ParseStandard(ch.Digest.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid digest schedule %q: %w", ch.Digest.Schedule, err)
+	}
+	store, err := digestStore(cfg)
+	if err != nil {
+		return err
+	}
+	var st digestState
+	if err := store.Load(ch.Name+".json", &st); err != nil {
+		return err
+	}
+	if st.LastSent.IsZero() || now.Before(schedule.Next(st.LastSent)) {
+		return nil
+	}
+
+	if len(st.Runs) > 0 {
+		digest := &report.Digest{Since: st.LastSent, Until: now, Runs: st.Runs}
+		n, err := newNotifier(ch)
+		if err != nil {
+			return err
+		}
+		if err := n.Notify(ctx, digestMessage(ch, digest)); err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info("Sent digest", "channel", ch.Name, "runs", len(st.Runs))
+	}
+	return store.Save(ch.Name+".json", &digestState{LastSent: now})
+}
+
+// digestMessage renders a digest for a channel, with its own digest template if it has one.
+func digestMessage(ch config.NotificationChannel, digest *report.Digest) notify.Message {
+	format := channelFormat(ch)
+	msg := notify.Message{Subject: digest.Subject(), Format: format}
+	tmpl, err := report.DigestTemplate(format, ch.Digest.Template)
+	if err == nil {
+		msg.Body, err = report.Render(tmpl, digest)
+	}
+	if err != nil {
+		slog.Warn("Digest template failed, using the default one", "channel", ch.Name, "error", err)
+		tmpl, _ = report.DigestTemplate(format, "")
+		msg.Body, _ = report.Render(tmpl, digest)
+	}
+	return msg
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/docker"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+)
+
+// archiveDockerSet archives the volumes selected by a docker backup set. Volume contents are stored
+// under docker-volumes/<name>, next to a manifest that lets restore recreate the volumes by name.
+// Containers using the volumes are paused or stopped while tar runs if the set asks for it.
+func archiveDockerSet(ctx context.Context, engine *backup.Engine, b *config.BackupSet, snapshotFile string, isFull bool, logger *slog.Logger) (res backup.ArchiveResult, err error) {
+	client := docker.NewClient(b.Docker.Command)
+	volumes, err := client.Select(ctx, b.Docker.Volumes, b.Docker.VolumeLabel, b.Docker.ContainerLabel)
+	if err != nil {
+		return res, err
+	}
+	if len(volumes) == 0 {
+		return res, errors.New("no docker volumes matched")
+	}
+
+	manifestDir, err := os.MkdirTemp("", b.Name+"-docker-")
+	if err != nil {
+		return res, fmt.Errorf("failed to create volume manifest dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(manifestDir) }()
+	manifest, err := docker.WriteManifest(manifestDir, volumes)
+	if err != nil {
+		return res, err
+	}
+
+	spec := backup.ArchiveSpec{
+		Name:         b.Name,
+		Folders:      []string{manifest},
+		Exclude:      b.Exclude,
+		SnapshotFile: snapshotFile,
+		IsFull:       isFull,
+		Transforms:   backup.TransformPrefix(manifest, docker.ManifestName),
+	}
+	for _, v := range volumes {
+		spec.Folders = append(spec.Folders, v.Mountpoint)
+		spec.Transforms = append(spec.Transforms, backup.TransformPrefix(v.Mountpoint, docker.VolumesDir+"/"+v.Name)...)
+	}
+
+	if mode := b.Docker.Containers; mode == "pause" || mode == "stop" {
+		ids, err := client.RunningContainers(ctx, volumes)
+		if err != nil {
+			return res, err
+		}
+		if len(ids) > 0 {
+			logger.Info("Quiescing containers while archiving", "mode", mode, "containers", len(ids))
+			resume, err := client.Quiesce(ctx, mode, ids)
+			if err != nil {
+				return res, err
+			}
+			defer func() {
+				if rerr := resume(context.WithoutCancel(ctx)); rerr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to resume containers: %w", rerr))
+				}
+			}()
+		}
+	}
+
+	logger.Info("Archiving docker volumes", "volumes", len(volumes))
+	return engine.Archive(spec)
+}
+
+// restoreDockerVolumes recreates the volumes listed in the manifest extracted into targetDir and copies
+// their restored contents into them. Volumes that already exist and hold data are left untouched.
+func restoreDockerVolumes(ctx context.Context, set *config.BackupSet, targetDir string) error {
+	manifest, err := docker.ReadManifest(targetDir)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return fmt.Errorf("no %s found in the restored archive", docker.ManifestName)
+	}
+
+	client := docker.NewClient(set.Docker.Command)
+	var errs []error
+	for _, v := range manifest.Volumes {
+		src := filepath.Join(targetDir, docker.VolumesDir, v.Name)
+		if err := restoreDockerVolume(ctx, client, v, src); err != nil {
+			errs = append(errs, fmt.Errorf("volume %s: %w", v.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func restoreDockerVolume(ctx context.Context, client *docker.Client, v docker.Volume, src string) error {
+	exists, err := client.Exists(ctx, v.Name)
+	if err != nil {
+		return err
+	}
+	var target *docker.Volume
+	if exists {
+		volumes, err := client.Inspect(ctx, v.Name)
+		if err != nil {
+			return err
+		}
+		target = &volumes[0]
+		if entries, err := os.ReadDir(target.Mountpoint); err != nil || len(entries) > 0 {
+			logging.FromContext(ctx).Warn("Volume already exists and is not empty, leaving it as is", "volume", v.Name, "restored_to", src)
+			return nil
+		}
+	} else {
+		logging.FromContext(ctx).Info("Creating docker volume", "volume", v.Name)
+		if target, err = client.Create(ctx, v); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "cp", "-a", src+"/.", target.Mountpoint+"/") // #nosec G204
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy data into the volume: %w, output: %s", err, string(output))
+	}
+	return nil
+}
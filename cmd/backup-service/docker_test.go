@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+)
+
+// fakeDocker knows the volumes under $FAKE_DOCKER_DIR/volumes, reports one running container
+// using them and records every call in $FAKE_DOCKER_DIR/calls.
+const fakeDocker = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_DIR/calls"
+case "$1 $2" in
+"volume ls") n=${5#name=^}; n=${n%?}; [ -d "$FAKE_DOCKER_DIR/volumes/$n" ] && echo "$n" ;;
+"volume inspect")
+  shift 2; printf '['; sep=""
+  for n; do
+    printf '%s{"Name":"%s","Driver":"local","Mountpoint":"%s/volumes/%s","Labels":{"app":"shop"}}' "$sep" "$n" "$FAKE_DOCKER_DIR" "$n"
+    sep=","
+  done
+  echo ']' ;;
+"volume create") eval n=\${$#}; mkdir -p "$FAKE_DOCKER_DIR/volumes/$n" ;;
+"ps -q") echo c1 ;;
+esac
+exit 0
+`
+
+func TestDockerSetRoundTrip(t *testing.T) {
+	cfg, stores, dir := hookTestSetup(t)
+	t.Setenv("FAKE_DOCKER_DIR", dir)
+	command := filepath.Join(dir, "docker")
+	if err := os.WriteFile(command, []byte(fakeDocker), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	dbFile := filepath.Join(dir, "volumes", "db", "data", "table")
+	if err := os.MkdirAll(filepath.Dir(dbFile), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dbFile, []byte("rows"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Backups = []config.BackupSet{{
+		Name:   "shop",
+		Type:   "docker",
+		Docker: config.DockerConfig{Volumes: []string{"db"}, Containers: "pause", Command: command},
+	}}
+	set := &cfg.Backups[0]
+	if errs := backupSet(context.Background(), cfg, backup.NewEngine(t.TempDir()), stores, nil, set, true).Errors; len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	calls := readHookLog(t, filepath.Join(dir, "calls"))
+	if !strings.Contains(calls, "pause c1\n") || !strings.HasSuffix(calls, "unpause c1\n") {
+		t.Errorf("expected the container to be paused and unpaused, got:\n%s", calls)
+	}
+
+	keys, err := stores["local"].List(context.Background())
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected one archive, got %v, %v", keys, err)
+	}
+
+	// Restore on a host where the volume is gone.
+	if err := os.RemoveAll(filepath.Join(dir, "volumes")); err != nil {
+		t.Fatal(err)
+	}
+	target := t.TempDir()
+	if err := restoreChain(context.Background(), cfg, stores["local"], keys, target); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	data, err := os.ReadFile(dbFile)
+	if err != nil || string(data) != "rows" {
+		t.Errorf("expected the volume to be recreated with its data, got %q, %v", data, err)
+	}
+	if calls := readHookLog(t, filepath.Join(dir, "calls")); !strings.Contains(calls, "volume create --driver local --label app=shop db") {
+		t.Errorf("expected the volume to be created with its labels, got:\n%s", calls)
+	}
+}
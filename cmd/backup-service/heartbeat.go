@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/heartbeat"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/notify"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/spf13/cobra"
+)
+
+// startHeartbeat pings the set's monitor that its backup started and collects the end of the set's
+// log, which is written through the logger of the returned context. The returned function pings the
+// outcome recorded in the set report, with the log as details. Failed pings are logged and do not
+// affect the backup.
+func startHeartbeat(ctx context.Context, b *config.BackupSet) (context.Context, func(rep *report.Set)) {
+	pinger := &heartbeat.Pinger{Type: b.Heartbeat.Type, URL: b.Heartbeat.URL}
+	tail := &heartbeat.Tail{Limit: heartbeat.MaxBodySize}
+	logger := slog.New(logging.Tee(logging.FromContext(ctx).Handler(), slog.NewTextHandler(tail, nil)))
+	ctx = logging.WithContext(ctx, logger)
+	if err := pinger.Start(ctx); err != nil {
+		logger.Warn("Heartbeat start ping failed", "error", err)
+	}
+
+	return ctx, func(rep *report.Set) {
+		// The outcome is reported even when the run was cancelled.
+		ctx := context.WithoutCancel(ctx)
+		var body strings.Builder
+		body.WriteString(tail.String())
+		for _, w := range rep.Warnings {
+			body.WriteString("Warning: " + w + "\n")
+		}
+		for _, e := range rep.Errors {
+			body.WriteString("Error: " + e + "\n")
+		}
+
+		ping := pinger.Success
+		if rep.Status() == report.StatusFailure {
+			ping = pinger.Failure
+		}
+		if err := ping(ctx, body.String()); err != nil {
+			logger.Warn("Heartbeat ping failed", "error", err)
+		}
+	}
+}
+
+// staleBackup is a set whose newest backup in a destination is missing or too old.
+type staleBackup struct {
+	Set         string
+	Destination string
+	Newest      time.Time // Zero when the destination holds no backup of the set
+	MaxAge      time.Duration
+	Err         error // Set when the destination could not be listed
+}
+
+func (s staleBackup) String() string {
+	switch {
+	case s.Err != nil:
+		return fmt.Sprintf("%s in %s: %v", s.Set, s.Destination, s.Err)
+	case s.Newest.IsZero():
+		return fmt.Sprintf("%s in %s: no backup found", s.Set, s.Destination)
+	}
+	return fmt.Sprintf("%s in %s: newest backup from %s is older than %s", s.Set, s.Destination, s.Newest.Format("2006-01-02 15:04"), s.MaxAge)
+}
+
+func checkCmd() *cobra.Command {
+	var sets []string
+	var maxAge time.Duration
+	var alert bool
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check that every set has a recent backup in each of its destinations, alerting otherwise",
+		Run: func(_ *cobra.Command, _ []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+
+			ctx := context.Background()
+			stale, err := checkStaleness(ctx, cfg, sets, maxAge, time.Now())
+			if err != nil {
+				fatal("Staleness check failed", "error", err)
+			}
+			if len(stale) == 0 {
+				slog.Info("All backups are recent")
+				return
+			}
+			for _, s := range stale {
+				slog.Warn("Stale backup: "+s.String(), "set", s.Set, "destination", s.Destination)
+			}
+			if alert {
+				alertStale(ctx, cfg, stale)
+			}
+			os.Exit(1)
+		},
+	}
+	cmd.Flags().StringSliceVar(&sets, "set", nil, "only check these sets (default all)")
+	cmd.Flags().DurationVar(&maxAge, "max-age", defaultMaxAge, "age of the newest backup above which a set is stale, unless the set has max_age")
+	cmd.Flags().BoolVar(&alert, "notify", true, "send stale sets to the notification channels")
+	return cmd
+}
+
+// checkStaleness returns the sets, all of them when names is empty, whose newest backup in one of
+// their destinations is older than their max_age, or defaultMaxAge when they have none.
+func checkStaleness(ctx context.Context, cfg *config.Config, names []string, defaultMaxAge time.Duration, now time.Time) ([]staleBackup, error) {
+	for _, name := range names {
+		if _, ok := cfg.BackupSet(name); !ok {
+			return nil, fmt.Errorf("unknown backup set %q", name)
+		}
+	}
+
+	listings := make(map[string][]string, len(cfg.Destinations))
+	listErrs := make(map[string]error)
+	for _, d := range cfg.Destinations {
+		keys, err := listBackups(ctx, cfg, d.Name, "")
+		if err != nil {
+			listErrs[d.Name] = err
+			continue
+		}
+		listings[d.Name] = keys
+	}
+
+	var stale []staleBackup
+	for i := range cfg.Backups {
+		b := &cfg.Backups[i]
+		if len(names) > 0 && !slices.Contains(names, b.Name) {
+			continue
+		}
+		maxAge := b.MaxAge
+		if maxAge <= 0 {
+			maxAge = defaultMaxAge
+		}
+		for _, dest := range cfg.SetDestinations(b) {
+			s := staleBackup{Set: b.Name, Destination: dest, MaxAge: maxAge, Err: listErrs[dest]}
+			if s.Err == nil {
+				s.Newest = newestBackup(listings[dest], b.Name)
+				if !s.Newest.IsZero() && now.Sub(s.Newest) <= maxAge {
+					continue
+				}
+			}
+			stale = append(stale, s)
+		}
+	}
+	return stale, nil
+}
+
+// newestBackup returns the creation time of the newest archive of a set among keys.
+func newestBackup(keys []string, set string) time.Time {
+	var newest time.Time
+	for _, key := range keys {
+		name, timestamp := getBackupNameAndTimestamp(key)
+		if name != set {
+			continue
+		}
+		t, err := time.ParseInLocation("20060102150405", timestamp, time.Local)
+		if err == nil && t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
+// alertStale sends the stale sets to every channel that accepts failures. Digest channels receive
+// the alert right away, since it is about runs that did not happen.
+func alertStale(ctx context.Context, cfg *config.Config, stale []staleBackup) {
+	hostname, _ := os.Hostname()
+	for _, ch := range cfg.Notifications {
+		if !ch.Accepts(report.StatusFailure) {
+			continue
+		}
+		format := channelFormat(ch)
+		lines := make([]string, len(stale))
+		for i, s := range stale {
+			lines[i] = report.Escape(format, "- "+s.String())
+		}
+		msg := notify.Message{Subject: "⏰ Stale backups on " + hostname, Body: strings.Join(lines, "\n"), Format: format}
+		n, err := newNotifier(ch)
+		if err == nil {
+			err = n.Notify(ctx, msg)
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn("Notification failed", "channel", ch.Name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+)
+
+func TestBackupSetHeartbeat(t *testing.T) {
+	var mu sync.Mutex
+	var pings []string
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		pings = append(pings, r.URL.Path+" "+string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg, stores, dir := hookTestSetup(t)
+	set := &config.BackupSet{Name: "app", Folders: []string{dir}, Heartbeat: config.HeartbeatConfig{Type: "healthchecks", URL: srv.URL + "/uuid"}}
+	if errs := backupSet(context.Background(), cfg, backup.NewEngine(t.TempDir()), stores, nil, set, true).Errors; len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(pings) != 2 || pings[0] != "/uuid/start " || !strings.HasPrefix(pings[1], "/uuid ") || !strings.Contains(pings[1], `msg="Backup completed"`) {
+		t.Fatalf("expected start and success pings with the set log, got %q", pings)
+	}
+
+	pings = nil
+	set.Hooks.PreBackup = []string{"exit 1"}
+	backupSet(context.Background(), cfg, backup.NewEngine(t.TempDir()), stores, nil, set, true)
+	if len(pings) != 2 || !strings.HasPrefix(pings[1], "/uuid/fail ") || !strings.Contains(pings[1], "Error: backup app aborted") {
+		t.Errorf("expected a failure ping with the error, got %q", pings)
+	}
+}
+
+func TestCheckStaleness(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+	primary, secondary := t.TempDir(), t.TempDir()
+	for dir, names := range map[string][]string{
+		primary:   {"web_20250310020000.inc.tar.gz", "db_20250301020000.full.sql.gz"},
+		secondary: {"web_20250308020000.full.tar.gz"},
+	} {
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cfg := &config.Config{
+		StateDir: t.TempDir(),
+		Destinations: []config.Destination{
+			{Name: "primary", Type: "local", Local: config.LocalConfig{Path: primary}},
+			{Name: "secondary", Type: "local", Local: config.LocalConfig{Path: secondary}},
+		},
+		Backups: []config.BackupSet{
+			{Name: "web", Folders: []string{"/srv"}},
+			{Name: "db", Type: "postgres", MaxAge: 14 * 24 * time.Hour, Destinations: []string{"primary"}},
+		},
+	}
+	cfg.Retry.Attempts = 1
+
+	stale, err := checkStaleness(context.Background(), cfg, nil, 26*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0].Set != "web" || stale[0].Destination != "secondary" {
+		t.Fatalf("expected web to be stale in secondary only, got %v", stale)
+	}
+	if got := stale[0].String(); got != "web in secondary: newest backup from 2025-03-08 02:00 is older than 26h0m0s" {
+		t.Errorf("unexpected description %q", got)
+	}
+
+	if stale, _ := checkStaleness(context.Background(), cfg, []string{"db"}, time.Hour, now.Add(30*24*time.Hour)); len(stale) != 1 || stale[0].Set != "db" {
+		t.Errorf("expected db to be stale after its max_age, got %v", stale)
+	}
+	if _, err := checkStaleness(context.Background(), cfg, []string{"nope"}, time.Hour, now); err == nil {
+		t.Error("expected error for an unknown set")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/history"
+	"github.com/mikhail-angelov/backup-service/internal/lock"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/spf13/cobra"
+)
+
+// defaultMaxAge is the age of the newest backup above which a set without max_age is stale.
+const defaultMaxAge = 26 * time.Hour
+
+// historyTimeout is how long commands wait for another process, e.g. the daemon recording a run,
+// to release the history database.
+const historyTimeout = 10 * time.Second
+
+// openHistory opens the run history kept in the state directory. Callers close it right away, so
+// that the daemon and the command line can take turns.
+func openHistory(cfg *config.Config) (*history.DB, error) {
+	return history.Open(filepath.Join(cfg.StateDir, history.File), historyTimeout)
+}
+
+func recordHistory(cfg *config.Config, rep *report.Report) error {
+	db, err := openHistory(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	return db.Add(rep)
+}
+
+// Health of a set in the status command, from best to worst.
+const (
+	healthOK      = "ok"
+	healthWarning = "warning"
+	healthStale   = "stale"
+	healthFailing = "failing"
+	healthUnknown = "unknown" // No run recorded yet
+)
+
+// setHealth is the health of a backup set, derived from the run history.
+type setHealth struct {
+	history.SetHealth
+	Health string        `json:"health"`
+	MaxAge time.Duration `json:"max_age"`
+}
+
+// serviceStatus is what the status command shows.
+type serviceStatus struct {
+	// Running describes the owner of the local lock while a backup runs.
+	Running string      `json:"running,omitempty"`
+	Sets    []setHealth `json:"sets"`
+}
+
+// runningBackup returns the owner of the local lock if a backup, started by the daemon or from the
+// command line, is running on this host.
+func runningBackup(cfg *config.Config) (string, error) {
+	owner, err := lock.InspectLocal(localLockPath(cfg))
+	if err != nil || owner == nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s: %s", lock.ErrLocked, owner), nil
+}
+
+// collectStatus returns the health of every configured set. A set is stale when its last
+// successful backup is older than its max_age, or defaultMaxAge when it has none.
+func collectStatus(cfg *config.Config, defaultMaxAge time.Duration, now time.Time) (*serviceStatus, error) {
+	running, err := runningBackup(cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(cfg.Backups))
+	for i, b := range cfg.Backups {
+		names[i] = b.Name
+	}
+	db, err := openHistory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	health, err := db.Health(names)
+	_ = db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	st := &serviceStatus{Running: running}
+	for i, h := range health {
+		s := setHealth{SetHealth: h, MaxAge: defaultMaxAge}
+		if maxAge := cfg.Backups[i].MaxAge; maxAge > 0 {
+			s.MaxAge = maxAge
+		}
+		switch {
+		case h.Latest == nil:
+			s.Health = healthUnknown
+		case h.Status == report.StatusFailure:
+			s.Health = healthFailing
+		case h.LastSuccess.IsZero() || now.Sub(h.LastSuccess) > s.MaxAge:
+			s.Health = healthStale
+		case h.Status == report.StatusWarning:
+			s.Health = healthWarning
+		default:
+			s.Health = healthOK
+		}
+		st.Sets = append(st.Sets, s)
+	}
+	return st, nil
+}
+
+func historyCmd() *cobra.Command {
+	var limit int
+	var setName string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the latest backup runs recorded on this host",
+		Run: func(_ *cobra.Command, _ []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+			db, err := openHistory(cfg)
+			if err != nil {
+				fatal("Failed to open the run history", "error", err)
+			}
+			runs, err := db.Runs(limit, setName)
+			_ = db.Close()
+			if err != nil {
+				fatal("Failed to read the run history", "error", err)
+			}
+
+			switch {
+			case asJSON:
+				err = writeJSON(os.Stdout, runs)
+			case setName != "":
+				err = writeSetHistory(os.Stdout, runs, setName)
+			default:
+				err = writeHistory(os.Stdout, runs)
+			}
+			if err != nil {
+				fatal("Failed to write the run history", "error", err)
+			}
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "number of runs to show, 0 for all")
+	cmd.Flags().StringVar(&setName, "set", "", "only show runs of this set, with its archive, size and errors")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the run reports as JSON")
+	return cmd
+}
+
+func statusCmd() *cobra.Command {
+	var maxAge time.Duration
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the health of each backup set from the run history, and whether a backup is running",
+		Run: func(_ *cobra.Command, _ []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+			st, err := collectStatus(cfg, maxAge, time.Now())
+			if err != nil {
+				fatal("Failed to collect the status", "error", err)
+			}
+			if asJSON {
+				err = writeJSON(os.Stdout, st)
+			} else {
+				err = writeStatus(os.Stdout, st, time.Now())
+			}
+			if err != nil {
+				fatal("Failed to write the status", "error", err)
+			}
+		},
+	}
+	cmd.Flags().DurationVar(&maxAge, "max-age", defaultMaxAge, "age of the last success above which a set is stale, unless the set has max_age")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the status as JSON")
+	return cmd
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeHistory(w io.Writer, runs []*report.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tDURATION\tRUN ID\tSTATUS\tSETS\tERRORS")
+	for _, r := range runs {
+		sets := make([]string, len(r.Sets))
+		for i, s := range r.Sets {
+			sets[i] = s.Name + ":" + s.Status()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Started.Local().Format("2006-01-02 15:04:05"),
+			r.Duration().Round(time.Second), dash(r.RunID), r.Status(), dash(strings.Join(sets, " ")), firstLine(r.AllErrors()))
+	}
+	return tw.Flush()
+}
+
+func writeSetHistory(w io.Writer, runs []*report.Report, name string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tDURATION\tSTATUS\tTYPE\tARCHIVE\tSIZE\tFILES\tWARNINGS\tERRORS")
+	for _, r := range runs {
+		s, ok := r.Set(name)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n", r.Started.Local().Format("2006-01-02 15:04:05"),
+			s.Duration.Round(time.Second), s.Status(), dash(s.BackupType), dash(s.Archive), report.FormatBytes(s.Size),
+			s.Files, len(s.Warnings), firstLine(s.Errors))
+	}
+	return tw.Flush()
+}
+
+func writeStatus(w io.Writer, st *serviceStatus, now time.Time) error {
+	if st.Running != "" {
+		fmt.Fprintf(w, "Backup running: %s\n\n", st.Running)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SET\tHEALTH\tLAST RUN\tLAST SUCCESS\tFAILURES\tLAST ARCHIVE\tSIZE")
+	for _, s := range st.Sets {
+		archive, size := "-", "-"
+		if s.LastArchive != nil {
+			archive, size = s.LastArchive.Archive, report.FormatBytes(s.LastArchive.Size)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", s.Name, s.Health, ago(s.LastRun, now), ago(s.LastSuccess, now),
+			s.Failures, archive, size)
+	}
+	return tw.Flush()
+}
+
+// ago describes a past time relative to now, e.g. "2026-10-18 03:00 (5h ago)".
+func ago(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Local().Format("2006-01-02 15:04"), shortDuration(now.Sub(t)))
+}
+
+// shortDuration renders a duration in its largest unit, e.g. "9h" or "3d".
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return d.Round(time.Second).String()
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// firstLine summarizes errors for a table cell.
+func firstLine(errs []string) string {
+	if len(errs) == 0 {
+		return "-"
+	}
+	line, _, _ := strings.Cut(errs[0], "\n")
+	if len(errs) > 1 {
+		line += fmt.Sprintf(" (+%d more)", len(errs)-1)
+	}
+	return line
+}
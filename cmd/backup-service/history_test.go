@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+)
+
+func TestHistoryAndStatus(t *testing.T) {
+	cfg := newTestConfig(t)
+	src := cfg.Backups[0].Folders[0]
+	cfg.Backups = append(cfg.Backups,
+		config.BackupSet{Name: "broken", Type: "files", Folders: []string{filepath.Join(src, "missing")}},
+		config.BackupSet{Name: "new", Type: "files", Folders: []string{src}, MaxAge: time.Hour},
+	)
+
+	for range 2 {
+		if _, err := executeBackup(context.Background(), cfg, false, []string{"docs", "broken"}); err == nil {
+			t.Fatal("expected the broken set to fail")
+		}
+	}
+
+	db, err := openHistory(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := db.Runs(0, "")
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Status() != "failure" || !runs[0].Started.After(runs[1].Started) {
+		t.Fatalf("expected 2 failed runs newest first, got %+v", runs)
+	}
+
+	var out strings.Builder
+	if err := writeSetHistory(&out, runs, "docs"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 ||
+		!strings.Contains(lines[1], "success  inc") || !strings.Contains(lines[2], "success  full") {
+		t.Errorf("unexpected set history:\n%s", out.String())
+	}
+
+	st, err := collectStatus(cfg, 26*time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	health := make(map[string]setHealth)
+	for _, s := range st.Sets {
+		health[s.Name] = s
+	}
+	if h := health["docs"]; h.Health != healthOK || h.LastArchive == nil || h.LastArchive.Size == 0 {
+		t.Errorf("unexpected docs health %+v", h)
+	}
+	if h := health["broken"]; h.Health != healthFailing || h.Failures != 2 || !h.LastSuccess.IsZero() {
+		t.Errorf("unexpected broken health %+v", h)
+	}
+	if h := health["new"]; h.Health != healthUnknown || h.MaxAge != time.Hour {
+		t.Errorf("unexpected new health %+v", h)
+	}
+	if st, _ := collectStatus(cfg, 26*time.Hour, time.Now().Add(27*time.Hour)); st.Sets[0].Health != healthStale {
+		t.Errorf("expected docs to be stale a day later, got %s", st.Sets[0].Health)
+	}
+
+	out.Reset()
+	if err := writeStatus(&out, st, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"docs    ok", "broken  failing", "new     unknown  never"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("status lacks %q:\n%s", want, out.String())
+		}
+	}
+}
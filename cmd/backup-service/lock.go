@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/lock"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// localLockPath is the lock file preventing overlapping runs on this host.
+func localLockPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "backup.lock")
+}
+
+// lockDestinations takes the remote lock in every opened destination. Destinations locked by
+// another run are reported and removed from stores, so that the run leaves them alone.
+func lockDestinations(ctx context.Context, cfg *config.Config, stores map[string]storage.Backend) (map[string]*lock.Remote, []error) {
+	locks := make(map[string]*lock.Remote, len(stores))
+	if !cfg.Lock.Remote {
+		return locks, nil
+	}
+	var errs []error
+	for name, store := range stores {
+		l, err := lock.AcquireRemote(ctx, store, cfg.Lock.TTL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("destination %s skipped: %w", name, err))
+			closeStorage(store)
+			delete(stores, name)
+			continue
+		}
+		locks[name] = l
+	}
+	return locks, errs
+}
+
+// lostLocks reports the remote locks that expired during the run because they could not be
+// refreshed, so another host may have written to those destinations meanwhile.
+func lostLocks(locks map[string]*lock.Remote) []error {
+	var errs []error
+	for name, l := range locks {
+		if err := l.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("destination %s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+func unlockDestinations(ctx context.Context, locks map[string]*lock.Remote) {
+	for name, l := range locks {
+		if err := l.Release(ctx); err != nil {
+			logging.FromContext(ctx).Warn("Failed to release lock", "destination", name, "error", err)
+		}
+	}
+}
+
+func unlockCmd() *cobra.Command {
+	var destName string
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Remove expired remote locks, or any remote lock with --force",
+		Run: func(_ *cobra.Command, _ []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+
+			owner, err := lock.InspectLocal(localLockPath(cfg))
+			switch {
+			case err != nil:
+				slog.Warn("Failed to check the local lock", "error", err)
+			case owner != nil && force:
+				fatal("A run is in progress on this host, refusing to force-remove its locks", "owner", owner.String())
+			case owner != nil:
+				slog.Warn("A run is in progress on this host", "owner", owner.String())
+			}
+
+			ctx := context.Background()
+			failed := false
+			for _, d := range cfg.Destinations {
+				if destName != "" && d.Name != destName {
+					continue
+				}
+				if err := unlockDestination(ctx, cfg, d.Name, force); err != nil {
+					slog.Error("Failed to unlock destination", "destination", d.Name, "error", err)
+					failed = true
+				}
+			}
+			if failed {
+				fatal("Some locks were not removed")
+			}
+		},
+	}
+	cmd.Flags().StringVar(&destName, "destination", "", "destination to unlock (default is all of them)")
+	cmd.Flags().BoolVar(&force, "force", false, "remove locks even if they have not expired")
+	return cmd
+}
+
+// unlockDestination removes the remote lock of a destination if it expired or force is set.
+func unlockDestination(ctx context.Context, cfg *config.Config, name string, force bool) error {
+	store, err := openDestination(ctx, cfg, name)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(store)
+
+	owner, _, err := lock.Inspect(ctx, store)
+	if err != nil && !force {
+		return fmt.Errorf("%w, use --force to remove it", err)
+	}
+	if err == nil && owner == nil {
+		slog.Info("Destination is not locked", "destination", name)
+		return nil
+	}
+	if owner != nil && !force && !owner.Expired(time.Now()) {
+		return fmt.Errorf("locked by %s, use --force to remove the lock", owner.String())
+	}
+
+	owner, err = lock.ForceRelease(ctx, store)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		slog.Info("Removed lock", "destination", name, "owner", owner.String())
+	} else {
+		slog.Info("Removed unreadable lock", "destination", name)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/localfs"
+	"github.com/mikhail-angelov/backup-service/internal/lock"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+func TestLockDestinationsSkipsLockedOnes(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.Lock.Remote = true
+	cfg.Lock.TTL = time.Hour
+
+	shared, err := localfs.NewClient(localfs.Options{Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := localfs.NewClient(localfs.Options{Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := lock.AcquireRemote(ctx, shared, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = other.Release(ctx) }()
+
+	stores := map[string]storage.Backend{"shared": shared, "private": private}
+	locks, errs := lockDestinations(ctx, cfg, stores)
+	if len(errs) != 1 || !errors.Is(errs[0], lock.ErrLocked) {
+		t.Fatalf("expected shared destination to be reported as locked, got %v", errs)
+	}
+	if _, ok := stores["shared"]; ok {
+		t.Error("expected locked destination to be left out")
+	}
+	if _, ok := locks["private"]; !ok {
+		t.Fatal("expected private destination to be locked")
+	}
+
+	unlockDestinations(ctx, locks)
+	if owner, _, _ := lock.Inspect(ctx, private); owner != nil {
+		t.Errorf("expected lock to be released, held by %s", owner.String())
+	}
+}
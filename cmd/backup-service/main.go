@@ -4,80 +4,130 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-
-	"strings"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/mikhail-angelov/backup-service/internal/backup"
 	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/lock"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/report"
 	"github.com/mikhail-angelov/backup-service/internal/retention"
-	"github.com/mikhail-angelov/backup-service/internal/s3"
-	"github.com/mikhail-angelov/backup-service/internal/telegram"
+	"github.com/mikhail-angelov/backup-service/internal/state"
+	"github.com/mikhail-angelov/backup-service/internal/tracing"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var cfgFile string
+var (
+	cfgFile string
+	// logOpts holds the logging flags, applied by logging.Setup before every command.
+	logOpts logging.Options
+)
 
 func main() {
-	var rootCmd = &cobra.Command{Use: "backup-service"}
+	var logMaxSizeMB int64
+	var logCloser io.Closer
+	var rootCmd = &cobra.Command{
+		Use: "backup-service",
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			logOpts.MaxSize = logMaxSizeMB << 20
+			var err error
+			_, logCloser, err = logging.Setup(logOpts)
+			return err
+		},
+	}
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "config.yaml", "config file (default is config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&logOpts.Format, "log-format", "text", "log format: text or json")
+	rootCmd.PersistentFlags().StringVar(&logOpts.Level, "log-level", "info", "minimum log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logOpts.File, "log-file", "", "write logs to this file instead of stderr, rotating it by size")
+	rootCmd.PersistentFlags().Int64Var(&logMaxSizeMB, "log-max-size", logging.DefaultMaxSize>>20, "size in MB at which the log file is rotated")
+	rootCmd.PersistentFlags().IntVar(&logOpts.MaxFiles, "log-max-files", logging.DefaultMaxFiles, "rotated log files to keep")
 
 	rootCmd.AddCommand(backupCmd())
 	rootCmd.AddCommand(listCmd())
 	rootCmd.AddCommand(restoreCmd())
-
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd.AddCommand(syncCmd())
+	rootCmd.AddCommand(gcCmd())
+	rootCmd.AddCommand(daemonCmd())
+	rootCmd.AddCommand(unlockCmd())
+	rootCmd.AddCommand(verifyCmd())
+	rootCmd.AddCommand(checkCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(statusCmd())
+
+	err := rootCmd.Execute()
+	if logCloser != nil {
+		_ = logCloser.Close()
+	}
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// fatal logs an error that ends a command and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// fatalContext is fatal logging through the logger of ctx, so that the line carries its run ID.
+func fatalContext(ctx context.Context, msg string, args ...any) {
+	logging.FromContext(ctx).Error(msg, args...)
+	os.Exit(1)
+}
+
 func backupCmd() *cobra.Command {
 	var full bool
+	var sets []string
 	cmd := &cobra.Command{
 		Use:   "backup",
 		Short: "Perform an immediate backup and rotate old ones",
 		Run: func(_ *cobra.Command, _ []string) {
 			cfg, err := config.LoadConfig(cfgFile)
 			if err != nil {
-				log.Fatalf("failed to load config: %v", err)
+				fatal("Failed to load config", "error", err)
 			}
 
-			log.Println("Starting backup process...")
-			if err := executeBackup(cfg, full); err != nil {
-				log.Fatalf("Backup failed: %v", err)
+			ctx := context.Background()
+			stopTracing := setupTracing(ctx, cfg)
+			slog.Info("Starting backup process")
+			_, err = executeBackup(ctx, cfg, full, sets)
+			stopTracing()
+			if err != nil {
+				fatal("Backup failed", "error", err)
 			}
-			log.Println("Backup process completed successfully")
+			slog.Info("Backup process completed successfully")
 		},
 	}
 	cmd.Flags().BoolVar(&full, "full", false, "Force a full backup")
+	cmd.Flags().StringSliceVar(&sets, "set", nil, "only back up these sets (default all)")
 	return cmd
 }
 
 func listCmd() *cobra.Command {
-	return &cobra.Command{
+	var destName, setName string
+	cmd := &cobra.Command{
 		Use:   "list",
-		Short: "List backups in S3",
+		Short: "List backups in storage",
 		Run: func(_ *cobra.Command, _ []string) {
 			cfg, err := config.LoadConfig(cfgFile)
 			if err != nil {
-				log.Fatalf("failed to load config: %v", err)
+				fatal("Failed to load config", "error", err)
 			}
 
-			ctx := context.Background()
-			s3Client, err := s3.NewClient(ctx, cfg.S3.Bucket, cfg.S3.Region, cfg.S3.Endpoint, cfg.S3.AccessKeyID, cfg.S3.SecretAccessKey, cfg.S3.Prefix)
+			backups, err := listBackups(context.Background(), cfg, destName, setName)
 			if err != nil {
-				log.Fatalf("failed to create S3 client: %v", err)
-			}
-
-			backups, err := s3Client.ListBackups(ctx)
-			if err != nil {
-				log.Fatalf("failed to list backups: %v", err)
+				fatal("Failed to list backups", "error", err)
 			}
 
 			fmt.Println("Available backups:")
@@ -86,198 +136,200 @@ func listCmd() *cobra.Command {
 			}
 		},
 	}
+	cmd.Flags().StringVar(&destName, "destination", "", "destination to list (default is the first configured one)")
+	cmd.Flags().StringVar(&setName, "set", "", "only list archives of this backup set")
+	return cmd
 }
 
-func restoreCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "restore [backup-key] [target-dir]",
-		Short: "Restore a backup from S3 (applies Full + all Incrementals up to the key)",
-		Args:  cobra.ExactArgs(2),
-		Run: func(_ *cobra.Command, args []string) {
-			key := args[0]
-			targetDir := args[1]
-
-			cfg, err := config.LoadConfig(cfgFile)
-			if err != nil {
-				log.Fatalf("failed to load config: %v", err)
-			}
-
-			ctx := context.Background()
-			s3Client, err := s3.NewClient(ctx, cfg.S3.Bucket, cfg.S3.Region, cfg.S3.Endpoint, cfg.S3.AccessKeyID, cfg.S3.SecretAccessKey, cfg.S3.Prefix)
-			if err != nil {
-				log.Fatalf("failed to create S3 client: %v", err)
-			}
-
-			allBackups, err := s3Client.ListBackups(ctx)
-			if err != nil {
-				log.Fatalf("failed to list backups: %v", err)
-			}
-
-			name, targetTs := getBackupNameAndTimestamp(key)
-			if name == "" || targetTs == "" {
-				log.Fatalf("failed to parse backup key: %s", key)
-			}
-
-			var chain []string
-			var lastFull string
-			for _, b := range allBackups {
-				bName, bTs := getBackupNameAndTimestamp(b)
-				if bName != name || bTs > targetTs {
-					continue
-				}
-				if strings.Contains(b, ".full.") {
-					lastFull = b
-					chain = []string{b} // Start new chain from this full backup
-				} else if lastFull != "" {
-					chain = append(chain, b)
-				}
-			}
-
-			if len(chain) == 0 {
-				log.Fatalf("could not find a valid backup chain for %s", key)
-			}
-
-			// Ensure the chain ends at target key (handles cases where later backups exist)
-			finalChain := []string{}
-			for _, b := range chain {
-				finalChain = append(finalChain, b)
-				if b == key {
-					break
-				}
-			}
-			chain = finalChain
-
-			log.Printf("Found backup chain of %d files to restore", len(chain))
-			engine := backup.NewEngine(os.TempDir())
-
-			for i, chainKey := range chain {
-				log.Printf("[%d/%d] Restoring %s...", i+1, len(chain), chainKey)
-				tempPath := filepath.Join(os.TempDir(), filepath.Base(chainKey))
-				if err := s3Client.DownloadFile(ctx, chainKey, tempPath); err != nil {
-					log.Fatalf("failed to download %s: %v", chainKey, err)
-				}
-
-				extractPath := tempPath
-				if filepath.Ext(tempPath) == ".gpg" {
-					decryptedPath, err := engine.Decrypt(tempPath, cfg.Encryption.Passphrase)
-					if err != nil {
-						log.Fatalf("failed to decrypt %s: %v", tempPath, err)
-					}
-					_ = os.Remove(tempPath)
-					extractPath = decryptedPath
-				}
-
-				untarCmd := exec.Command("tar", "-xzf", extractPath, "-C", targetDir) // #nosec G204
-				if output, err := untarCmd.CombinedOutput(); err != nil {
-					log.Fatalf("failed to extract: %v, output: %s", err, string(output))
-				}
-				_ = os.Remove(extractPath)
-			}
+// listBackups returns the archives in a destination, the first configured one when destName is empty,
+// oldest first. A non-empty setName limits them to that backup set.
+func listBackups(ctx context.Context, cfg *config.Config, destName, setName string) ([]string, error) {
+	if destName == "" {
+		destName = cfg.Destinations[0].Name
+	}
+	store, err := openDestination(ctx, cfg, destName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	defer closeStorage(store)
 
-			log.Println("Restore completed successfully")
-		},
+	keys, err := listWithRetry(ctx, cfg, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
 	}
+	backups := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if filepath.Base(k) == lock.ObjectName {
+			continue
+		}
+		if name, _ := getBackupNameAndTimestamp(k); setName != "" && name != setName {
+			continue
+		}
+		backups = append(backups, k)
+	}
+	sortByTimestamp(backups)
+	return backups, nil
+}
+
+// sortByTimestamp orders archive keys by the time they were created.
+func sortByTimestamp(keys []string) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		_, ti := getBackupNameAndTimestamp(keys[i])
+		_, tj := getBackupNameAndTimestamp(keys[j])
+		return ti < tj
+	})
 }
 
 func getBackupNameAndTimestamp(key string) (name, timestamp string) {
-	base := filepath.Base(key)
-	parts := strings.Split(base, "_")
-	if len(parts) < 2 {
-		return "", ""
-	}
-	name = parts[0]
-	rest := parts[1]
-	tsParts := strings.Split(rest, ".")
-	timestamp = tsParts[0]
+	name, timestamp, _ = backup.ParseArchiveName(key)
 	return
 }
 
-func executeBackup(cfg *config.Config, forceFull bool) error {
-	ctx := context.Background()
+// lastReportFile keeps the report of the latest backup run in the state directory.
+const lastReportFile = "last-report.json"
+
+// executeBackup backs up the given sets, or all of them when sets is empty, rotates old archives and
+// sends the run report. The report is returned even when the run failed.
+func executeBackup(ctx context.Context, cfg *config.Config, forceFull bool, sets []string) (rep *report.Report, err error) {
+	for _, name := range sets {
+		if _, ok := cfg.BackupSet(name); !ok {
+			return nil, fmt.Errorf("unknown backup set %q", name)
+		}
+	}
+	start := time.Now()
+	runID := logging.NewRunID()
+	ctx, logger := logging.With(ctx, "run_id", runID)
+	ctx, span := tracing.Start(ctx, "backup.run", attribute.String("run_id", runID), attribute.StringSlice("sets", sets))
+	defer func() {
+		if rep != nil {
+			span.SetAttributes(attribute.String("status", rep.Status()))
+		}
+		tracing.End(span, err)
+	}()
 	engine := backup.NewEngine(os.TempDir())
-	s3Client, err := s3.NewClient(ctx, cfg.S3.Bucket, cfg.S3.Region, cfg.S3.Endpoint, cfg.S3.AccessKeyID, cfg.S3.SecretAccessKey, cfg.S3.Prefix)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+	engine.Priority = backup.Priority{
+		Nice:    cfg.Resources.Nice,
+		IOClass: cfg.Resources.IOClass,
+		IOLevel: cfg.Resources.IOLevel,
+	}
+	if cfg.Resources.IOLimit > 0 {
+		engine.IOLimit = ratelimit.New(int64(cfg.Resources.IOLimit))
 	}
 
-	existingBackups, err := s3Client.ListBackups(ctx)
+	localLock, err := lock.AcquireLocal(localLockPath(cfg))
 	if err != nil {
-		log.Printf("Warning: failed to list existing backups, will assume no full backup exists: %v", err)
+		return nil, fmt.Errorf("another backup is running: %w", err)
 	}
+	defer func() { _ = localLock.Release() }()
 
-	retentionManager := retention.NewManager(s3Client, cfg.Retention.Daily, cfg.Retention.Monthly)
-	tgClient := telegram.NewClient(cfg.Telegram.BotToken, cfg.Telegram.ChatID)
-
-	var errs []error
-	for _, b := range cfg.Backups {
-		isFull := forceFull
-		if !isFull {
-			currentMonth := time.Now().Format("200601")
-			foundFullThisMonth := false
-			for _, key := range existingBackups {
-				if strings.Contains(key, "/"+b.Name+"_") && strings.Contains(key, ".full.") && strings.Contains(key, "_"+currentMonth) {
-					foundFullThisMonth = true
-					break
-				}
-			}
-			if !foundFullThisMonth {
-				log.Printf("No full backup found for %s in %s, forcing full backup", b.Name, currentMonth)
-				isFull = true
-			}
-		}
+	stores, openErrs := openDestinations(ctx, cfg)
+	defer closeDestinations(stores)
+	errs := openErrs
 
-		log.Printf("Backing up %s (%s)...", b.Name, map[bool]string{true: "FULL", false: "INCREMENTAL"}[isFull])
-		snapshotFile := filepath.Join(os.TempDir(), fmt.Sprintf("%s.snar", b.Name))
-		archivePath, backupType, err := engine.CreateArchive(b.Name, b.Folders, b.Exclude, snapshotFile, isFull)
+	remoteLocks, lockErrs := lockDestinations(ctx, cfg, stores)
+	defer unlockDestinations(context.Background(), remoteLocks)
+	errs = append(errs, lockErrs...)
+
+	// Archives that some destinations missed last time go out first, so that the full/incremental
+	// decision below sees them.
+	errs = append(errs, resumePendingUploads(ctx, cfg, stores)...)
+
+	hostname, _ := os.Hostname()
+	rep = &report.Report{RunID: runID, Hostname: hostname, Started: start}
+	for _, err := range errs {
+		rep.Errors = append(rep.Errors, err.Error())
+	}
+
+	existingBackups := make(map[string][]string, len(stores))
+	for name, store := range stores {
+		keys, err := listWithRetry(ctx, cfg, store)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("backup %s failed: %w", b.Name, err))
-			continue
+			logger.Warn("Failed to list existing backups, will assume no full backup exists", "destination", name, "error", err)
 		}
+		existingBackups[name] = keys
+	}
 
-		uploadPath := archivePath
-		if cfg.Encryption.Enabled {
-			log.Printf("Encrypting %s...", archivePath)
-			encryptedPath, err := engine.Encrypt(archivePath, cfg.Encryption.Passphrase)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("encryption of %s failed: %w", b.Name, err))
-				_ = os.Remove(archivePath)
-				continue
-			}
-			_ = os.Remove(archivePath)
-			uploadPath = encryptedPath
+	var mu sync.Mutex
+	var results []report.Set
+	forEachSet(cfg, func(b *config.BackupSet) {
+		if len(sets) > 0 && !slices.Contains(sets, b.Name) {
+			return
 		}
+		res := backupSet(ctx, cfg, engine, stores, existingBackups, b, forceFull)
+		mu.Lock()
+		errs = append(errs, res.Errors...)
+		results = append(results, res.Report)
+		mu.Unlock()
+	})
+	// Report sets in configuration order rather than completion order.
+	order := make(map[string]int, len(cfg.Backups))
+	for i, b := range cfg.Backups {
+		order[b.Name] = i
+	}
+	sort.SliceStable(results, func(i, j int) bool { return order[results[i].Name] < order[results[j].Name] })
+	rep.Sets = results
 
-		log.Printf("Uploading %s to S3...", uploadPath)
-		if err := s3Client.UploadFile(ctx, uploadPath); err != nil {
-			errs = append(errs, fmt.Errorf("upload %s failed: %w", b.Name, err))
-			_ = os.Remove(uploadPath)
+	for _, d := range cfg.Destinations {
+		store, ok := stores[d.Name]
+		if !ok {
 			continue
 		}
-
-		_ = os.Remove(uploadPath)
-		log.Printf("Backup %s (%s) completed", b.Name, backupType)
+		logger.Info("Running retention rotation", "destination", d.Name)
+		rotateCtx, span := tracing.Start(ctx, "backup.rotate", attribute.String("destination", d.Name))
+		deleted, err := retention.NewManager(store, cfg.Retention.Daily, cfg.Retention.Monthly).Rotate(rotateCtx)
+		span.SetAttributes(attribute.Int("deleted", len(deleted)))
+		tracing.End(span, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("retention in %s failed: %w", d.Name, err))
+			rep.Errors = append(rep.Errors, errs[len(errs)-1].Error())
+		}
+		if len(deleted) > 0 {
+			rep.Rotations = append(rep.Rotations, report.Rotation{Destination: d.Name, Deleted: deleted})
+		}
 	}
 
-	log.Println("Running retention rotation...")
-	if err := retentionManager.Rotate(ctx); err != nil {
-		errs = append(errs, fmt.Errorf("retention failed: %w", err))
+	for _, err := range lostLocks(remoteLocks) {
+		logger.Error("Remote lock was lost during the run", "error", err)
+		errs = append(errs, err)
+		rep.Errors = append(rep.Errors, err.Error())
 	}
 
-	if cfg.Telegram.Enabled {
-		if len(errs) > 0 {
-			msg := "❌ Backup Failed:\n"
-			for _, e := range errs {
-				msg += fmt.Sprintf("- %v\n", e)
-			}
-			_ = tgClient.SendMessage(msg)
-		} else {
-			_ = tgClient.SendMessage("✅ Backup completed successfully")
-		}
+	rep.Finished = time.Now()
+	if err := saveLastReport(cfg, rep); err != nil {
+		logger.Warn("Failed to save the run report", "error", err)
+	}
+	if err := recordHistory(cfg, rep); err != nil {
+		logger.Warn("Failed to record the run in the history", "error", err)
 	}
+	if err := recordMetrics(cfg, rep); err != nil {
+		logger.Warn("Failed to update metrics", "error", err)
+	}
+	notifyAll(ctx, cfg, rep)
 
 	if len(errs) > 0 {
-		return fmt.Errorf("completed with errors: %v", errs)
+		return rep, fmt.Errorf("completed with errors: %v", errs)
+	}
+
+	return rep, nil
+}
+
+func saveLastReport(cfg *config.Config, rep *report.Report) error {
+	store, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		return err
 	}
+	return store.Save(lastReportFile, rep)
+}
 
-	return nil
+// loadLastReport returns the report of the latest backup run, or nil when there was none yet.
+func loadLastReport(cfg *config.Config) (*report.Report, error) {
+	store, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		return nil, err
+	}
+	var rep *report.Report
+	if err := store.Load(lastReportFile, &rep); err != nil {
+		return nil, err
+	}
+	return rep, nil
 }
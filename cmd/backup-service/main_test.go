@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+)
+
+// newTestConfig returns a configuration backing up a "docs" set holding one file to a local
+// destination, trying each operation once and keeping enough archives for several runs.
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StateDir:     t.TempDir(),
+		Destinations: []config.Destination{{Name: "local", Type: "local", Local: config.LocalConfig{Path: t.TempDir(), Prefix: "srv1"}}},
+		Backups:      []config.BackupSet{{Name: "docs", Type: "files", Folders: []string{src}}},
+	}
+	cfg.Retry.Attempts = 1
+	cfg.Retention.Daily, cfg.Retention.Monthly = 10, 1
+	return cfg
+}
+
+func TestForEachSetPriorityAndWorkers(t *testing.T) {
+	cfg := &config.Config{
+		Workers: 2,
+		Backups: []config.BackupSet{
+			{Name: "logs"},
+			{Name: "db", Priority: 10},
+			{Name: "www", Priority: 5},
+			{Name: "misc"},
+		},
+	}
+
+	var (
+		mu            sync.Mutex
+		started       []string
+		running, peak int
+	)
+	forEachSet(cfg, func(b *config.BackupSet) {
+		mu.Lock()
+		started = append(started, b.Name)
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	if len(started) != 4 {
+		t.Fatalf("expected all sets to run, got %v", started)
+	}
+	if first := fmt.Sprint(started[:2]); first != "[db www]" && first != "[www db]" {
+		t.Errorf("expected prioritized sets to start first, got %v", started)
+	}
+	if peak != 2 {
+		t.Errorf("expected 2 sets to run in parallel, got %d", peak)
+	}
+}
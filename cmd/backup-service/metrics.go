@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/metrics"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/mikhail-angelov/backup-service/internal/state"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func loadMetrics(cfg *config.Config) (*metrics.State, error) {
+	store, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		return nil, err
+	}
+	var s metrics.State
+	if err := store.Load(metrics.StateFile, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// recordMetrics adds a run to the metrics state and rewrites the textfile, if configured. Runs hold
+// the backup lock, so updates do not interleave.
+func recordMetrics(cfg *config.Config, rep *report.Report) error {
+	s, err := loadMetrics(cfg)
+	if err != nil {
+		return err
+	}
+	s.Record(rep)
+	store, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		return err
+	}
+	if err := store.Save(metrics.StateFile, s); err != nil {
+		return err
+	}
+	if cfg.Metrics.Textfile == "" {
+		return nil
+	}
+	return metrics.WriteTextfile(cfg.Metrics.Textfile, metricsRegistry(cfg))
+}
+
+func metricsRegistry(cfg *config.Config) *prometheus.Registry {
+	return metrics.NewRegistry(func() (*metrics.State, error) { return loadMetrics(cfg) })
+}
+
+// serveMetrics serves /metrics on cfg.Metrics.Listen until ctx is done.
+func serveMetrics(ctx context.Context, cfg *config.Config) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(metricsRegistry(cfg)))
+	srv := &http.Server{Addr: cfg.Metrics.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	slog.Info("Serving metrics", "address", cfg.Metrics.Listen, "path", "/metrics")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+)
+
+func TestExecuteBackupMetricsTextfile(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "backup_service.prom")
+	cfg := newTestConfig(t)
+	cfg.Metrics = config.MetricsConfig{Textfile: textfile}
+
+	for range 2 {
+		if _, err := executeBackup(context.Background(), cfg, false, nil); err != nil {
+			t.Fatalf("backup failed: %v", err)
+		}
+	}
+	data, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`backup_service_chain_length{set="docs"} 2`,
+		`backup_service_runs_total{status="success"} 2`,
+		`backup_service_last_success_timestamp_seconds{set="docs"}`,
+		`backup_service_upload_throughput_bytes_per_second{destination="local",set="docs"}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("textfile lacks %s:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/notify"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/mikhail-angelov/backup-service/internal/telegram"
+)
+
+// newNotifier creates the notifier of a notification channel.
+func newNotifier(ch config.NotificationChannel) (notify.Notifier, error) {
+	switch ch.Type {
+	case "telegram":
+		return &notify.Telegram{Client: telegram.NewClient(ch.Telegram.BotToken, ch.Telegram.ChatID)}, nil
+	case "slack":
+		return &notify.Slack{WebhookURL: ch.Slack.WebhookURL}, nil
+	case "email":
+		e := ch.Email
+		return &notify.Email{Host: e.Host, Port: e.Port, Username: e.Username, Password: e.Password, From: e.From, To: e.To, TLS: e.TLS}, nil
+	case "webhook":
+		w := ch.Webhook
+		return notify.NewWebhook(w.URL, w.Method, w.Headers, w.Template, w.Secret)
+	case "ntfy":
+		return &notify.Ntfy{URL: ch.Ntfy.URL, Topic: ch.Ntfy.Topic, Token: ch.Ntfy.Token, Priority: ch.Ntfy.Priority}, nil
+	case "gotify":
+		return &notify.Gotify{URL: ch.Gotify.URL, Token: ch.Gotify.Token, Priority: ch.Gotify.Priority}, nil
+	default:
+		return nil, fmt.Errorf("unsupported notification type: %s", ch.Type)
+	}
+}
+
+// channelFormat returns the report format a channel displays.
+func channelFormat(ch config.NotificationChannel) string {
+	switch ch.Type {
+	case "telegram":
+		switch ch.Telegram.ParseMode {
+		case "MarkdownV2":
+			return report.FormatMarkdownV2
+		case "none":
+			return report.FormatText
+		}
+		return report.FormatHTML
+	case "slack":
+		return report.FormatSlack
+	}
+	return report.FormatText
+}
+
+// reportMessage renders the run report for a channel, with its own template if it has one. A broken
+// template falls back to the default one, so that the notification still goes out.
+func reportMessage(ch config.NotificationChannel, rep *report.Report) notify.Message {
+	format := channelFormat(ch)
+	msg := notify.Message{Subject: rep.Subject(), Format: format, Report: rep}
+	tmpl, err := report.Template(format, ch.Template)
+	if err == nil {
+		msg.Body, err = report.Render(tmpl, rep)
+	}
+	if err != nil {
+		slog.Warn("Notification template failed, using the default one", "channel", ch.Name, "error", err)
+		tmpl, _ = report.Template(format, "")
+		msg.Body, _ = report.Render(tmpl, rep)
+	}
+	return msg
+}
+
+// notifyAll sends the run report to every channel accepting its severity, or adds it to the
+// channel's digest, then sends the digests that are due. Failures are logged but do not fail the run.
+func notifyAll(ctx context.Context, cfg *config.Config, rep *report.Report) {
+	status := rep.Status()
+	for _, ch := range cfg.Notifications {
+		if !ch.Accepts(status) {
+			continue
+		}
+		var err error
+		if ch.Digest.Schedule != "" {
+			err = queueDigest(cfg, ch, rep)
+		} else {
+			var n notify.Notifier
+			if n, err = newNotifier(ch); err == nil {
+				err = n.Notify(ctx, reportMessage(ch, rep))
+			}
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn("Notification failed", "channel", ch.Name, "error", err)
+		}
+	}
+	flushDigests(ctx, cfg, time.Now())
+}
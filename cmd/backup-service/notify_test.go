@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/report"
+)
+
+func TestReportMessage(t *testing.T) {
+	rep := &report.Report{Hostname: "srv1", Sets: []report.Set{{Name: "db", Type: "postgres", Errors: []string{"dump <failed>"}}}}
+
+	ch := config.NotificationChannel{Name: "tg", Type: "telegram", Telegram: config.TelegramConfig{ParseMode: "HTML"}}
+	msg := reportMessage(ch, rep)
+	if msg.Subject != "❌ Backup Failed" || msg.Format != report.FormatHTML || !strings.Contains(msg.Body, "✗ dump &lt;failed&gt;") {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	ch = config.NotificationChannel{Name: "mail", Type: "email", Template: "{{range .Sets}}{{.Name}}={{.Status}}{{end}}"}
+	if msg := reportMessage(ch, rep); msg.Body != "db=failure" || msg.Format != report.FormatText {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	ch.Template = "{{.Nope}}"
+	if msg := reportMessage(ch, rep); !strings.Contains(msg.Body, "✗ dump <failed>") {
+		t.Errorf("expected the default template after a failing one, got %q", msg.Body)
+	}
+}
+
+func TestNotifyAllSeveritiesAndDigest(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Text string }
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], payload.Text)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{
+		StateDir: t.TempDir(),
+		Notifications: []config.NotificationChannel{
+			{Name: "alerts", Type: "slack", Severities: []string{"warning", "failure"}, Slack: config.SlackConfig{WebhookURL: srv.URL + "/alerts"}},
+			{Name: "daily", Type: "slack", Digest: config.DigestConfig{Schedule: "0 8 * * *"}, Slack: config.SlackConfig{WebhookURL: srv.URL + "/daily"}},
+		},
+	}
+	ok := &report.Report{Hostname: "srv1", Started: time.Now().Add(-time.Hour), Sets: []report.Set{{Name: "docs"}}}
+	failed := &report.Report{Hostname: "srv1", Started: time.Now().Add(-time.Minute), Sets: []report.Set{{Name: "db", Errors: []string{"dump failed"}}}}
+
+	ctx := context.Background()
+	notifyAll(ctx, cfg, ok)
+	notifyAll(ctx, cfg, failed)
+	if got := received["/alerts"]; len(got) != 1 || !strings.Contains(got[0], "dump failed") {
+		t.Fatalf("expected only the failed run on the filtered channel, got %q", got)
+	}
+	if got := received["/daily"]; len(got) != 0 {
+		t.Fatalf("digest sent before its schedule: %q", got)
+	}
+
+	flushDigests(ctx, cfg, time.Now().Add(25*time.Hour))
+	got := received["/daily"]
+	if len(got) != 1 || !strings.Contains(got[0], "2 run(s), 1 failed") || !strings.Contains(got[0], "dump failed") {
+		t.Fatalf("unexpected digest %q", got)
+	}
+
+	// The digest was emptied: the next period sends nothing.
+	flushDigests(ctx, cfg, time.Now().Add(50*time.Hour))
+	if got := received["/daily"]; len(got) != 1 {
+		t.Errorf("expected no digest for an empty period, got %q", got)
+	}
+}
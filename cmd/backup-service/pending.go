@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/state"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// pendingUploadsFile lists archives kept in the spool directory because some destinations
+// failed to receive them. They are uploaded again at the start of the next backup run.
+const pendingUploadsFile = "pending-uploads.json"
+
+// pendingMu serialises updates of the pending uploads file by backup sets running in parallel.
+var pendingMu sync.Mutex
+
+type pendingUpload struct {
+	File         string    `json:"file"`
+	Destinations []string  `json:"destinations"`
+	Since        time.Time `json:"since"`
+}
+
+func spoolDir(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "spool")
+}
+
+// spoolUpload keeps a copy of filePath in the spool directory and records the destinations
+// that still need it.
+func spoolUpload(ctx context.Context, cfg *config.Config, filePath string, destinations []string) error {
+	st, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(spoolDir(cfg), 0o750); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	spooled := filepath.Join(spoolDir(cfg), filepath.Base(filePath))
+	if err := moveFile(filePath, spooled); err != nil {
+		return err
+	}
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	var pending []pendingUpload
+	if err := st.Load(pendingUploadsFile, &pending); err != nil {
+		return err
+	}
+	pending = append(pending, pendingUpload{File: spooled, Destinations: destinations, Since: time.Now()})
+	if err := st.Save(pendingUploadsFile, pending); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Warn("Kept archive for a later upload", "path", spooled, "destinations", strings.Join(destinations, ","))
+	return nil
+}
+
+// resumePendingUploads uploads spooled archives to the destinations that missed them. Multipart
+// uploads interrupted in a previous run continue where they stopped.
+func resumePendingUploads(ctx context.Context, cfg *config.Config, stores map[string]storage.Backend) []error {
+	st, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		return []error{err}
+	}
+	var pending []pendingUpload
+	if err := st.Load(pendingUploadsFile, &pending); err != nil {
+		return []error{err}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var errs []error
+	remaining := pending[:0]
+	for _, p := range pending {
+		if _, err := os.Stat(p.File); err != nil {
+			errs = append(errs, fmt.Errorf("spooled archive %s is gone, dropping it: %w", p.File, err))
+			continue
+		}
+		targets := availableDestinations(p.Destinations, stores)
+		var failed []string
+		if len(targets) > 0 {
+			logging.FromContext(ctx).Info("Resuming upload", "key", filepath.Base(p.File), "destinations", strings.Join(targets, ","))
+		}
+		for _, res := range uploadToDestinations(ctx, cfg, stores, targets, p.File) {
+			if res.err != nil {
+				errs = append(errs, fmt.Errorf("resumed upload of %s to %s failed: %w", filepath.Base(p.File), res.name, res.err))
+				failed = append(failed, res.name)
+			}
+		}
+		for _, name := range p.Destinations {
+			if !slices.Contains(targets, name) {
+				failed = append(failed, name)
+			}
+		}
+		if len(failed) == 0 {
+			_ = os.Remove(p.File)
+			continue
+		}
+		p.Destinations = failed
+		remaining = append(remaining, p)
+	}
+
+	if len(remaining) == 0 {
+		if err := st.Remove(pendingUploadsFile); err != nil {
+			errs = append(errs, err)
+		}
+	} else if err := st.Save(pendingUploadsFile, remaining); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// moveFile renames src to dst, copying across filesystems. The modification time is kept so that
+// resumable uploads recognise the file.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+	in, err := os.Open(src) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to keep modification time of %s: %w", dst, err)
+	}
+	_ = os.Remove(src)
+	return nil
+}
+
+func gcCmd() *cobra.Command {
+	var destName string
+	var olderThan time.Duration
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Abort abandoned multipart uploads left behind by interrupted backups",
+		Run: func(_ *cobra.Command, _ []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+
+			ctx := context.Background()
+			var errs []error
+			for _, d := range cfg.Destinations {
+				if destName != "" && d.Name != destName {
+					continue
+				}
+				aborted, err := collectGarbage(ctx, cfg, d.Name, olderThan)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				for _, key := range aborted {
+					slog.Info("Aborted incomplete upload", "key", key, "destination", d.Name)
+				}
+			}
+			if len(errs) > 0 {
+				fatal("gc completed with errors", "error", errors.Join(errs...))
+			}
+			slog.Info("gc completed")
+		},
+	}
+	cmd.Flags().StringVar(&destName, "destination", "", "destination to clean up (default is all of them)")
+	cmd.Flags().DurationVar(&olderThan, "older-than", 24*time.Hour, "only abort uploads started longer ago than this")
+	return cmd
+}
+
+// collectGarbage aborts stale incomplete uploads in a destination that supports it.
+func collectGarbage(ctx context.Context, cfg *config.Config, name string, olderThan time.Duration) ([]string, error) {
+	store, err := openDestination(ctx, cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	defer closeStorage(store)
+	gc, ok := store.(storage.GarbageCollector)
+	if !ok {
+		return nil, nil
+	}
+	aborted, err := gc.AbortStaleUploads(ctx, olderThan)
+	if err != nil {
+		return aborted, fmt.Errorf("gc in %s failed: %w", name, err)
+	}
+	return aborted, nil
+}
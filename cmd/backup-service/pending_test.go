@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/state"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+// flakyStore records uploaded files and fails Put while down is set.
+type flakyStore struct {
+	storage.Backend
+	down     bool
+	uploaded []string
+}
+
+func (f *flakyStore) Put(_ context.Context, filePath string) error {
+	if f.down {
+		return errors.New("connection reset")
+	}
+	f.uploaded = append(f.uploaded, filepath.Base(filePath))
+	return nil
+}
+
+func TestResumePendingUploads(t *testing.T) {
+	cfg := &config.Config{StateDir: t.TempDir()}
+	cfg.Retry.Attempts = 2
+
+	archive := filepath.Join(t.TempDir(), "app_20250101000000.full.tar.gz")
+	if err := os.WriteFile(archive, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := spoolUpload(context.Background(), cfg, archive, []string{"offsite"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("expected archive to be moved into the spool, got %v", err)
+	}
+
+	offsite := &flakyStore{down: true}
+	stores := map[string]storage.Backend{"offsite": offsite}
+	if errs := resumePendingUploads(context.Background(), cfg, stores); len(errs) != 1 {
+		t.Fatalf("expected one error while destination is down, got %v", errs)
+	}
+
+	st, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending []pendingUpload
+	if err := st.Load(pendingUploadsFile, &pending); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Destinations[0] != "offsite" {
+		t.Fatalf("expected upload to stay pending, got %+v", pending)
+	}
+
+	offsite.down = false
+	if errs := resumePendingUploads(context.Background(), cfg, stores); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(offsite.uploaded) != 1 || offsite.uploaded[0] != filepath.Base(archive) {
+		t.Errorf("expected archive to be uploaded, got %v", offsite.uploaded)
+	}
+	if _, err := os.Stat(pending[0].File); !os.IsNotExist(err) {
+		t.Errorf("expected spooled archive to be removed, got %v", err)
+	}
+	if _, err := os.Stat(st.Path(pendingUploadsFile)); !os.IsNotExist(err) {
+		t.Errorf("expected pending uploads state to be removed, got %v", err)
+	}
+}
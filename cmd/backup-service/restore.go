@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/hooks"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/state"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// rehydrationStateFile records restore requests issued for archived objects, so that a later
+// invocation continues waiting for them instead of starting over.
+const rehydrationStateFile = "rehydration.json"
+
+type rehydrateOptions struct {
+	tier         string
+	days         int
+	wait         bool
+	pollInterval time.Duration
+}
+
+type pendingRehydration struct {
+	Tier        string        `json:"tier,omitempty"`
+	RequestedAt time.Time     `json:"requested_at"`
+	Estimate    time.Duration `json:"estimate,omitempty"`
+}
+
+func restoreCmd() *cobra.Command {
+	var destName string
+	var opts rehydrateOptions
+	cmd := &cobra.Command{
+		Use:   "restore [backup-key] [target-dir]",
+		Short: "Restore a backup from storage (applies Full + all Incrementals up to the key, or replays a database dump)",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(_ *cobra.Command, args []string) {
+			key := args[0]
+			targetDir := ""
+			if len(args) > 1 {
+				targetDir = args[1]
+			} else if !isDump(key) {
+				fatal("A target directory is required to restore file backups")
+			}
+
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			ctx, logger := logging.With(ctx, "run_id", logging.NewRunID())
+			store, allBackups, err := findDestination(ctx, cfg, destName, key)
+			if err != nil {
+				fatalContext(ctx, "Failed to find backup", "key", key, "error", err)
+			}
+			defer closeStorage(store)
+
+			chain, err := resolveChain(allBackups, key)
+			if err != nil {
+				fatalContext(ctx, "Failed to resolve backup chain", "key", key, "error", err)
+			}
+			logger.Info("Found backup chain to restore", "key", key, "archives", len(chain))
+
+			if err := rehydrateChain(ctx, cfg, store, chain, opts); err != nil {
+				fatalContext(ctx, "Restore failed", "key", key, "error", err)
+			}
+			if err := restoreWithHooks(ctx, cfg, store, chain, targetDir); err != nil {
+				fatalContext(ctx, "Restore failed", "key", key, "error", err)
+			}
+
+			logger.Info("Restore completed successfully", "key", key)
+		},
+	}
+	cmd.Flags().StringVar(&destName, "from", "", "destination to restore from (default is the first one holding the key)")
+	cmd.Flags().StringVar(&opts.tier, "restore-tier", "Standard", "retrieval tier for archived objects: Expedited, Standard or Bulk")
+	cmd.Flags().IntVar(&opts.days, "restore-days", 3, "days to keep restored copies of archived objects")
+	cmd.Flags().BoolVar(&opts.wait, "wait", true, "wait for archived objects to become available instead of exiting")
+	cmd.Flags().DurationVar(&opts.pollInterval, "poll-interval", 5*time.Minute, "how often to check archived objects while waiting")
+	return cmd
+}
+
+// resolveChain returns the full backup preceding key followed by all incrementals up to and including key.
+// allBackups may be in any order, as some backends list keys unsorted.
+func resolveChain(allBackups []string, key string) ([]string, error) {
+	name, targetTs := getBackupNameAndTimestamp(key)
+	if name == "" || targetTs == "" {
+		return nil, fmt.Errorf("failed to parse backup key: %s", key)
+	}
+	allBackups = slices.Clone(allBackups)
+	sortByTimestamp(allBackups)
+
+	var chain []string
+	var lastFull string
+	for _, b := range allBackups {
+		bName, bTs := getBackupNameAndTimestamp(b)
+		if bName != name || bTs > targetTs {
+			continue
+		}
+		if strings.Contains(b, ".full.") {
+			lastFull = b
+			chain = []string{b} // Start new chain from this full backup
+		} else if lastFull != "" {
+			chain = append(chain, b)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("could not find a valid backup chain for %s", key)
+	}
+
+	// Ensure the chain ends at target key (handles cases where later backups exist)
+	finalChain := []string{}
+	for _, b := range chain {
+		finalChain = append(finalChain, b)
+		if b == key {
+			break
+		}
+	}
+	return finalChain, nil
+}
+
+// restoreWithHooks runs the pre_restore and post_restore hooks of the chain's backup set around restoreChain.
+func restoreWithHooks(ctx context.Context, cfg *config.Config, store storage.Backend, chain []string, targetDir string) error {
+	key := chain[len(chain)-1]
+	name, _, backupType := backup.ParseArchiveName(key)
+	set, ok := cfg.BackupSet(name)
+	if !ok {
+		return restoreChain(ctx, cfg, store, chain, targetDir)
+	}
+
+	runner := &hooks.Runner{Timeout: set.Hooks.Timeout}
+	env := map[string]string{
+		"BACKUP_SET":         name,
+		"BACKUP_TYPE":        backupType,
+		"BACKUP_ARCHIVE":     filepath.Base(key),
+		"BACKUP_RESTORE_DIR": targetDir,
+	}
+	if err := runner.Run(ctx, "pre_restore", set.Hooks.PreRestore, env); err != nil {
+		return fmt.Errorf("restore aborted: %w", err)
+	}
+
+	var errs []error
+	if err := restoreChain(ctx, cfg, store, chain, targetDir); err != nil {
+		errs = append(errs, err)
+	}
+	setStatus(env, errs)
+	if err := runner.Run(context.WithoutCancel(ctx), "post_restore", set.Hooks.PostRestore, env); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// restoreChain downloads, decrypts and extracts every archive of the chain into targetDir in order.
+// Volumes of docker sets are then recreated from the extracted files.
+func restoreChain(ctx context.Context, cfg *config.Config, store storage.Backend, chain []string, targetDir string) error {
+	engine := backup.NewEngine(os.TempDir())
+	for i, chainKey := range chain {
+		logging.FromContext(ctx).Info("Restoring archive", "key", chainKey, "index", i+1, "archives", len(chain))
+		tempPath := filepath.Join(os.TempDir(), filepath.Base(chainKey))
+		if err := withRetry(ctx, cfg, func(ctx context.Context) error { return store.Get(ctx, chainKey, tempPath) }); err != nil {
+			return fmt.Errorf("failed to download %s: %w", chainKey, err)
+		}
+
+		extractPath := tempPath
+		if filepath.Ext(tempPath) == ".gpg" {
+			decryptedPath, err := engine.Decrypt(tempPath, cfg.Encryption.Passphrase)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", tempPath, err)
+			}
+			_ = os.Remove(tempPath)
+			extractPath = decryptedPath
+		}
+
+		if isDump(extractPath) {
+			err := restoreDump(ctx, engine, cfg, extractPath)
+			_ = os.Remove(extractPath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		untarCmd := exec.Command("tar", "-xzf", extractPath, "-C", targetDir) // #nosec G204
+		if output, err := untarCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to extract: %w, output: %s", err, string(output))
+		}
+		_ = os.Remove(extractPath)
+	}
+
+	name, _ := getBackupNameAndTimestamp(chain[len(chain)-1])
+	if set, ok := cfg.BackupSet(name); ok && set.Type == "docker" {
+		return restoreDockerVolumes(ctx, set, targetDir)
+	}
+	return nil
+}
+
+// isDump reports whether key is a database dump rather than a tar archive.
+func isDump(key string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(key, ".gpg"), backup.DumpExtension)
+}
+
+// restoreDump replays a database dump into the database configured for its backup set.
+func restoreDump(ctx context.Context, engine *backup.Engine, cfg *config.Config, path string) error {
+	name, _ := getBackupNameAndTimestamp(path)
+	set, ok := cfg.BackupSet(name)
+	if !ok || !set.IsDatabase() {
+		return fmt.Errorf("no postgres or mysql backup set named %q is configured to restore %s into", name, filepath.Base(path))
+	}
+	logging.FromContext(ctx).Info("Replaying dump into the database", "set", set.Name, "type", set.Type)
+	if err := engine.RestoreDatabase(path, databaseOf(set)); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// rehydrateChain makes sure every archive of the chain can be downloaded. Archives in cold storage
+// classes are restored with the requested tier; the requests are recorded in the state directory so
+// that a later invocation resumes waiting instead of issuing them again.
+func rehydrateChain(ctx context.Context, cfg *config.Config, store storage.Backend, chain []string, opts rehydrateOptions) error {
+	rehydrator, ok := store.(storage.Rehydrator)
+	if !ok {
+		return nil
+	}
+	st, err := state.NewStore(cfg.StateDir)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]pendingRehydration)
+	if err := st.Load(rehydrationStateFile, &pending); err != nil {
+		return err
+	}
+
+	waited := false
+	for {
+		var waiting []string
+		for _, key := range chain {
+			status, err := rehydrator.RehydrationStatus(ctx, key)
+			if err != nil {
+				return fmt.Errorf("failed to check %s: %w", key, err)
+			}
+			if status.Available {
+				delete(pending, key)
+				continue
+			}
+
+			if !status.InProgress {
+				estimate, err := rehydrator.Rehydrate(ctx, key, opts.tier, opts.days)
+				if err != nil {
+					return err
+				}
+				pending[key] = pendingRehydration{Tier: opts.tier, RequestedAt: time.Now(), Estimate: estimate}
+				logging.FromContext(ctx).Info("Requested restore from cold storage", "key", key, "tier", opts.tier, "storage_class", status.StorageClass, "estimate", estimate)
+			} else if _, known := pending[key]; !known {
+				// Restore was requested elsewhere; we can only tell when we first noticed it.
+				pending[key] = pendingRehydration{RequestedAt: time.Now()}
+			}
+			waiting = append(waiting, key)
+		}
+
+		if err := st.Save(rehydrationStateFile, pending); err != nil {
+			return err
+		}
+		if len(waiting) == 0 {
+			if waited {
+				logging.FromContext(ctx).Info("All archives are available, continuing restore")
+			}
+			return nil
+		}
+
+		logging.FromContext(ctx).Info("Archives are being restored from cold storage", "waiting", len(waiting), "archives", len(chain), "status", describeWait(pending, waiting))
+		if !opts.wait {
+			return errors.New("archives are not available yet, re-run this command to continue the restore once they are")
+		}
+
+		waited = true
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for archives, re-run this command to continue: %w", ctx.Err())
+		case <-time.After(opts.pollInterval):
+		}
+	}
+}
+
+// describeWait reports the estimated remaining time for the slowest pending restore.
+func describeWait(pending map[string]pendingRehydration, keys []string) string {
+	var readyBy time.Time
+	for _, key := range keys {
+		p := pending[key]
+		if p.Estimate == 0 {
+			return "requested elsewhere, no estimate available"
+		}
+		if at := p.RequestedAt.Add(p.Estimate); at.After(readyBy) {
+			readyBy = at
+		}
+	}
+	remaining := time.Until(readyBy).Round(time.Minute)
+	if remaining <= 0 {
+		return "taking longer than the typical estimate"
+	}
+	return fmt.Sprintf("estimated ready in about %s (by %s)", remaining, readyBy.Format(time.RFC3339))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+func TestResolveChain(t *testing.T) {
+	keys := []string{
+		"srv/app_20250101000000.full.tar.gz",
+		"srv/app_20250102000000.inc.tar.gz",
+		"srv/app_20250201000000.full.tar.gz",
+		"srv/app_20250202000000.inc.tar.gz",
+		"srv/app_20250203000000.inc.tar.gz",
+		"srv/db_20250202000000.full.tar.gz",
+	}
+	chain, err := resolveChain(keys, "srv/app_20250202000000.inc.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"srv/app_20250201000000.full.tar.gz", "srv/app_20250202000000.inc.tar.gz"}
+	if fmt.Sprint(chain) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, chain)
+	}
+
+	if _, err := resolveChain(keys[1:2], keys[1]); err == nil {
+		t.Error("expected error for incremental without full backup")
+	}
+
+	// SFTP and WebDAV list keys in no particular order.
+	shuffled := []string{keys[4], keys[3], keys[5], keys[1], keys[2], keys[0]}
+	chain, err = resolveChain(shuffled, keys[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{keys[2], keys[3], keys[4]}
+	if fmt.Sprint(chain) != fmt.Sprint(expected) {
+		t.Errorf("expected %v from shuffled keys, got %v", expected, chain)
+	}
+}
+
+// fakeColdStore is a storage.Rehydrator whose archived objects become available
+// on the second status check after a restore was requested.
+type fakeColdStore struct {
+	storage.Backend
+	archived  map[string]bool
+	requested map[string]int
+	checks    map[string]int
+}
+
+func (f *fakeColdStore) RehydrationStatus(_ context.Context, key string) (*storage.RehydrationStatus, error) {
+	if !f.archived[key] {
+		return &storage.RehydrationStatus{StorageClass: "STANDARD", Available: true}, nil
+	}
+	status := &storage.RehydrationStatus{StorageClass: "GLACIER", Archived: true}
+	if f.requested[key] > 0 {
+		f.checks[key]++
+		status.Available = f.checks[key] >= 2
+		status.InProgress = !status.Available
+	}
+	return status, nil
+}
+
+func (f *fakeColdStore) Rehydrate(_ context.Context, key, _ string, _ int) (time.Duration, error) {
+	f.requested[key]++
+	return time.Hour, nil
+}
+
+func TestRehydrateChain(t *testing.T) {
+	chain := []string{"srv/app_20250101000000.full.tar.gz", "srv/app_20250102000000.inc.tar.gz"}
+	store := &fakeColdStore{
+		archived:  map[string]bool{chain[0]: true},
+		requested: make(map[string]int),
+		checks:    make(map[string]int),
+	}
+	cfg := &config.Config{StateDir: t.TempDir()}
+
+	// Without waiting the first invocation only issues the request.
+	err := rehydrateChain(context.Background(), cfg, store, chain, rehydrateOptions{tier: "Bulk", days: 1})
+	if err == nil {
+		t.Fatal("expected error while archive is being restored")
+	}
+	if store.requested[chain[0]] != 1 || store.requested[chain[1]] != 0 {
+		t.Fatalf("unexpected restore requests: %v", store.requested)
+	}
+
+	// A second invocation resumes waiting without requesting the restore again.
+	opts := rehydrateOptions{tier: "Bulk", days: 1, wait: true, pollInterval: time.Millisecond}
+	if err := rehydrateChain(context.Background(), cfg, store, chain, opts); err != nil {
+		t.Fatalf("rehydrate failed: %v", err)
+	}
+	if store.requested[chain[0]] != 1 {
+		t.Errorf("expected a single restore request, got %d", store.requested[chain[0]])
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/snapshot"
+)
+
+// archiveFromSnapshot archives the folders of a backup set from an LVM, Btrfs or ZFS snapshot. Members
+// keep their live paths, so restores do not depend on where the snapshot was mounted. The snapshot is
+// removed again whatever the outcome.
+func archiveFromSnapshot(ctx context.Context, engine *backup.Engine, b *config.BackupSet, snapshotFile string, isFull bool, logger *slog.Logger) (res backup.ArchiveResult, err error) {
+	logger.Info("Creating snapshot", "type", b.Snapshot.Type, "volume", b.Snapshot.Volume)
+	snap, err := snapshot.Create(ctx, snapshot.Options{
+		Type:         b.Snapshot.Type,
+		Volume:       b.Snapshot.Volume,
+		Mountpoint:   b.Snapshot.Mountpoint,
+		Size:         b.Snapshot.Size,
+		MountOptions: b.Snapshot.MountOptions,
+	}, b.Name)
+	if err != nil {
+		return res, fmt.Errorf("snapshot failed: %w", err)
+	}
+	defer func() {
+		if rerr := snap.Remove(context.WithoutCancel(ctx)); rerr != nil {
+			err = errors.Join(err, rerr)
+		}
+	}()
+
+	spec := backup.ArchiveSpec{
+		Name:          b.Name,
+		Exclude:       b.Exclude,
+		SnapshotFile:  snapshotFile,
+		IsFull:        isFull,
+		NoCheckDevice: true,
+	}
+	for _, folder := range b.Folders {
+		path, err := snap.Translate(folder)
+		if err != nil {
+			return res, err
+		}
+		spec.Folders = append(spec.Folders, path)
+		spec.Transforms = append(spec.Transforms, backup.TransformPrefix(path, strings.TrimPrefix(filepath.Clean(folder), "/"))...)
+	}
+	return engine.Archive(spec)
+}
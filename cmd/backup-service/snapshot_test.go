@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+)
+
+func TestArchiveFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "srv")
+	frozen := filepath.Join(dir, "frozen")
+	for path, content := range map[string]string{
+		filepath.Join(live, "app", "data.txt"):   "changing",
+		filepath.Join(frozen, "app", "data.txt"): "frozen",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stand-in LVM tools: "mounting" the snapshot copies the frozen tree into the mount directory.
+	bin := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(bin, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	tools := map[string]string{
+		"lvs":      "exit 0",
+		"lvcreate": "exit 0",
+		"lvremove": "echo removed >> " + filepath.Join(dir, "removed"),
+		"mount":    `eval target=\${$#}; cp -a ` + frozen + `/. "$target"/`,
+		"umount":   `rm -rf "$1"/*`,
+	}
+	for name, body := range tools {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+body+"\n"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	set := &config.BackupSet{
+		Name:     "srv",
+		Folders:  []string{filepath.Join(live, "app") + "/"},
+		Snapshot: config.SnapshotConfig{Type: "lvm", Volume: "vg0/srv", Mountpoint: live},
+	}
+	snar := filepath.Join(dir, "srv.snar")
+	res, err := archiveFromSnapshot(context.Background(), backup.NewEngine(dir), set, snar, true, slog.Default())
+	if err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	if res.Files != 1 {
+		t.Errorf("expected 1 archived file, got %d", res.Files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "removed")); err != nil {
+		t.Error("expected the snapshot to be removed")
+	}
+
+	target := t.TempDir()
+	if out, err := exec.Command("tar", "-xzf", res.Path, "-C", target).CombinedOutput(); err != nil {
+		t.Fatalf("extract failed: %v, %s", err, out)
+	}
+	data, err := os.ReadFile(filepath.Join(target, strings.TrimPrefix(live, "/"), "app", "data.txt"))
+	if err != nil || string(data) != "frozen" {
+		t.Errorf("expected the snapshot contents under the live path, got %q, %v", data, err)
+	}
+}
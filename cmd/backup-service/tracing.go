@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/tracing"
+)
+
+// setupTracing exports spans to the configured OTLP endpoint, if any. Tracing problems are logged
+// and never prevent a backup. The returned function flushes the remaining spans.
+func setupTracing(ctx context.Context, cfg *config.Config) func() {
+	shutdown, err := tracing.Setup(ctx, tracing.Options{
+		Endpoint:    cfg.Tracing.Endpoint,
+		Headers:     cfg.Tracing.Headers,
+		ServiceName: cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		slog.Warn("Tracing disabled", "error", err)
+		return func() {}
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("Failed to export spans", "error", err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/tracing/tracingtest"
+)
+
+func TestExecuteBackupTracing(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	cfg := newTestConfig(t)
+	cfg.Tracing = config.TracingConfig{Endpoint: collector.URL, ServiceName: "backup-service"}
+
+	stopTracing := setupTracing(context.Background(), cfg)
+	rep, err := executeBackup(context.Background(), cfg, false, nil)
+	stopTracing()
+	if err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	spans := make(map[string]tracingtest.Span)
+	for _, s := range collector.Spans() {
+		spans[s.Name] = s
+	}
+	run := spans["backup.run"]
+	if run.ParentID != "" || run.Attributes["run_id"] != rep.RunID || run.Attributes["status"] != "success" {
+		t.Errorf("unexpected run span %+v", run)
+	}
+	set := spans["backup.set"]
+	if set.ParentID != run.SpanID || set.Attributes["set"] != "docs" || set.Attributes["backup_type"] != "full" || set.Attributes["bytes"] == "0" {
+		t.Errorf("unexpected set span %+v", set)
+	}
+	archive := spans["backup.archive"]
+	if archive.ParentID != set.SpanID || archive.Attributes["files"] == "0" || archive.Attributes["bytes"] == "0" {
+		t.Errorf("unexpected archive span %+v", archive)
+	}
+	upload := spans["backup.upload"]
+	if upload.ParentID != set.SpanID || upload.Attributes["set"] != "docs" || upload.Attributes["destination"] != "local" ||
+		upload.Attributes["bytes"] != set.Attributes["bytes"] || upload.Attributes["retries"] != "0" {
+		t.Errorf("unexpected upload span %+v", upload)
+	}
+	if rotate := spans["backup.rotate"]; rotate.ParentID != run.SpanID || rotate.Attributes["destination"] != "local" {
+		t.Errorf("unexpected rotate span %+v", rotate)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/config"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// verifyResult describes a backup chain that was checked.
+type verifyResult struct {
+	Destination string `json:"destination"`
+	Key         string `json:"key"`
+	Archives    int    `json:"archives"` // Archives in the chain, the full backup and its incrementals
+	Files       int    `json:"files"`    // Files in the tar archives of the chain
+}
+
+func verifyCmd() *cobra.Command {
+	var destName, key string
+	cmd := &cobra.Command{
+		Use:   "verify [set]",
+		Short: "Download the latest backup of a set and check that it decrypts and unpacks",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			cfg, err := config.LoadConfig(cfgFile)
+			if err != nil {
+				fatal("Failed to load config", "error", err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			ctx, logger := logging.With(ctx, "run_id", logging.NewRunID())
+			res, err := verifySet(ctx, cfg, destName, args[0], key)
+			if err != nil {
+				fatalContext(ctx, "Verification failed", "set", args[0], "error", err)
+			}
+			logger.Info("Verified backup", "set", args[0], "key", res.Key, "destination", res.Destination, "archives", res.Archives, "files", res.Files)
+		},
+	}
+	cmd.Flags().StringVar(&destName, "from", "", "destination to verify (default is the first destination of the set)")
+	cmd.Flags().StringVar(&key, "key", "", "backup to verify instead of the latest one")
+	return cmd
+}
+
+// verifySet checks the chain of a set's backup, the latest one unless key is given: every archive is
+// downloaded, decrypted and read to the end without extracting it.
+func verifySet(ctx context.Context, cfg *config.Config, destName, setName, key string) (verifyResult, error) {
+	set, ok := cfg.BackupSet(setName)
+	if !ok {
+		return verifyResult{}, fmt.Errorf("unknown backup set %q", setName)
+	}
+	if destName == "" {
+		destName = cfg.SetDestinations(set)[0]
+	}
+	res := verifyResult{Destination: destName, Key: key}
+
+	backups, err := listBackups(ctx, cfg, destName, setName)
+	if err != nil {
+		return res, err
+	}
+	if res.Key == "" {
+		if len(backups) == 0 {
+			return res, fmt.Errorf("no backups of %s in %s", setName, destName)
+		}
+		res.Key = backups[len(backups)-1]
+	}
+	chain, err := resolveChain(backups, res.Key)
+	if err != nil {
+		return res, err
+	}
+
+	store, err := openDestination(ctx, cfg, destName)
+	if err != nil {
+		return res, err
+	}
+	defer closeStorage(store)
+
+	engine := backup.NewEngine(os.TempDir())
+	for i, chainKey := range chain {
+		logging.FromContext(ctx).Info("Verifying archive", "key", chainKey, "index", i+1, "archives", len(chain))
+		files, err := verifyArchive(ctx, cfg, engine, store, chainKey)
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", chainKey, err)
+		}
+		res.Archives++
+		res.Files += files
+	}
+	return res, nil
+}
+
+// verifyArchive downloads and checks one archive, removing the local copies afterwards.
+func verifyArchive(ctx context.Context, cfg *config.Config, engine *backup.Engine, store storage.Backend, key string) (int, error) {
+	tempPath := filepath.Join(os.TempDir(), filepath.Base(key))
+	defer func() { _ = os.Remove(tempPath) }()
+	if err := withRetry(ctx, cfg, func(ctx context.Context) error { return store.Get(ctx, key, tempPath) }); err != nil {
+		return 0, fmt.Errorf("failed to download: %w", err)
+	}
+
+	path := tempPath
+	if filepath.Ext(tempPath) == ".gpg" {
+		decryptedPath, err := engine.Decrypt(tempPath, cfg.Encryption.Passphrase)
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = os.Remove(decryptedPath) }()
+		path = decryptedPath
+	}
+	return engine.Verify(path)
+}
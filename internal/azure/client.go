@@ -0,0 +1,185 @@
+// Package azure provides a wrapper around the Azure Blob Storage SDK.
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+var _ storage.Backend = (*Client)(nil)
+
+// Options configures the Azure Blob Storage connection. Credentials are taken from ConnectionString
+// if set, otherwise from AccountName and AccountKey; a container URL carrying a SAS token works without either.
+type Options struct {
+	ConnectionString string
+	AccountName      string
+	AccountKey       string
+	// Endpoint is the blob service URL, e.g. https://account.blob.core.windows.net
+	// or http://127.0.0.1:10000/devstoreaccount1 for Azurite.
+	Endpoint  string
+	Container string
+	Prefix    string
+	// UploadLimiter and DownloadLimiter, if set, throttle the data streams. They may be shared
+	// with other clients.
+	UploadLimiter   *ratelimit.Limiter
+	DownloadLimiter *ratelimit.Limiter
+}
+
+// Client is a wrapper around an Azure Blob Storage container client.
+type Client struct {
+	client    *container.Client
+	prefix    string
+	upLimit   *ratelimit.Limiter
+	downLimit *ratelimit.Limiter
+}
+
+// NewClient creates a new Azure Blob Storage client for the configured container.
+func NewClient(opts Options) (*Client, error) {
+	if opts.Container == "" {
+		return nil, errors.New("azure container is not configured")
+	}
+
+	var (
+		client *container.Client
+		err    error
+	)
+	switch {
+	case opts.ConnectionString != "":
+		client, err = container.NewClientFromConnectionString(opts.ConnectionString, opts.Container, nil)
+	case opts.AccountName != "" && opts.AccountKey != "":
+		endpoint := opts.Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", opts.AccountName)
+		}
+		cred, credErr := azblob.NewSharedKeyCredential(opts.AccountName, opts.AccountKey)
+		if credErr != nil {
+			return nil, fmt.Errorf("invalid azure account key: %w", credErr)
+		}
+		var u string
+		if u, err = containerURL(endpoint, opts.Container); err != nil {
+			return nil, err
+		}
+		client, err = container.NewClientWithSharedKeyCredential(u, cred, nil)
+	case opts.Endpoint != "":
+		var u string
+		if u, err = containerURL(opts.Endpoint, opts.Container); err != nil {
+			return nil, err
+		}
+		client, err = container.NewClientWithNoCredential(u, nil)
+	default:
+		return nil, errors.New("azure requires a connection string, an account key or an endpoint with a SAS token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure client: %w", err)
+	}
+
+	return &Client{client: client, prefix: opts.Prefix, upLimit: opts.UploadLimiter, downLimit: opts.DownloadLimiter}, nil
+}
+
+// containerURL appends the container name to the service URL, keeping any SAS query string.
+func containerURL(endpoint, containerName string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid azure endpoint: %w", err)
+	}
+	u.Path = path.Join(u.Path, containerName)
+	return u.String(), nil
+}
+
+// Put uploads a local file as a block blob.
+func (c *Client) Put(ctx context.Context, filePath string) error {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	key := path.Join(c.prefix, filepath.Base(filePath))
+	if _, err := c.client.NewBlockBlobClient(key).UploadStream(ctx, c.upLimit.Reader(ctx, file), nil); err != nil {
+		return fmt.Errorf("failed to upload to azure: %w", err)
+	}
+	return nil
+}
+
+// Get downloads a blob to a local target path.
+func (c *Client) Get(ctx context.Context, key, targetPath string) error {
+	resp, err := c.client.NewBlobClient(key).DownloadStream(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+		}
+		return fmt.Errorf("failed to download from azure: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	file, err := os.Create(targetPath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := io.Copy(file, c.downLimit.Reader(ctx, resp.Body)); err != nil {
+		_ = file.Close()
+		_ = os.Remove(targetPath)
+		return fmt.Errorf("failed to download from azure: %w", err)
+	}
+	return nil
+}
+
+// List lists all blobs in the container under the configured prefix.
+func (c *Client) List(ctx context.Context) ([]string, error) {
+	var keys []string
+	pager := c.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &c.prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list azure blobs: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil {
+				keys = append(keys, *item.Name)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Delete deletes a blob by its key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if _, err := c.client.NewBlobClient(key).Delete(ctx, nil); err != nil {
+		return fmt.Errorf("failed to delete azure blob: %w", err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of a blob.
+func (c *Client) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	props, err := c.client.NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to stat azure blob: %w", err)
+	}
+
+	info := &storage.ObjectInfo{Key: key}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.LastModified != nil {
+		info.ModTime = *props.LastModified
+	}
+	return info, nil
+}
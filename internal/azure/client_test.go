@@ -0,0 +1,49 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/mikhail-angelov/backup-service/internal/storage/storagetest"
+)
+
+// TestBackendAzurite runs against a local Azurite emulator, e.g.
+//
+//	docker run -p 10000:10000 mcr.microsoft.com/azure-storage/azurite azurite-blob --blobHost 0.0.0.0
+//	AZURITE_CONNECTION_STRING="DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=...;BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;" go test ./internal/azure/
+func TestBackendAzurite(t *testing.T) {
+	connStr := os.Getenv("AZURITE_CONNECTION_STRING")
+	if connStr == "" {
+		t.Skip("AZURITE_CONNECTION_STRING is not set")
+	}
+
+	name := fmt.Sprintf("backup-test-%d", time.Now().UnixNano())
+	cc, err := container.NewClientFromConnectionString(connStr, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := cc.Create(ctx, nil); err != nil {
+		t.Fatalf("failed to create container: %v", err)
+	}
+	t.Cleanup(func() { _, _ = cc.Delete(ctx, nil) })
+
+	storagetest.Run(t, func(t *testing.T, prefix string) storage.Backend {
+		client, err := NewClient(Options{ConnectionString: connStr, Container: name, Prefix: prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	})
+}
+
+func TestNewClientRequiresCredentials(t *testing.T) {
+	if _, err := NewClient(Options{Container: "backups"}); err == nil {
+		t.Error("expected error without credentials")
+	}
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DumpExtension is the suffix of compressed SQL dump archives, before an optional ".gpg".
+const DumpExtension = ".sql.gz"
+
+// Database describes a PostgreSQL or MySQL database to dump. Empty connection settings are left to
+// the client tools, which then fall back to their usual environment variables (PGHOST, PGUSER, ...)
+// and option files.
+type Database struct {
+	Kind     string // postgres or mysql
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	// All dumps every database (pg_dumpall, mysqldump --all-databases) instead of Name.
+	All bool
+	// Options are passed to the dump tool as-is.
+	Options []string
+	// DumpCommand and RestoreCommand replace the client tool binaries.
+	DumpCommand    string
+	RestoreCommand string
+}
+
+// dumpArgs returns the command line and extra environment of the dump tool.
+func (d *Database) dumpArgs() ([]string, []string, error) {
+	var argv, env []string
+	switch d.Kind {
+	case "postgres":
+		argv = []string{"pg_dump"}
+		if d.All {
+			argv = []string{"pg_dumpall"}
+		}
+		argv = append(argv, d.postgresConnArgs()...)
+		argv = append(argv, d.Options...)
+		if !d.All && d.Name != "" {
+			argv = append(argv, d.Name)
+		}
+		if d.Password != "" {
+			env = append(env, "PGPASSWORD="+d.Password)
+		}
+	case "mysql":
+		argv = append([]string{"mysqldump"}, d.mysqlConnArgs()...)
+		argv = append(argv, "--single-transaction", "--routines", "--triggers")
+		argv = append(argv, d.Options...)
+		if d.All {
+			argv = append(argv, "--all-databases")
+		} else if d.Name != "" {
+			argv = append(argv, "--databases", d.Name)
+		}
+		if d.Password != "" {
+			env = append(env, "MYSQL_PWD="+d.Password)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown database type %q", d.Kind)
+	}
+	if d.DumpCommand != "" {
+		argv[0] = d.DumpCommand
+	}
+	return argv, env, nil
+}
+
+// restoreArgs returns the command line and extra environment of the client that replays a dump.
+func (d *Database) restoreArgs() ([]string, []string, error) {
+	var argv, env []string
+	switch d.Kind {
+	case "postgres":
+		argv = append([]string{"psql", "-v", "ON_ERROR_STOP=1"}, d.postgresConnArgs()...)
+		switch {
+		case d.All:
+			argv = append(argv, "-d", "postgres")
+		case d.Name != "":
+			argv = append(argv, "-d", d.Name)
+		}
+		if d.Password != "" {
+			env = append(env, "PGPASSWORD="+d.Password)
+		}
+	case "mysql":
+		// The dump names its databases, so the client needs no default database.
+		argv = append([]string{"mysql"}, d.mysqlConnArgs()...)
+		if d.Password != "" {
+			env = append(env, "MYSQL_PWD="+d.Password)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown database type %q", d.Kind)
+	}
+	if d.RestoreCommand != "" {
+		argv[0] = d.RestoreCommand
+	}
+	return argv, env, nil
+}
+
+func (d *Database) postgresConnArgs() []string {
+	var args []string
+	if d.Host != "" {
+		args = append(args, "-h", d.Host)
+	}
+	if d.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(d.Port))
+	}
+	if d.User != "" {
+		args = append(args, "-U", d.User)
+	}
+	return args
+}
+
+func (d *Database) mysqlConnArgs() []string {
+	var args []string
+	if d.Host != "" {
+		args = append(args, "-h", d.Host)
+	}
+	if d.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(d.Port))
+	}
+	if d.User != "" {
+		args = append(args, "-u", d.User)
+	}
+	return args
+}
+
+// DumpDatabase streams the output of the database's dump tool through gzip into a new archive.
+// Dumps are always complete, so the archive is named as a full backup.
+func (e *Engine) DumpDatabase(name string, db *Database) (string, error) {
+	argv, env, err := db.dumpArgs()
+	if err != nil {
+		return "", err
+	}
+
+	timestamp := time.Now().Format("20060102150405")
+	archivePath := filepath.Join(e.TempDir, fmt.Sprintf("%s_%s.full%s", name, timestamp, DumpExtension))
+	file, err := os.OpenFile(archivePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return "", fmt.Errorf("failed to create dump archive: %w", err)
+	}
+	zw := gzip.NewWriter(e.IOLimit.Writer(context.Background(), file))
+
+	cmd := e.command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = zw
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	closeErr := errors.Join(zw.Close(), file.Close())
+
+	if runErr != nil {
+		_ = os.Remove(archivePath)
+		return "", fmt.Errorf("%s failed: %w, output: %s", filepath.Base(argv[0]), runErr, stderr.String())
+	}
+	if closeErr != nil {
+		_ = os.Remove(archivePath)
+		return "", fmt.Errorf("failed to write dump archive: %w", closeErr)
+	}
+	return archivePath, nil
+}
+
+// RestoreDatabase replays a compressed dump created by DumpDatabase with the database's client tool.
+func (e *Engine) RestoreDatabase(archivePath string, db *Database) error {
+	argv, env, err := db.restoreArgs()
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(archivePath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open dump archive: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read dump archive: %w", err)
+	}
+
+	cmd := e.command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = zr
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w, output: %s", filepath.Base(argv[0]), err, string(output))
+	}
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return fmt.Errorf("failed to read dump archive: %w", err)
+	}
+	return nil
+}
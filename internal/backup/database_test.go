@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScript creates an executable shell script standing in for a database client tool.
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o700); err != nil { // #nosec G306
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDumpArgs(t *testing.T) {
+	tests := []struct {
+		db       Database
+		expected string
+	}{
+		{Database{Kind: "postgres", Host: "db", Port: 5433, User: "app", Name: "shop"}, "[pg_dump -h db -p 5433 -U app shop]"},
+		{Database{Kind: "postgres", All: true, Options: []string{"--clean"}}, "[pg_dumpall --clean]"},
+		{Database{Kind: "mysql", User: "root", Name: "shop"}, "[mysqldump -u root --single-transaction --routines --triggers --databases shop]"},
+		{Database{Kind: "mysql", All: true, DumpCommand: "/opt/mysqldump"}, "[/opt/mysqldump --single-transaction --routines --triggers --all-databases]"},
+	}
+	for _, tt := range tests {
+		argv, _, err := tt.db.dumpArgs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(argv); got != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, got)
+		}
+	}
+	if _, _, err := (&Database{Kind: "oracle"}).dumpArgs(); err == nil {
+		t.Error("expected error for unknown database type")
+	}
+}
+
+func TestDumpAndRestoreDatabase(t *testing.T) {
+	dir := t.TempDir()
+	restored := filepath.Join(dir, "restored.sql")
+	db := &Database{
+		Kind:           "postgres",
+		Name:           "shop",
+		Password:       "secret",
+		DumpCommand:    writeScript(t, dir, "pg_dump", `echo "-- dump of $1 with $PGPASSWORD"; echo "CREATE TABLE t (id int);"`),
+		RestoreCommand: writeScript(t, dir, "psql", `cat > `+restored),
+	}
+	e := NewEngine(dir)
+
+	archive, err := e.DumpDatabase("shop", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(archive, ".full.sql.gz") {
+		t.Errorf("unexpected archive name %s", archive)
+	}
+	file, err := os.Open(archive) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-- dump of shop with secret\nCREATE TABLE t (id int);\n"; string(dump) != want {
+		t.Errorf("expected dump %q, got %q", want, dump)
+	}
+
+	if err := e.RestoreDatabase(archive, db); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(restored) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(dump) {
+		t.Errorf("expected restore to receive the dump, got %q", data)
+	}
+}
+
+func TestDumpDatabaseFailure(t *testing.T) {
+	dir := t.TempDir()
+	db := &Database{Kind: "mysql", DumpCommand: writeScript(t, dir, "mysqldump", `echo "access denied" >&2; exit 2`)}
+	_, err := NewEngine(dir).DumpDatabase("shop", db)
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Fatalf("expected dump error with output, got %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.sql.gz")); len(matches) != 0 {
+		t.Errorf("expected failed dump to be removed, found %v", matches)
+	}
+}
@@ -2,16 +2,73 @@
 package backup
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
 )
 
 // Engine handles the creation and management of backup archives.
 type Engine struct {
 	TempDir string
+	// Priority applies to the tar and gpg processes spawned by the engine.
+	Priority Priority
+	// IOLimit, if set, caps the bytes per second written to archives, database dumps and
+	// encrypted files. tar and the dump tools block while their output waits, which slows down
+	// their reads as well. The limiter may be shared by engines running in parallel.
+	IOLimit *ratelimit.Limiter
+}
+
+// Priority lowers the CPU and disk I/O priority of spawned processes via nice and ionice,
+// so that backups do not starve the services they protect.
+type Priority struct {
+	Nice    int    // Niceness 1-19, 0 leaves it unchanged
+	IOClass string // idle, best-effort or realtime; empty leaves it unchanged
+	IOLevel int    // 0 (highest) to 7 (lowest) within best-effort and realtime
+}
+
+// ioClasses maps ionice class names to their numbers.
+var ioClasses = map[string]string{"realtime": "1", "best-effort": "2", "idle": "3"}
+
+// command builds an exec.Cmd for name, wrapped in ionice and nice according to the priority.
+func (e *Engine) command(name string, args ...string) *exec.Cmd {
+	argv := append([]string{name}, args...)
+	if e.Priority.Nice > 0 {
+		argv = append([]string{"nice", "-n", strconv.Itoa(e.Priority.Nice)}, argv...)
+	}
+	if class, ok := ioClasses[e.Priority.IOClass]; ok {
+		prefix := []string{"ionice", "-c", class}
+		if class != "3" {
+			prefix = append(prefix, "-n", strconv.Itoa(e.Priority.IOLevel))
+		}
+		argv = append(prefix, argv...)
+	}
+	return exec.Command(argv[0], argv[1:]...) // #nosec G204
+}
+
+// runToFile runs cmd with its standard output written to a new file at path through the I/O limit.
+// It returns what cmd printed to standard error.
+func (e *Engine) runToFile(cmd *exec.Cmd, path string) (string, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Base(path), err)
+	}
+	var stderr strings.Builder
+	cmd.Stdout = e.IOLimit.Writer(context.Background(), file)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return stderr.String(), err
 }
 
 // NewEngine creates a new backup engine with a temporary directory workspace.
@@ -22,54 +79,201 @@ func NewEngine(tempDir string) *Engine {
 // CreateArchive creates a tar.gz archive of the specified folders, supporting full and incremental backups with GNU tar.
 // If isFull is true, it ignores/resets the snapshotFile to force a full backup.
 func (e *Engine) CreateArchive(name string, folders, exclude []string, snapshotFile string, isFull bool) (archivePath, backupType string, err error) {
+	res, err := e.Archive(ArchiveSpec{
+		Name:         name,
+		Folders:      folders,
+		Exclude:      exclude,
+		SnapshotFile: snapshotFile,
+		IsFull:       isFull,
+	})
+	return res.Path, res.Type, err
+}
+
+// ArchiveSpec describes an archive to create with Archive.
+type ArchiveSpec struct {
+	Name         string
+	Folders      []string
+	Exclude      []string
+	SnapshotFile string
+	IsFull       bool
+	// Transforms are GNU tar --transform expressions that rename members as they are stored,
+	// e.g. to hide where a folder was read from.
+	Transforms []string
+	// NoCheckDevice keeps incremental backups working when the folders are read from a different
+	// device every time, e.g. a freshly mounted snapshot.
+	NoCheckDevice bool
+}
+
+// ArchiveResult describes an archive created by Archive.
+type ArchiveResult struct {
+	Path  string
+	Type  string // full or inc
+	Files int    // Files stored, not counting directories
+}
+
+// Archive creates a tar.gz archive as described by spec. See CreateArchive. When tar completes
+// with warnings, the archive is returned together with an *ArchiveWarning.
+func (e *Engine) Archive(spec ArchiveSpec) (ArchiveResult, error) {
 	timestamp := time.Now().Format("20060102150405")
-	backupType = "inc"
-	if isFull {
-		backupType = "full"
-		if snapshotFile != "" {
-			_ = os.Remove(snapshotFile)
+	res := ArchiveResult{Type: "inc"}
+	if spec.IsFull {
+		res.Type = "full"
+		if spec.SnapshotFile != "" {
+			_ = os.Remove(spec.SnapshotFile)
 		}
 	}
 
-	archiveName := fmt.Sprintf("%s_%s.%s.tar.gz", name, timestamp, backupType)
-	archivePath = filepath.Join(e.TempDir, archiveName)
+	archiveName := fmt.Sprintf("%s_%s.%s.tar.gz", spec.Name, timestamp, res.Type)
+	archivePath := filepath.Join(e.TempDir, archiveName)
+	// The verbose listing goes to an index file, which tells how many files were stored.
+	indexPath := archivePath + ".index"
+	defer func() { _ = os.Remove(indexPath) }()
 
-	args := []string{"-czf", archivePath}
+	// tar writes the archive to standard output, which runToFile throttles.
+	args := []string{"-czf", "-", "--verbose", "--index-file", indexPath}
 
-	if snapshotFile != "" {
-		args = append(args, "--listed-incremental", snapshotFile)
+	if spec.SnapshotFile != "" {
+		args = append(args, "--listed-incremental", spec.SnapshotFile)
+		if spec.NoCheckDevice {
+			args = append(args, "--no-check-device")
+		}
 	}
 
-	for _, pattern := range exclude {
+	for _, pattern := range spec.Exclude {
 		args = append(args, "--exclude", pattern)
 	}
 
-	args = append(args, folders...)
+	for _, expr := range spec.Transforms {
+		args = append(args, "--transform", expr)
+	}
+
+	args = append(args, spec.Folders...)
 
-	cmd := exec.Command("tar", args...) // #nosec G204
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return "", "", fmt.Errorf("tar failed: %w, output: %s", err, string(output))
+	if output, err := e.runToFile(e.command("tar", args...), archivePath); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			// GNU tar exits with 1 when files changed while being read but the archive is complete.
+			res.Path, res.Files = archivePath, countFiles(indexPath)
+			return res, parseTarWarnings(output)
+		}
+		_ = os.Remove(archivePath)
+		return ArchiveResult{}, fmt.Errorf("tar failed: %w, output: %s", err, output)
 	}
 
-	return archivePath, backupType, nil
+	res.Path, res.Files = archivePath, countFiles(indexPath)
+	return res, nil
+}
+
+// countFiles counts the non-directory entries of a tar verbose listing.
+func countFiles(indexPath string) int {
+	data, err := os.ReadFile(indexPath) // #nosec G304
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasSuffix(line, "/") {
+			n++
+		}
+	}
+	return n
+}
+
+// ArchiveWarning is returned by Archive and CreateArchive when tar completed the archive but some
+// files changed, shrank or disappeared while they were read. The archive is kept; those files
+// may be inconsistent or missing in it.
+type ArchiveWarning struct {
+	// Files lists the affected files as tar reported them.
+	Files []string
+	// Messages are all warnings printed by tar.
+	Messages []string
+}
+
+func (w *ArchiveWarning) Error() string {
+	if len(w.Files) > 0 {
+		return fmt.Sprintf("%d file(s) changed while being archived: %s", len(w.Files), strings.Join(w.Files, ", "))
+	}
+	return "tar reported warnings: " + strings.Join(w.Messages, "; ")
+}
+
+// tarFileWarning matches the per-file warnings of GNU tar that leave a usable archive.
+var tarFileWarning = regexp.MustCompile(`^tar: (.+): (file changed as we read it|File removed before we read it|File shrank by \d+ bytes.*|file changed dev/ino|Directory has been renamed.*)$`)
+
+func parseTarWarnings(output string) *ArchiveWarning {
+	w := &ArchiveWarning{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "tar: Removing leading") {
+			continue
+		}
+		w.Messages = append(w.Messages, strings.TrimPrefix(line, "tar: "))
+		if m := tarFileWarning.FindStringSubmatch(line); m != nil {
+			w.Files = append(w.Files, m[1])
+		}
+	}
+	return w
+}
+
+// TransformPrefix returns --transform expressions storing dir, and everything below it, under the
+// archive path newPrefix.
+func TransformPrefix(dir, newPrefix string) []string {
+	dir = strings.TrimPrefix(filepath.Clean(dir), "/")
+	var escaped strings.Builder
+	for _, r := range dir {
+		if strings.ContainsRune(`\.[]*^$|`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return []string{
+		fmt.Sprintf("s|^%s$|%s|", escaped.String(), newPrefix),
+		fmt.Sprintf("s|^%s/|%s/|", escaped.String(), newPrefix),
+	}
 }
 
 // Encrypt encrypts a file using GPG symmetric encryption with a passphrase.
 func (e *Engine) Encrypt(filePath, passphrase string) (string, error) {
 	encryptedPath := filePath + ".gpg"
-	cmd := exec.Command("gpg", "--batch", "--yes", "--passphrase", passphrase, "--symmetric", "--output", encryptedPath, filePath) // #nosec G204
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("gpg encryption failed: %w, output: %s", err, string(output))
+	cmd := e.command("gpg", "--batch", "--yes", "--passphrase", passphrase, "--symmetric", "--output", "-", filePath)
+	if output, err := e.runToFile(cmd, encryptedPath); err != nil {
+		_ = os.Remove(encryptedPath)
+		return "", fmt.Errorf("gpg encryption failed: %w, output: %s", err, output)
 	}
 	return encryptedPath, nil
 }
 
 // Decrypt decrypts a GPG-encrypted file using a symmetric passphrase.
 func (e *Engine) Decrypt(filePath, passphrase string) (string, error) {
-	decryptedPath := filePath[:len(filePath)-4]                                                                                  // remove .gpg
-	cmd := exec.Command("gpg", "--batch", "--yes", "--passphrase", passphrase, "--decrypt", "--output", decryptedPath, filePath) // #nosec G204
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("gpg decryption failed: %w, output: %s", err, string(output))
+	decryptedPath := filePath[:len(filePath)-4] // remove .gpg
+	cmd := e.command("gpg", "--batch", "--yes", "--passphrase", passphrase, "--decrypt", "--output", "-", filePath)
+	if output, err := e.runToFile(cmd, decryptedPath); err != nil {
+		_ = os.Remove(decryptedPath)
+		return "", fmt.Errorf("gpg decryption failed: %w, output: %s", err, output)
 	}
 	return decryptedPath, nil
 }
+
+// Verify checks that a decrypted archive or dump is intact by reading it to the end: dumps are
+// tested with gzip, tar archives are listed. It returns the number of files in tar archives.
+func (e *Engine) Verify(path string) (int, error) {
+	if strings.HasSuffix(path, DumpExtension) {
+		if output, err := e.command("gzip", "-t", path).CombinedOutput(); err != nil {
+			return 0, fmt.Errorf("gzip test failed: %w, output: %s", err, string(output))
+		}
+		return 0, nil
+	}
+	cmd := e.command("tar", "-tzf", path)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("tar listing failed: %w, output: %s", err, stderr.String())
+	}
+	files := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" && !strings.HasSuffix(line, "/") {
+			files++
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+)
+
+func TestCommandPriority(t *testing.T) {
+	tests := []struct {
+		priority Priority
+		expected string
+	}{
+		{Priority{}, "[tar -czf a.tar.gz]"},
+		{Priority{Nice: 10}, "[nice -n 10 tar -czf a.tar.gz]"},
+		{Priority{IOClass: "idle", IOLevel: 4}, "[ionice -c 3 tar -czf a.tar.gz]"},
+		{Priority{Nice: 19, IOClass: "best-effort", IOLevel: 7}, "[ionice -c 2 -n 7 nice -n 19 tar -czf a.tar.gz]"},
+	}
+	for _, tt := range tests {
+		e := &Engine{Priority: tt.priority}
+		cmd := e.command("tar", "-czf", "a.tar.gz")
+		if got := fmt.Sprint(cmd.Args); got != tt.expected {
+			t.Errorf("%+v: expected %s, got %s", tt.priority, tt.expected, got)
+		}
+	}
+}
+
+func TestArchiveTarWarnings(t *testing.T) {
+	bin := t.TempDir()
+	// A stand-in tar that writes the archive, then exits with $FAKE_TAR_EXIT.
+	script := "#!/bin/sh\necho archive\necho 'tar: Removing leading `/'\"'\"' from member names' >&2\n" +
+		"echo 'tar: /var/log/app.log: file changed as we read it' >&2\n" +
+		"echo 'tar: /var/log/old.log: File removed before we read it' >&2\nexit $FAKE_TAR_EXIT\n"
+	if err := os.WriteFile(filepath.Join(bin, "tar"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+	e := NewEngine(t.TempDir())
+
+	t.Setenv("FAKE_TAR_EXIT", "1")
+	path, _, err := e.CreateArchive("logs", []string{"/var/log"}, nil, "", true)
+	var warning *ArchiveWarning
+	if !errors.As(err, &warning) {
+		t.Fatalf("expected an archive warning, got %v", err)
+	}
+	if fmt.Sprint(warning.Files) != "[/var/log/app.log /var/log/old.log]" || len(warning.Messages) != 2 {
+		t.Errorf("unexpected warning %+v", warning)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the archive to be kept: %v", err)
+	}
+
+	t.Setenv("FAKE_TAR_EXIT", "2")
+	e = NewEngine(t.TempDir())
+	_, _, err = e.CreateArchive("logs", []string{"/var/log"}, nil, "", true)
+	if err == nil || errors.As(err, &warning) {
+		t.Fatalf("expected a fatal error, got %v", err)
+	}
+	entries, _ := os.ReadDir(e.TempDir)
+	if len(entries) != 0 {
+		t.Errorf("expected the failed archive to be removed, got %d files", len(entries))
+	}
+}
+
+func TestArchiveIOLimit(t *testing.T) {
+	bin := t.TempDir()
+	// A stand-in tar writing a 160 KiB archive to standard output.
+	script := "#!/bin/sh\nhead -c 163840 /dev/zero\n"
+	if err := os.WriteFile(filepath.Join(bin, "tar"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+	e := NewEngine(t.TempDir())
+	e.IOLimit = ratelimit.New(64 << 10)
+
+	start := time.Now()
+	res, err := e.Archive(ArchiveSpec{Name: "logs", Folders: []string{"/var/log"}, IsFull: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(res.Path); err != nil || info.Size() != 160<<10 {
+		t.Fatalf("expected a 160 KiB archive, got %v %v", info, err)
+	}
+	// The first 64 KiB burst is free, the remaining 96 KiB take about 1.5s.
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the throttled archive to take over 1s, took %s", elapsed)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "docs", "sub"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"docs/a.txt", "docs/sub/b.txt"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEngine(t.TempDir())
+	res, err := e.Archive(ArchiveSpec{Name: "docs", Folders: []string{filepath.Join(src, "docs")}, IsFull: true})
+	if err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	if files, err := e.Verify(res.Path); err != nil || files != 2 {
+		t.Errorf("expected an intact archive of 2 files, got %d, %v", files, err)
+	}
+
+	data, _ := os.ReadFile(res.Path)
+	if err := os.WriteFile(res.Path, data[:len(data)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Verify(res.Path); err == nil {
+		t.Error("expected a truncated archive to fail verification")
+	}
+}
@@ -0,0 +1,44 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// timestampLen is the length of the YYYYMMDDHHMMSS timestamp in archive names.
+const timestampLen = len("20060102150405")
+
+// ParseArchiveName extracts the backup set name, timestamp and type ("full" or "inc") from an
+// archive key such as "prefix/web_app_20251228075027.inc.tar.gz.gpg". The name runs up to the last
+// underscore before the timestamp, so set names may contain underscores. Empty strings are returned
+// for parts that cannot be parsed.
+func ParseArchiveName(key string) (name, timestamp, backupType string) {
+	base := filepath.Base(key)
+	for end := len(base); end > 0; {
+		i := strings.LastIndex(base[:end], "_")
+		if i < 0 {
+			break
+		}
+		rest := strings.Split(base[i+1:], ".")
+		if isTimestamp(rest[0]) {
+			if len(rest) > 1 {
+				backupType = rest[1]
+			}
+			return base[:i], rest[0], backupType
+		}
+		end = i
+	}
+	return "", "", ""
+}
+
+func isTimestamp(s string) bool {
+	if len(s) != timestampLen {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,21 @@
+package backup
+
+import "testing"
+
+func TestParseArchiveName(t *testing.T) {
+	tests := []struct {
+		key, name, timestamp, backupType string
+	}{
+		{"srv1/web-app_20251228075027.inc.tar.gz.gpg", "web-app", "20251228075027", "inc"},
+		{"web_app_20251228075027.full.tar.gz", "web_app", "20251228075027", "full"},
+		{"srv1/db_main_20250101000000.full.sql.gz", "db_main", "20250101000000", "full"},
+		{"srv1/backup-service.lock", "", "", ""},
+		{"srv1/notes_draft.txt", "", "", ""},
+	}
+	for _, tt := range tests {
+		name, timestamp, backupType := ParseArchiveName(tt.key)
+		if name != tt.name || timestamp != tt.timestamp || backupType != tt.backupType {
+			t.Errorf("%s: expected %q %q %q, got %q %q %q", tt.key, tt.name, tt.timestamp, tt.backupType, name, timestamp, backupType)
+		}
+	}
+}
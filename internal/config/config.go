@@ -2,29 +2,34 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/robfig/cron/v3"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration.
 type Config struct {
-	S3 struct {
-		Bucket          string `yaml:"bucket"`
-		Region          string `yaml:"region"`
-		Endpoint        string `yaml:"endpoint"`
-		AccessKeyID     string `yaml:"access_key_id"`
-		SecretAccessKey string `yaml:"secret_access_key"`
-		Prefix          string `yaml:"prefix"`
-	} `yaml:"s3"`
-	Backups []struct {
-		Name    string   `yaml:"name"`
-		Folders []string `yaml:"folders"`
-		Exclude []string `yaml:"exclude"`
-	} `yaml:"backups"`
-	Encryption struct {
+	S3      S3Config     `yaml:"s3"`
+	Storage string       `yaml:"storage"` // s3 (default), local, sftp, webdav, azure or gcs
+	Local   LocalConfig  `yaml:"local"`
+	SFTP    SFTPConfig   `yaml:"sftp"`
+	WebDAV  WebDAVConfig `yaml:"webdav"`
+	Azure   AzureConfig  `yaml:"azure"`
+	GCS     GCSConfig    `yaml:"gcs"`
+	// Destinations lists named storage targets. When empty, a single destination named
+	// "default" is built from the top-level storage settings above.
+	Destinations []Destination `yaml:"destinations"`
+	Backups      []BackupSet   `yaml:"backups"`
+	Encryption   struct {
 		Passphrase string `yaml:"passphrase"`
 		Enabled    bool   `yaml:"enabled"`
 	} `yaml:"encryption"`
@@ -32,12 +37,472 @@ type Config struct {
 		Daily   int `yaml:"daily"`
 		Monthly int `yaml:"monthly"`
 	} `yaml:"retention"`
-	Telegram struct {
-		BotToken string `yaml:"bot_token"`
-		ChatID   string `yaml:"chat_id"`
-		Enabled  bool   `yaml:"enabled"`
-	} `yaml:"telegram"`
-	Schedule string `yaml:"schedule"` // Cron format
+	Telegram TelegramConfig `yaml:"telegram"`
+	// Notifications lists the channels run results are sent to. An enabled and complete telegram
+	// section above is added as a channel named "telegram".
+	Notifications []NotificationChannel `yaml:"notifications"`
+	TelegramBot   TelegramBotConfig     `yaml:"telegram_bot"`
+	Schedule      string                `yaml:"schedule"` // Cron format
+	// StateDir keeps state that must survive between runs, such as pending Glacier restores
+	// and uploads that are to be resumed. It must belong to the user running the service and not
+	// be writable by others; see DefaultStateDir for the default.
+	StateDir string         `yaml:"state_dir"`
+	Retry    RetryConfig    `yaml:"retry"`
+	Transfer TransferConfig `yaml:"transfer"`
+	// Workers is the number of backup sets processed at the same time (default 1).
+	Workers   int             `yaml:"workers"`
+	Resources ResourcesConfig `yaml:"resources"`
+	Lock      LockConfig      `yaml:"lock"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	API       APIConfig       `yaml:"api"`
+}
+
+// APIConfig serves the HTTP API and web dashboard in daemon mode.
+type APIConfig struct {
+	// Listen is the address of the server, e.g. "127.0.0.1:8080"; empty disables it.
+	Listen string `yaml:"listen"`
+	// Token authenticates API requests, sent as "Authorization: Bearer <token>".
+	Token string `yaml:"token"`
+}
+
+// TracingConfig exports OpenTelemetry spans of backup runs over OTLP/HTTP.
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP endpoint of a collector, e.g. http://localhost:4318; empty disables
+	// tracing. Spans are sent to its /v1/traces path unless the URL has another path.
+	Endpoint string            `yaml:"endpoint"`
+	Headers  map[string]string `yaml:"headers"` // e.g. an authorization header for a hosted backend
+	// ServiceName is the service.name resource attribute (default backup-service).
+	ServiceName string `yaml:"service_name"`
+}
+
+// MetricsConfig exports Prometheus metrics about backup runs.
+type MetricsConfig struct {
+	// Listen is the address serving /metrics in daemon mode, e.g. ":9101"; empty disables it.
+	Listen string `yaml:"listen"`
+	// Textfile is written after every run for the node_exporter textfile collector, e.g.
+	// /var/lib/node_exporter/textfile_collector/backup_service.prom; empty disables it.
+	Textfile string `yaml:"textfile"`
+}
+
+// TelegramConfig holds the Telegram bot used for notifications.
+type TelegramConfig struct {
+	BotToken string `yaml:"bot_token"`
+	ChatID   string `yaml:"chat_id"`
+	// ParseMode formats messages: HTML (default), MarkdownV2 or none for plain text.
+	ParseMode string `yaml:"parse_mode"`
+	Enabled   bool   `yaml:"enabled"` // Only used by the top-level telegram section
+}
+
+// TelegramBotConfig enables the bot answering commands in daemon mode.
+type TelegramBotConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	BotToken string `yaml:"bot_token"` // Default telegram.bot_token
+	// AllowedChats lists the chat IDs whose commands are answered; default telegram.chat_id.
+	AllowedChats []string      `yaml:"allowed_chats"`
+	PollTimeout  time.Duration `yaml:"poll_timeout"` // Long-polling timeout, default 30s
+}
+
+// NotificationChannel is a named place notifications are sent to. Type selects which of the
+// sections below is used.
+type NotificationChannel struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"` // telegram, slack, email, webhook, ntfy or gotify
+	// Template is a Go text/template replacing the default run report in the message body.
+	Template string `yaml:"template"`
+	// Severities limits the channel to runs with these outcomes: success, warning or failure.
+	// Empty means all of them.
+	Severities []string       `yaml:"severities"`
+	Digest     DigestConfig   `yaml:"digest"`
+	Telegram   TelegramConfig `yaml:"telegram"`
+	Slack      SlackConfig    `yaml:"slack"`
+	Email      EmailConfig    `yaml:"email"`
+	Webhook    WebhookConfig  `yaml:"webhook"`
+	Ntfy       NtfyConfig     `yaml:"ntfy"`
+	Gotify     GotifyConfig   `yaml:"gotify"`
+}
+
+// DigestConfig makes a channel collect run reports and send a summary of them on a schedule,
+// instead of one message per run.
+type DigestConfig struct {
+	Schedule string `yaml:"schedule"` // Cron format; empty sends every run right away
+	Template string `yaml:"template"` // Go text/template replacing the default digest body
+}
+
+// Accepts reports whether the channel wants runs with the given status.
+func (n *NotificationChannel) Accepts(status string) bool {
+	return len(n.Severities) == 0 || slices.Contains(n.Severities, status)
+}
+
+// SlackConfig holds a Slack incoming webhook.
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// EmailConfig holds the SMTP server and addresses of email notifications.
+type EmailConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"` // Default 587, or 465 with tls: implicit
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// TLS is starttls (default, used when the server offers it), implicit, or none.
+	TLS string `yaml:"tls"`
+}
+
+// WebhookConfig describes a generic HTTP webhook.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"` // Default POST
+	Headers map[string]string `yaml:"headers"`
+	// Template is a Go text/template rendering the request body; a JSON document by default.
+	Template string `yaml:"template"`
+	// Secret signs the body with HMAC-SHA256, sent as "X-Signature: sha256=<hex>".
+	Secret string `yaml:"secret"`
+}
+
+// NtfyConfig describes an ntfy topic.
+type NtfyConfig struct {
+	URL      string `yaml:"url"` // Default https://ntfy.sh
+	Topic    string `yaml:"topic"`
+	Token    string `yaml:"token"`
+	Priority string `yaml:"priority"` // ntfy priority name or 1-5
+}
+
+// GotifyConfig describes a Gotify application.
+type GotifyConfig struct {
+	URL      string `yaml:"url"`
+	Token    string `yaml:"token"` // Application token
+	Priority int    `yaml:"priority"`
+}
+
+// LockConfig controls how overlapping backup runs are prevented. A lock file in the state
+// directory is always used; the remote lock additionally guards destinations shared by several hosts.
+type LockConfig struct {
+	Remote bool          `yaml:"remote"` // Keep a lock object in every destination during a run
+	TTL    time.Duration `yaml:"ttl"`    // Expiry of the lock object if not refreshed, default 1h
+}
+
+// ResourcesConfig lowers the CPU and disk I/O priority of the archiving and encryption processes
+// and caps how fast they write.
+type ResourcesConfig struct {
+	Nice    int      `yaml:"nice"`     // 1-19, 0 = unchanged
+	IOClass string   `yaml:"io_class"` // idle, best-effort or realtime
+	IOLevel int      `yaml:"io_level"` // 0-7 within best-effort and realtime, 7 is the lowest priority
+	IOLimit ByteSize `yaml:"io_limit"` // Bytes per second written to archives, dumps and encrypted files, 0 = unlimited
+}
+
+func (r *ResourcesConfig) validate() error {
+	if r.Nice < 0 || r.Nice > 19 {
+		return fmt.Errorf("resources nice must be between 0 and 19, got %d", r.Nice)
+	}
+	switch r.IOClass {
+	case "", "idle", "best-effort", "realtime":
+	default:
+		return fmt.Errorf("invalid resources io_class %q, expected idle, best-effort or realtime", r.IOClass)
+	}
+	if r.IOLevel < 0 || r.IOLevel > 7 {
+		return fmt.Errorf("resources io_level must be between 0 and 7, got %d", r.IOLevel)
+	}
+	return nil
+}
+
+// RetryConfig controls how failed storage operations are retried with exponential backoff.
+type RetryConfig struct {
+	Attempts     int           `yaml:"attempts"`      // Total tries per operation, default 5
+	InitialDelay time.Duration `yaml:"initial_delay"` // Default 1s, doubled on every retry
+	MaxDelay     time.Duration `yaml:"max_delay"`     // Default 1m
+}
+
+// BackupSet describes a group of folders archived together, or a database dumped as a whole.
+type BackupSet struct {
+	Name string `yaml:"name"`
+	// Type is files (default), postgres, mysql or docker.
+	Type     string         `yaml:"type"`
+	Folders  []string       `yaml:"folders"`
+	Exclude  []string       `yaml:"exclude"`
+	Database DatabaseConfig `yaml:"database"`
+	Docker   DockerConfig   `yaml:"docker"`
+	// Snapshot optionally archives the folders from a filesystem snapshot instead of the live files.
+	Snapshot SnapshotConfig `yaml:"snapshot"`
+	// TarWarnings decides what happens when files change or vanish while tar reads them: warn (default)
+	// keeps the archive and reports the files, ignore keeps it silently, fail discards it.
+	TarWarnings string `yaml:"tar_warnings"`
+	// Destinations names the destinations this set is uploaded to. Empty means all of them;
+	// the first one is the primary destination used to decide between full and incremental backups.
+	Destinations []string `yaml:"destinations"`
+	// Priority orders sets when several are processed in parallel; higher values start first.
+	Priority int   `yaml:"priority"`
+	Hooks    Hooks `yaml:"hooks"`
+	// Heartbeat pings a dead man's switch monitor when the set starts, succeeds and fails.
+	Heartbeat HeartbeatConfig `yaml:"heartbeat"`
+	// MaxAge is how old the newest backup of the set may get before the check command reports it
+	// as stale; 0 uses the command's default.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// HeartbeatConfig describes a push monitor such as a healthchecks.io check or an Uptime Kuma push monitor.
+type HeartbeatConfig struct {
+	Type string `yaml:"type"` // healthchecks (default) or uptime-kuma
+	// URL is the ping URL of the check, or the push URL of the Uptime Kuma monitor.
+	URL string `yaml:"url"`
+}
+
+// DatabaseConfig describes the database dumped by a postgres or mysql backup set. Unset connection
+// settings are left to the client tools' environment variables (PGHOST, PGUSER, ...) and option files.
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"` // Passed as PGPASSWORD or MYSQL_PWD
+	Name     string `yaml:"name"`
+	// All dumps every database with pg_dumpall or mysqldump --all-databases.
+	All     bool     `yaml:"all"`
+	Options []string `yaml:"options"` // Extra arguments for the dump tool
+	// DumpCommand and RestoreCommand override the paths of the client tools.
+	DumpCommand    string `yaml:"dump_command"`
+	RestoreCommand string `yaml:"restore_command"`
+}
+
+// DockerConfig selects the named volumes archived by a docker backup set.
+type DockerConfig struct {
+	Volumes []string `yaml:"volumes"`
+	// VolumeLabel adds the volumes carrying this label ("key" or "key=value").
+	VolumeLabel string `yaml:"volume_label"`
+	// ContainerLabel adds the volumes mounted by containers carrying this label.
+	ContainerLabel string `yaml:"container_label"`
+	// Containers is what happens to running containers using the volumes while they are archived:
+	// leave (default), pause or stop.
+	Containers string `yaml:"containers"`
+	Command    string `yaml:"command"` // Path of the docker binary
+}
+
+// SnapshotConfig describes the LVM, Btrfs or ZFS snapshot a files backup set is archived from.
+// The set's folders must lie below the snapshotted mountpoint.
+type SnapshotConfig struct {
+	Type string `yaml:"type"` // lvm, btrfs or zfs; empty disables snapshots
+	// Volume is the logical volume (vg/lv), the Btrfs subvolume path or the ZFS dataset.
+	Volume string `yaml:"volume"`
+	// Mountpoint is where the volume is mounted; required for LVM, taken from the dataset for ZFS.
+	Mountpoint   string `yaml:"mountpoint"`
+	Size         string `yaml:"size"`          // LVM copy-on-write space, default 1G
+	MountOptions string `yaml:"mount_options"` // For LVM snapshots, default "ro"
+}
+
+// IsDatabase reports whether the set dumps a database rather than archiving folders.
+func (b *BackupSet) IsDatabase() bool {
+	return b.Type == "postgres" || b.Type == "mysql"
+}
+
+// Hooks are shell commands run around the backup and restore of a set. A failing pre_backup or
+// pre_restore command aborts the operation. post_backup and post_restore run whenever the matching
+// pre hook succeeded, whatever the outcome, so they can undo what it did; on_failure runs in addition
+// when the backup failed.
+type Hooks struct {
+	PreBackup   []string      `yaml:"pre_backup"`
+	PostBackup  []string      `yaml:"post_backup"`
+	OnFailure   []string      `yaml:"on_failure"`
+	PreRestore  []string      `yaml:"pre_restore"`
+	PostRestore []string      `yaml:"post_restore"`
+	Timeout     time.Duration `yaml:"timeout"` // Per command, default 5m
+}
+
+// Destination is a named storage target.
+type Destination struct {
+	Name   string       `yaml:"name"`
+	Type   string       `yaml:"type"` // s3 (default), local, sftp, webdav, azure or gcs
+	S3     S3Config     `yaml:"s3"`
+	Local  LocalConfig  `yaml:"local"`
+	SFTP   SFTPConfig   `yaml:"sftp"`
+	WebDAV WebDAVConfig `yaml:"webdav"`
+	Azure  AzureConfig  `yaml:"azure"`
+	GCS    GCSConfig    `yaml:"gcs"`
+}
+
+// S3Config configures a backup destination on S3 or an S3-compatible service.
+// Without access keys the default AWS credential chain is used (environment, profiles, SSO, instance roles).
+type S3Config struct {
+	Bucket          string `yaml:"bucket"`
+	Region          string `yaml:"region"`
+	Endpoint        string `yaml:"endpoint"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+	Profile         string `yaml:"profile"`           // Named profile from ~/.aws/config
+	RoleARN         string `yaml:"role_arn"`          // Role to assume via STS
+	ExternalID      string `yaml:"external_id"`       // Optional external ID for the assumed role
+	RoleSessionName string `yaml:"role_session_name"` // Default: backup-service
+	Prefix          string `yaml:"prefix"`
+	// Upload options apply to every archive; full and incremental override them per backup type.
+	S3UploadConfig `yaml:",inline"`
+	Full           S3UploadConfig `yaml:"full"`
+	Incremental    S3UploadConfig `yaml:"incremental"`
+}
+
+// S3UploadConfig controls storage class, encryption, Object Lock and tagging of uploaded archives.
+type S3UploadConfig struct {
+	StorageClass   string            `yaml:"storage_class"`    // e.g. STANDARD_IA, GLACIER_IR
+	SSE            string            `yaml:"sse"`              // AES256 or aws:kms
+	SSEKMSKeyID    string            `yaml:"sse_kms_key_id"`   // Implies sse: aws:kms
+	ObjectLockMode string            `yaml:"object_lock_mode"` // GOVERNANCE or COMPLIANCE
+	ObjectLockDays int               `yaml:"object_lock_days"`
+	Tags           map[string]string `yaml:"tags"`
+}
+
+func (u *S3UploadConfig) validate() error {
+	switch strings.ToUpper(u.ObjectLockMode) {
+	case "":
+	case "GOVERNANCE", "COMPLIANCE":
+		if u.ObjectLockDays <= 0 {
+			return errors.New("object_lock_days must be positive when object_lock_mode is set")
+		}
+	default:
+		return fmt.Errorf("invalid object_lock_mode %q, expected GOVERNANCE or COMPLIANCE", u.ObjectLockMode)
+	}
+	switch u.SSE {
+	case "", "AES256", "aws:kms", "aws:kms:dsse":
+	default:
+		return fmt.Errorf("invalid sse %q, expected AES256 or aws:kms", u.SSE)
+	}
+	return nil
+}
+
+// LocalConfig configures a backup destination on a local or mounted filesystem.
+type LocalConfig struct {
+	Path   string `yaml:"path"`
+	Prefix string `yaml:"prefix"`
+}
+
+// SFTPConfig configures a backup destination reachable over SFTP.
+type SFTPConfig struct {
+	Host                  string `yaml:"host"`
+	Port                  int    `yaml:"port"`
+	User                  string `yaml:"user"`
+	Password              string `yaml:"password"`
+	PrivateKeyPath        string `yaml:"private_key_path"`
+	KnownHostsPath        string `yaml:"known_hosts_path"`
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key"`
+	Path                  string `yaml:"path"`
+	Prefix                string `yaml:"prefix"`
+}
+
+// WebDAVConfig configures a backup destination on a WebDAV server.
+type WebDAVConfig struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Prefix   string `yaml:"prefix"`
+}
+
+// AzureConfig configures a backup destination in Azure Blob Storage.
+type AzureConfig struct {
+	ConnectionString string `yaml:"connection_string"`
+	AccountName      string `yaml:"account_name"`
+	AccountKey       string `yaml:"account_key"`
+	Endpoint         string `yaml:"endpoint"` // Optional: service URL, e.g. for Azurite or a SAS URL
+	Container        string `yaml:"container"`
+	Prefix           string `yaml:"prefix"`
+}
+
+// GCSConfig configures a backup destination in Google Cloud Storage.
+type GCSConfig struct {
+	Bucket          string `yaml:"bucket"`
+	CredentialsFile string `yaml:"credentials_file"` // Service account JSON key file
+	CredentialsJSON string `yaml:"credentials_json"` // Service account JSON key content
+	Endpoint        string `yaml:"endpoint"`         // Optional: e.g. for fake-gcs-server
+	Anonymous       bool   `yaml:"anonymous"`        // Skip authentication, for emulators
+	Prefix          string `yaml:"prefix"`
+}
+
+// TransferConfig limits bandwidth and tunes multipart transfers.
+type TransferConfig struct {
+	UploadLimit   ByteSize `yaml:"upload_limit"`   // Bytes per second across all uploads, 0 = unlimited
+	DownloadLimit ByteSize `yaml:"download_limit"` // Bytes per second across all downloads, 0 = unlimited
+	PartSize      ByteSize `yaml:"part_size"`      // Multipart chunk size, default 16MB
+	Concurrency   int      `yaml:"concurrency"`    // Parts uploaded in parallel, default 4
+	// Schedule overrides the limits during time-of-day windows; the first matching window wins.
+	Schedule []BandwidthWindow `yaml:"bandwidth_schedule"`
+}
+
+// BandwidthWindow applies different limits between two local times of day, e.g. office hours.
+// A window whose end is before its start wraps around midnight.
+type BandwidthWindow struct {
+	From          string   `yaml:"from"` // HH:MM
+	To            string   `yaml:"to"`   // HH:MM
+	UploadLimit   ByteSize `yaml:"upload_limit"`
+	DownloadLimit ByteSize `yaml:"download_limit"`
+}
+
+// Limits returns the upload and download limits in effect at the given time.
+func (t *TransferConfig) Limits(now time.Time) (upload, download int64) {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range t.Schedule {
+		from, _ := parseTimeOfDay(w.From)
+		to, _ := parseTimeOfDay(w.To)
+		inside := from <= minute && minute < to
+		if to < from {
+			inside = minute >= from || minute < to
+		}
+		if inside {
+			return int64(w.UploadLimit), int64(w.DownloadLimit)
+		}
+	}
+	return int64(t.UploadLimit), int64(t.DownloadLimit)
+}
+
+func (t *TransferConfig) validate() error {
+	if t.PartSize != 0 && t.PartSize < 5<<20 {
+		return errors.New("transfer part_size must be at least 5MB")
+	}
+	for i, w := range t.Schedule {
+		if _, err := parseTimeOfDay(w.From); err != nil {
+			return fmt.Errorf("bandwidth_schedule #%d: %w", i+1, err)
+		}
+		if _, err := parseTimeOfDay(w.To); err != nil {
+			return fmt.Errorf("bandwidth_schedule #%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// parseTimeOfDay converts HH:MM into minutes since midnight.
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ByteSize is a number of bytes that can be written with a unit suffix, e.g. 512KB, 10MB or 1GB.
+// Units are powers of 1024.
+type ByteSize int64
+
+// UnmarshalYAML parses plain numbers as well as sizes with units.
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	s := strings.ToUpper(strings.TrimSpace(value.Value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value.Value)
+	}
+	*b = ByteSize(n * float64(multiplier))
+	return nil
 }
 
 // LoadConfig loads the configuration from a YAML file.
@@ -59,9 +524,314 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Retention.Monthly == 0 {
 		cfg.Retention.Monthly = 1
 	}
+	if cfg.StateDir == "" {
+		cfg.StateDir = DefaultStateDir()
+	}
+	if err := checkStateDir(cfg.StateDir); err != nil {
+		return nil, err
+	}
+	if cfg.Retry.Attempts == 0 {
+		cfg.Retry.Attempts = 5
+	}
+	if cfg.Retry.InitialDelay == 0 {
+		cfg.Retry.InitialDelay = time.Second
+	}
+	if cfg.Retry.MaxDelay == 0 {
+		cfg.Retry.MaxDelay = time.Minute
+	}
+	if cfg.Transfer.PartSize == 0 {
+		cfg.Transfer.PartSize = 16 << 20
+	}
+	if cfg.Transfer.Concurrency <= 0 {
+		cfg.Transfer.Concurrency = 4
+	}
+	if err := cfg.Transfer.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Lock.TTL <= 0 {
+		cfg.Lock.TTL = time.Hour
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if err := cfg.Resources.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Storage == "" {
+		cfg.Storage = "s3"
+	}
 	if cfg.Schedule == "" {
 		cfg.Schedule = "0 0 * * *" // Daily at midnight
 	}
+	if len(cfg.Destinations) == 0 {
+		cfg.Destinations = []Destination{{
+			Name:   "default",
+			Type:   cfg.Storage,
+			S3:     cfg.S3,
+			Local:  cfg.Local,
+			SFTP:   cfg.SFTP,
+			WebDAV: cfg.WebDAV,
+			Azure:  cfg.Azure,
+			GCS:    cfg.GCS,
+		}}
+	}
+
+	if cfg.Telegram.Enabled && cfg.Telegram.BotToken != "" && cfg.Telegram.ChatID != "" {
+		cfg.Notifications = append(cfg.Notifications, NotificationChannel{Name: "telegram", Type: "telegram", Telegram: cfg.Telegram})
+	}
+
+	if cfg.TelegramBot.Enabled {
+		if cfg.TelegramBot.BotToken == "" {
+			cfg.TelegramBot.BotToken = cfg.Telegram.BotToken
+		}
+		if len(cfg.TelegramBot.AllowedChats) == 0 && cfg.Telegram.ChatID != "" {
+			cfg.TelegramBot.AllowedChats = []string{cfg.Telegram.ChatID}
+		}
+		if cfg.TelegramBot.PollTimeout <= 0 {
+			cfg.TelegramBot.PollTimeout = 30 * time.Second
+		}
+		if cfg.TelegramBot.BotToken == "" || len(cfg.TelegramBot.AllowedChats) == 0 {
+			return nil, errors.New("telegram_bot requires a bot_token and allowed_chats")
+		}
+	}
+
+	if cfg.API.Listen != "" && cfg.API.Token == "" {
+		return nil, errors.New("api requires a token")
+	}
+
+	if cfg.Tracing.Endpoint != "" {
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("tracing endpoint %q must be an http or https URL", cfg.Tracing.Endpoint)
+		}
+		if cfg.Tracing.ServiceName == "" {
+			cfg.Tracing.ServiceName = "backup-service"
+		}
+	}
+
+	if err := cfg.validateDestinations(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateNotifications(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateBackups(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
+
+// BackupSet returns the backup set with the given name.
+func (c *Config) BackupSet(name string) (*BackupSet, bool) {
+	for i := range c.Backups {
+		if c.Backups[i].Name == name {
+			return &c.Backups[i], true
+		}
+	}
+	return nil, false
+}
+
+// Destination returns the destination with the given name.
+func (c *Config) Destination(name string) (*Destination, bool) {
+	for i := range c.Destinations {
+		if c.Destinations[i].Name == name {
+			return &c.Destinations[i], true
+		}
+	}
+	return nil, false
+}
+
+// SetDestinations returns the names of the destinations a backup set is uploaded to, primary first.
+func (c *Config) SetDestinations(b *BackupSet) []string {
+	if len(b.Destinations) > 0 {
+		return b.Destinations
+	}
+	names := make([]string, 0, len(c.Destinations))
+	for _, d := range c.Destinations {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func (c *Config) validateDestinations() error {
+	seen := make(map[string]bool)
+	for i := range c.Destinations {
+		d := &c.Destinations[i]
+		if d.Name == "" {
+			return fmt.Errorf("destination #%d has no name", i+1)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate destination name %q", d.Name)
+		}
+		seen[d.Name] = true
+		if d.Type == "" {
+			d.Type = "s3"
+		}
+		for _, u := range []*S3UploadConfig{&d.S3.S3UploadConfig, &d.S3.Full, &d.S3.Incremental} {
+			if err := u.validate(); err != nil {
+				return fmt.Errorf("destination %s: %w", d.Name, err)
+			}
+		}
+	}
+	for _, b := range c.Backups {
+		for _, name := range b.Destinations {
+			if !seen[name] {
+				return fmt.Errorf("backup %s refers to unknown destination %q", b.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateNotifications() error {
+	seen := make(map[string]bool)
+	for i := range c.Notifications {
+		n := &c.Notifications[i]
+		if n.Name == "" {
+			n.Name = n.Type
+		}
+		if seen[n.Name] {
+			return fmt.Errorf("duplicate notification channel name %q", n.Name)
+		}
+		seen[n.Name] = true
+
+		for _, severity := range n.Severities {
+			if severity != "success" && severity != "warning" && severity != "failure" {
+				return fmt.Errorf("notification %s: invalid severity %q, expected success, warning or failure", n.Name, severity)
+			}
+		}
+		if n.Digest.Schedule != "" {
+			if _, err := cron.ParseStandard(n.Digest.Schedule); err != nil {
+				return fmt.Errorf("notification %s: invalid digest schedule %q: %w", n.Name, n.Digest.Schedule, err)
+			}
+		}
+
+		var missing string
+		switch n.Type {
+		case "telegram":
+			if n.Telegram.BotToken == "" || n.Telegram.ChatID == "" {
+				missing = "telegram bot_token and chat_id"
+			}
+			switch n.Telegram.ParseMode {
+			case "":
+				n.Telegram.ParseMode = "HTML"
+			case "HTML", "MarkdownV2", "none":
+			default:
+				return fmt.Errorf("notification %s: invalid telegram parse_mode %q, expected HTML, MarkdownV2 or none", n.Name, n.Telegram.ParseMode)
+			}
+		case "slack":
+			if n.Slack.WebhookURL == "" {
+				missing = "slack webhook_url"
+			}
+		case "email":
+			if n.Email.Host == "" || n.Email.From == "" || len(n.Email.To) == 0 {
+				missing = "email host, from and to"
+			}
+			switch n.Email.TLS {
+			case "", "starttls", "implicit", "none":
+			default:
+				return fmt.Errorf("notification %s: invalid email tls %q, expected starttls, implicit or none", n.Name, n.Email.TLS)
+			}
+		case "webhook":
+			if n.Webhook.URL == "" {
+				missing = "webhook url"
+			}
+		case "ntfy":
+			if n.Ntfy.Topic == "" {
+				missing = "ntfy topic"
+			}
+		case "gotify":
+			if n.Gotify.URL == "" || n.Gotify.Token == "" {
+				missing = "gotify url and token"
+			}
+		default:
+			return fmt.Errorf("notification %s: unknown type %q, expected telegram, slack, email, webhook, ntfy or gotify", n.Name, n.Type)
+		}
+		if missing != "" {
+			return fmt.Errorf("notification %s: %s required", n.Name, missing)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateBackups() error {
+	for i := range c.Backups {
+		b := &c.Backups[i]
+		if b.Type == "" {
+			b.Type = "files"
+		}
+		switch b.TarWarnings {
+		case "":
+			b.TarWarnings = "warn"
+		case "warn", "ignore", "fail":
+		default:
+			return fmt.Errorf("backup %s: invalid tar_warnings %q, expected warn, ignore or fail", b.Name, b.TarWarnings)
+		}
+		if err := b.Snapshot.validate(b); err != nil {
+			return fmt.Errorf("backup %s: %w", b.Name, err)
+		}
+		if b.Heartbeat.URL != "" {
+			switch b.Heartbeat.Type {
+			case "":
+				b.Heartbeat.Type = "healthchecks"
+			case "healthchecks", "uptime-kuma":
+			default:
+				return fmt.Errorf("backup %s: invalid heartbeat type %q, expected healthchecks or uptime-kuma", b.Name, b.Heartbeat.Type)
+			}
+		}
+		switch b.Type {
+		case "files":
+		case "postgres", "mysql":
+			if b.Database.Name == "" && !b.Database.All {
+				return fmt.Errorf("backup %s: database name is required unless all is set", b.Name)
+			}
+		case "docker":
+			d := &b.Docker
+			if len(d.Volumes) == 0 && d.VolumeLabel == "" && d.ContainerLabel == "" {
+				return fmt.Errorf("backup %s: docker sets need volumes, volume_label or container_label", b.Name)
+			}
+			if d.Containers == "" {
+				d.Containers = "leave"
+			}
+			if d.Containers != "leave" && d.Containers != "pause" && d.Containers != "stop" {
+				return fmt.Errorf("backup %s: invalid docker containers mode %q, expected leave, pause or stop", b.Name, d.Containers)
+			}
+		default:
+			return fmt.Errorf("backup %s: unknown type %q, expected files, postgres, mysql or docker", b.Name, b.Type)
+		}
+	}
+	return nil
+}
+
+func (s *SnapshotConfig) validate(b *BackupSet) error {
+	switch s.Type {
+	case "":
+		return nil
+	case "lvm":
+		if s.Mountpoint == "" {
+			return errors.New("lvm snapshots need the mountpoint of the logical volume")
+		}
+	case "btrfs":
+		s.Mountpoint = s.Volume
+	case "zfs":
+	default:
+		return fmt.Errorf("unknown snapshot type %q, expected lvm, btrfs or zfs", s.Type)
+	}
+	if b.Type != "files" {
+		return errors.New("snapshots are only supported for files backup sets")
+	}
+	if s.Volume == "" {
+		return fmt.Errorf("%s snapshots need a volume", s.Type)
+	}
+	if s.Mountpoint == "" {
+		return nil
+	}
+	mountpoint := filepath.Clean(s.Mountpoint)
+	for _, folder := range b.Folders {
+		folder = filepath.Clean(folder)
+		if folder != mountpoint && !strings.HasPrefix(folder, strings.TrimSuffix(mountpoint, "/")+"/") {
+			return fmt.Errorf("folder %s is not below the snapshot mountpoint %s", folder, mountpoint)
+		}
+	}
+	return nil
+}
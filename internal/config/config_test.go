@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -48,3 +51,468 @@ retention:
 		t.Errorf("expected default monthly 1, got %d", cfg.Retention.Monthly)
 	}
 }
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigLegacyDestination(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+backups:
+  - name: "test"
+    folders: ["/tmp"]
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if len(cfg.Destinations) != 1 {
+		t.Fatalf("expected 1 destination, got %d", len(cfg.Destinations))
+	}
+	d := cfg.Destinations[0]
+	if d.Name != "default" || d.Type != "s3" || d.S3.Bucket != "test-bucket" {
+		t.Errorf("unexpected default destination: %+v", d)
+	}
+	if got := cfg.SetDestinations(&cfg.Backups[0]); len(got) != 1 || got[0] != "default" {
+		t.Errorf("expected set to use default destination, got %v", got)
+	}
+}
+
+func TestLoadConfigDestinations(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+destinations:
+  - name: "cloud"
+    s3:
+      bucket: "cloud-bucket"
+  - name: "nas"
+    type: "local"
+    local:
+      path: "/mnt/nas"
+backups:
+  - name: "web"
+    folders: ["/var/www"]
+    destinations: ["nas", "cloud"]
+  - name: "home"
+    folders: ["/home"]
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if d, ok := cfg.Destination("cloud"); !ok || d.Type != "s3" {
+		t.Errorf("expected cloud destination to default to s3, got %+v", d)
+	}
+	if got := cfg.SetDestinations(&cfg.Backups[0]); len(got) != 2 || got[0] != "nas" {
+		t.Errorf("expected nas to be primary for web, got %v", got)
+	}
+	if got := cfg.SetDestinations(&cfg.Backups[1]); len(got) != 2 || got[0] != "cloud" {
+		t.Errorf("expected home to use all destinations, got %v", got)
+	}
+}
+
+func TestLoadConfigUnknownDestination(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, `
+destinations:
+  - name: "cloud"
+backups:
+  - name: "web"
+    destinations: ["offsite"]
+`))
+	if err == nil {
+		t.Fatal("expected error for unknown destination")
+	}
+}
+
+func TestLoadConfigS3UploadOptions(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+  sse: "aws:kms"
+  sse_kms_key_id: "key-id"
+  tags:
+    env: "prod"
+  full:
+    storage_class: "GLACIER_IR"
+    object_lock_mode: "COMPLIANCE"
+    object_lock_days: 30
+  incremental:
+    storage_class: "STANDARD_IA"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	s3 := cfg.Destinations[0].S3
+	if s3.SSEKMSKeyID != "key-id" || s3.Tags["env"] != "prod" {
+		t.Errorf("unexpected base upload options: %+v", s3.S3UploadConfig)
+	}
+	if s3.Full.StorageClass != "GLACIER_IR" || s3.Full.ObjectLockDays != 30 {
+		t.Errorf("unexpected full upload options: %+v", s3.Full)
+	}
+	if s3.Incremental.StorageClass != "STANDARD_IA" {
+		t.Errorf("unexpected incremental upload options: %+v", s3.Incremental)
+	}
+}
+
+func TestLoadConfigInvalidObjectLock(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+  object_lock_mode: "COMPLIANCE"
+`))
+	if err == nil {
+		t.Fatal("expected error for object lock without retention days")
+	}
+}
+
+func TestLoadConfigRetry(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+retry:
+  attempts: 8
+  initial_delay: 2s
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Retry.Attempts != 8 {
+		t.Errorf("expected 8 attempts, got %d", cfg.Retry.Attempts)
+	}
+	if cfg.Retry.InitialDelay != 2*time.Second {
+		t.Errorf("expected initial delay 2s, got %s", cfg.Retry.InitialDelay)
+	}
+	if cfg.Retry.MaxDelay != time.Minute {
+		t.Errorf("expected default max delay 1m, got %s", cfg.Retry.MaxDelay)
+	}
+}
+
+func TestLoadConfigTransfer(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+transfer:
+  upload_limit: 10MB
+  download_limit: 1536
+  part_size: 64MiB
+  bandwidth_schedule:
+    - from: "08:00"
+      to: "19:00"
+      upload_limit: 512KB
+    - from: "22:00"
+      to: "02:00"
+      upload_limit: 0
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Transfer.PartSize != 64<<20 || cfg.Transfer.Concurrency != 4 {
+		t.Errorf("unexpected part size %d or concurrency %d", cfg.Transfer.PartSize, cfg.Transfer.Concurrency)
+	}
+
+	day := func(h, m int) time.Time { return time.Date(2025, 1, 1, h, m, 0, 0, time.Local) }
+	tests := []struct {
+		at       time.Time
+		upload   int64
+		download int64
+	}{
+		{day(12, 0), 512 << 10, 0},
+		{day(19, 0), 10 << 20, 1536},
+		{day(23, 30), 0, 0},
+		{day(1, 59), 0, 0},
+		{day(7, 59), 10 << 20, 1536},
+	}
+	for _, tt := range tests {
+		up, down := cfg.Transfer.Limits(tt.at)
+		if up != tt.upload || down != tt.download {
+			t.Errorf("at %s: expected %d/%d, got %d/%d", tt.at.Format("15:04"), tt.upload, tt.download, up, down)
+		}
+	}
+}
+
+func TestLoadConfigInvalidTransfer(t *testing.T) {
+	for _, transfer := range []string{"part_size: 1MB", "upload_limit: fast", "bandwidth_schedule: [{from: \"8am\", to: \"19:00\"}]"} {
+		_, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\ntransfer:\n  "+transfer+"\n"))
+		if err == nil {
+			t.Errorf("expected error for %q", transfer)
+		}
+	}
+}
+
+func TestLoadConfigDatabaseSets(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+backups:
+  - name: "files"
+    folders: ["/srv"]
+  - name: "shop"
+    type: postgres
+    database:
+      host: db
+      name: shop
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Backups[0].Type != "files" || cfg.Backups[0].IsDatabase() {
+		t.Errorf("expected default files type, got %q", cfg.Backups[0].Type)
+	}
+	if !cfg.Backups[1].IsDatabase() || cfg.Backups[1].Database.Host != "db" {
+		t.Errorf("unexpected database set %+v", cfg.Backups[1])
+	}
+
+	for _, set := range []string{"type: mongo", "type: mysql"} {
+		_, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nbackups:\n  - name: x\n    "+set+"\n"))
+		if err == nil {
+			t.Errorf("expected error for %q", set)
+		}
+	}
+}
+
+func TestLoadConfigDockerSets(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+backups:
+  - name: "apps"
+    type: docker
+    docker:
+      container_label: "backup=true"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Backups[0].Docker.Containers != "leave" {
+		t.Errorf("expected containers to be left running by default, got %q", cfg.Backups[0].Docker.Containers)
+	}
+
+	for _, set := range []string{"type: docker", "type: docker\n    docker: {volumes: [data], containers: kill}"} {
+		_, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nbackups:\n  - name: x\n    "+set+"\n"))
+		if err == nil {
+			t.Errorf("expected error for %q", set)
+		}
+	}
+}
+
+func TestLoadConfigSnapshots(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+backups:
+  - name: "home"
+    folders: ["/home/alice", "/home/bob"]
+    snapshot:
+      type: btrfs
+      volume: /home
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Backups[0].Snapshot.Mountpoint != "/home" {
+		t.Errorf("expected the btrfs subvolume to be the mountpoint, got %q", cfg.Backups[0].Snapshot.Mountpoint)
+	}
+
+	for _, snapshot := range []string{
+		"{type: ext4, volume: /srv}",
+		"{type: lvm, volume: vg0/srv}",
+		"{type: lvm, volume: vg0/data, mountpoint: /data}",
+		"{type: zfs}",
+	} {
+		_, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nbackups:\n  - name: x\n    folders: [/srv/app]\n    snapshot: "+snapshot+"\n"))
+		if err == nil {
+			t.Errorf("expected error for %q", snapshot)
+		}
+	}
+}
+
+func TestLoadConfigTarWarnings(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nbackups:\n  - name: x\n    folders: [/srv]\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Backups[0].TarWarnings != "warn" {
+		t.Errorf("expected warn by default, got %q", cfg.Backups[0].TarWarnings)
+	}
+	if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nbackups:\n  - name: x\n    tar_warnings: panic\n")); err == nil {
+		t.Error("expected error for an unknown tar_warnings policy")
+	}
+}
+
+func TestLoadConfigNotifications(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+telegram:
+  enabled: true
+  bot_token: "t"
+  chat_id: "1"
+notifications:
+  - type: slack
+    slack:
+      webhook_url: "https://hooks.slack.com/services/x"
+  - name: ops-mail
+    type: email
+    email:
+      host: smtp.example.com
+      from: backup@example.com
+      to: [ops@example.com]
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	var names []string
+	for _, n := range cfg.Notifications {
+		names = append(names, n.Name)
+	}
+	if fmt.Sprint(names) != "[slack ops-mail telegram]" {
+		t.Errorf("unexpected channels %v", names)
+	}
+
+	for _, channels := range []string{
+		"[{type: pager}]",
+		"[{type: ntfy}]",
+		"[{type: email, email: {host: h, from: f, to: [t], tls: ssl}}]",
+		"[{type: slack, slack: {webhook_url: u}}, {type: slack, slack: {webhook_url: v}}]",
+	} {
+		if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nnotifications: "+channels+"\n")); err == nil {
+			t.Errorf("expected error for %s", channels)
+		}
+	}
+}
+
+func TestLoadConfigNotificationRouting(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+notifications:
+  - name: pager
+    type: ntfy
+    ntfy: {topic: alerts}
+    severities: [failure]
+  - name: weekly
+    type: slack
+    slack: {webhook_url: "https://hooks.slack.com/x"}
+    digest:
+      schedule: "0 9 * * 1"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	pager, weekly := cfg.Notifications[0], cfg.Notifications[1]
+	if pager.Accepts("success") || !pager.Accepts("failure") || !weekly.Accepts("success") {
+		t.Errorf("unexpected severity filters %v, %v", pager.Severities, weekly.Severities)
+	}
+
+	for _, channel := range []string{
+		"{type: ntfy, ntfy: {topic: t}, severities: [fatal]}",
+		"{type: ntfy, ntfy: {topic: t}, digest: {schedule: weekly}}",
+	} {
+		if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nnotifications: ["+channel+"]\n")); err == nil {
+			t.Errorf("expected error for %s", channel)
+		}
+	}
+}
+
+func TestLoadConfigTelegramBot(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: "test-bucket"
+telegram:
+  bot_token: "T"
+  chat_id: "42"
+telegram_bot:
+  enabled: true
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	bot := cfg.TelegramBot
+	if bot.BotToken != "T" || fmt.Sprint(bot.AllowedChats) != "[42]" || bot.PollTimeout != 30*time.Second {
+		t.Errorf("unexpected bot defaults %+v", bot)
+	}
+
+	if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\ntelegram_bot:\n  enabled: true\n  bot_token: T\n")); err == nil {
+		t.Error("expected error for a bot without allowed chats")
+	}
+}
+
+func TestLoadConfigHeartbeat(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+s3:
+  bucket: b
+backups:
+  - name: x
+    folders: [/srv]
+    max_age: 26h
+    heartbeat:
+      url: "https://hc-ping.com/uuid"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if b := cfg.Backups[0]; b.Heartbeat.Type != "healthchecks" || b.MaxAge != 26*time.Hour {
+		t.Errorf("unexpected heartbeat %+v, max_age %s", b.Heartbeat, b.MaxAge)
+	}
+	if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nbackups:\n  - name: x\n    heartbeat: {type: pagerduty, url: x}\n")); err == nil {
+		t.Error("expected error for an unknown heartbeat type")
+	}
+}
+
+func TestLoadConfigTracing(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\ntracing:\n  endpoint: http://localhost:4318\n  headers: {authorization: Bearer x}\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Tracing.ServiceName != "backup-service" || cfg.Tracing.Headers["authorization"] != "Bearer x" {
+		t.Errorf("unexpected tracing config %+v", cfg.Tracing)
+	}
+	if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\ntracing:\n  endpoint: localhost:4318\n")); err == nil {
+		t.Error("expected error for an endpoint without scheme")
+	}
+}
+
+func TestLoadConfigAPI(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\napi:\n  listen: 127.0.0.1:8080\n  token: secret\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.API.Listen != "127.0.0.1:8080" || cfg.API.Token != "secret" {
+		t.Errorf("unexpected api config %+v", cfg.API)
+	}
+	if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\napi:\n  listen: :8080\n")); err == nil {
+		t.Error("expected error for an api without token")
+	}
+}
+
+func TestLoadConfigStateDir(t *testing.T) {
+	if got := defaultStateDir(0); got != "/var/lib/backup-service" {
+		t.Errorf("expected /var/lib for root, got %s", got)
+	}
+	t.Setenv("XDG_STATE_HOME", "/home/u/.state")
+	if got := defaultStateDir(1000); got != "/home/u/.state/backup-service" {
+		t.Errorf("expected the XDG state directory, got %s", got)
+	}
+
+	dir := t.TempDir()
+	cfg, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nstate_dir: "+dir+"\n"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.StateDir != dir {
+		t.Errorf("expected state_dir %s, got %s", dir, cfg.StateDir)
+	}
+	if err := os.Chmod(dir, 0o777); err != nil { // #nosec G302
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(writeConfig(t, "s3:\n  bucket: b\nstate_dir: "+dir+"\n")); err == nil {
+		t.Error("expected error for a world-writable state_dir")
+	}
+}
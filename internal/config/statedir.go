@@ -0,0 +1,52 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// DefaultStateDir returns /var/lib/backup-service when running as root, and the XDG state
+// directory of the user otherwise, so that the state survives reboots and tmp cleaners.
+func DefaultStateDir() string {
+	return defaultStateDir(os.Geteuid())
+}
+
+func defaultStateDir(euid int) string {
+	if euid == 0 {
+		return "/var/lib/backup-service"
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "backup-service")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "backup-service")
+	}
+	return "/var/lib/backup-service"
+}
+
+// checkStateDir refuses a state directory that another user could have prepared or could write
+// to, since it holds the archives waiting to be uploaded and the run lock. A directory that does
+// not exist yet is created by the first run.
+func checkStateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check state_dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("state_dir %s is not a directory", dir)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("state_dir %s is owned by uid %d, not by the current user", dir, st.Uid)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("state_dir %s is writable by other users (mode %s)", dir, info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package docker finds Docker volumes to back up and recreates them on restore, using the docker CLI.
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestName is the archive member listing the volumes stored in a docker backup.
+const ManifestName = "docker-volumes.json"
+
+// VolumesDir is the archive folder holding the contents of each volume, one sub-folder per volume name.
+const VolumesDir = "docker-volumes"
+
+// Volume is a named Docker volume as reported by docker volume inspect.
+type Volume struct {
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"`
+	Mountpoint string            `json:"Mountpoint"`
+	Labels     map[string]string `json:"Labels"`
+	Options    map[string]string `json:"Options"`
+}
+
+// Manifest records the volumes of a docker backup so that restore can recreate them by name.
+type Manifest struct {
+	Volumes []Volume `json:"volumes"`
+}
+
+// Client runs docker commands.
+type Client struct {
+	// Command is the docker binary, "docker" by default.
+	Command string
+}
+
+// NewClient returns a client using command, or "docker" when it is empty.
+func NewClient(command string) *Client {
+	if command == "" {
+		command = "docker"
+	}
+	return &Client{Command: command}
+}
+
+func (c *Client) run(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Command, args...) // #nosec G204
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("docker %s failed: %w, output: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Select returns the named volumes, the volumes carrying volumeLabel and the volumes mounted by
+// containers carrying containerLabel, sorted by name and without duplicates. Labels use docker's
+// filter syntax, "key" or "key=value".
+func (c *Client) Select(ctx context.Context, names []string, volumeLabel, containerLabel string) ([]Volume, error) {
+	set := make(map[string]bool)
+	for _, name := range names {
+		set[name] = true
+	}
+
+	if volumeLabel != "" {
+		out, err := c.run(ctx, "volume", "ls", "-q", "--filter", "label="+volumeLabel)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Fields(string(out)) {
+			set[name] = true
+		}
+	}
+
+	if containerLabel != "" {
+		out, err := c.run(ctx, "ps", "-a", "-q", "--filter", "label="+containerLabel)
+		if err != nil {
+			return nil, err
+		}
+		if ids := strings.Fields(string(out)); len(ids) > 0 {
+			var containers []struct {
+				Mounts []struct {
+					Type string `json:"Type"`
+					Name string `json:"Name"`
+				} `json:"Mounts"`
+			}
+			out, err := c.run(ctx, append([]string{"container", "inspect"}, ids...)...)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(out, &containers); err != nil {
+				return nil, fmt.Errorf("failed to parse container details: %w", err)
+			}
+			for _, container := range containers {
+				for _, m := range container.Mounts {
+					if m.Type == "volume" {
+						set[m.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	if len(set) == 0 {
+		return nil, nil
+	}
+	selected := make([]string, 0, len(set))
+	for name := range set {
+		selected = append(selected, name)
+	}
+	sort.Strings(selected)
+	return c.Inspect(ctx, selected...)
+}
+
+// Inspect returns the details of the named volumes.
+func (c *Client) Inspect(ctx context.Context, names ...string) ([]Volume, error) {
+	out, err := c.run(ctx, append([]string{"volume", "inspect"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	var volumes []Volume
+	if err := json.Unmarshal(out, &volumes); err != nil {
+		return nil, fmt.Errorf("failed to parse volume details: %w", err)
+	}
+	return volumes, nil
+}
+
+// Exists reports whether a volume with the given name exists.
+func (c *Client) Exists(ctx context.Context, name string) (bool, error) {
+	out, err := c.run(ctx, "volume", "ls", "-q", "--filter", "name=^"+name+"$")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) != "", nil
+}
+
+// Create creates a volume with the name, driver, labels and driver options of v and returns its details.
+func (c *Client) Create(ctx context.Context, v Volume) (*Volume, error) {
+	args := []string{"volume", "create"}
+	if v.Driver != "" {
+		args = append(args, "--driver", v.Driver)
+	}
+	for _, k := range sortedKeys(v.Labels) {
+		args = append(args, "--label", k+"="+v.Labels[k])
+	}
+	for _, k := range sortedKeys(v.Options) {
+		args = append(args, "--opt", k+"="+v.Options[k])
+	}
+	if _, err := c.run(ctx, append(args, v.Name)...); err != nil {
+		return nil, err
+	}
+	created, err := c.Inspect(ctx, v.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(created) != 1 {
+		return nil, fmt.Errorf("volume %s not found after creating it", v.Name)
+	}
+	return &created[0], nil
+}
+
+// RunningContainers returns the IDs of the running containers that mount any of the volumes.
+func (c *Client) RunningContainers(ctx context.Context, volumes []Volume) ([]string, error) {
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+	args := []string{"ps", "-q"}
+	for _, v := range volumes {
+		args = append(args, "--filter", "volume="+v.Name)
+	}
+	out, err := c.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Quiesce pauses or stops the containers, according to mode ("pause" or "stop"), and returns a
+// function that unpauses or starts them again. Containers already handled are resumed when a
+// later one fails.
+func (c *Client) Quiesce(ctx context.Context, mode string, ids []string) (resume func(context.Context) error, err error) {
+	var down, up string
+	switch mode {
+	case "pause":
+		down, up = "pause", "unpause"
+	case "stop":
+		down, up = "stop", "start"
+	default:
+		return nil, fmt.Errorf("unknown container mode %q, expected pause or stop", mode)
+	}
+
+	var done []string
+	resume = func(ctx context.Context) error {
+		if len(done) == 0 {
+			return nil
+		}
+		_, err := c.run(ctx, append([]string{up}, done...)...)
+		return err
+	}
+	for _, id := range ids {
+		if _, err := c.run(ctx, down, id); err != nil {
+			if rerr := resume(context.WithoutCancel(ctx)); rerr != nil {
+				return nil, fmt.Errorf("%w (and failed to %s the others: %v)", err, up, rerr)
+			}
+			return nil, err
+		}
+		done = append(done, id)
+	}
+	return resume, nil
+}
+
+// WriteManifest writes the manifest of volumes into dir and returns its path.
+func WriteManifest(dir string, volumes []Volume) (string, error) {
+	data, err := json.MarshalIndent(Manifest{Volumes: volumes}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode volume manifest: %w", err)
+	}
+	path := filepath.Join(dir, ManifestName)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write volume manifest: %w", err)
+	}
+	return path, nil
+}
+
+// ReadManifest reads the manifest restored into dir. It returns nil when there is none.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName)) // #nosec G304
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read volume manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse volume manifest: %w", err)
+	}
+	return &m, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
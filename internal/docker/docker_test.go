@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDocker is a stand-in docker CLI. Volumes are directories under $FAKE_DOCKER_DIR/volumes, the
+// "labeled" file lists the volumes matching any label filter and every call is appended to "calls".
+const fakeDocker = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_DIR/calls"
+case "$1 $2" in
+"volume ls")
+  case "$5" in
+  label=*) cat "$FAKE_DOCKER_DIR/labeled" ;;
+  name=*) n=${5#name=^}; n=${n%?}; [ -d "$FAKE_DOCKER_DIR/volumes/$n" ] && echo "$n" ;;
+  esac ;;
+"volume inspect")
+  shift 2; printf '['; sep=""
+  for n; do
+    printf '%s{"Name":"%s","Driver":"local","Mountpoint":"%s/volumes/%s","Labels":{"app":"web"}}' "$sep" "$n" "$FAKE_DOCKER_DIR" "$n"
+    sep=","
+  done
+  echo ']' ;;
+"volume create") eval n=\${$#}; mkdir -p "$FAKE_DOCKER_DIR/volumes/$n" ;;
+"ps -a"|"ps -q") echo c1; echo c2 ;;
+"container inspect") echo '[{"Mounts":[{"Type":"volume","Name":"db"},{"Type":"bind","Name":""}]}]' ;;
+"pause c2") echo "cannot pause" >&2; exit 1 ;;
+esac
+exit 0
+`
+
+// setupFakeDocker installs the stand-in docker CLI with the given volumes and returns its path and directory.
+func setupFakeDocker(t *testing.T, volumes ...string) (command, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	t.Setenv("FAKE_DOCKER_DIR", dir)
+	command = filepath.Join(dir, "docker")
+	if err := os.WriteFile(command, []byte(fakeDocker), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range volumes {
+		if err := os.MkdirAll(filepath.Join(dir, "volumes", v), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "labeled"), []byte("web\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return command, dir
+}
+
+func readCalls(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSelect(t *testing.T) {
+	command, dir := setupFakeDocker(t, "db", "web", "cache")
+	client := NewClient(command)
+
+	volumes, err := client.Select(context.Background(), []string{"cache"}, "backup", "app=shop")
+	if err != nil {
+		t.Fatalf("select failed: %v", err)
+	}
+	var names []string
+	for _, v := range volumes {
+		names = append(names, v.Name)
+	}
+	if fmt.Sprint(names) != "[cache db web]" {
+		t.Errorf("expected [cache db web], got %v", names)
+	}
+	if want := filepath.Join(dir, "volumes", "db"); volumes[1].Mountpoint != want {
+		t.Errorf("expected mountpoint %s, got %s", want, volumes[1].Mountpoint)
+	}
+	if !strings.Contains(readCalls(t, dir), "ps -a -q --filter label=app=shop") {
+		t.Errorf("containers were not selected by label:\n%s", readCalls(t, dir))
+	}
+}
+
+func TestQuiesceResumesOnFailure(t *testing.T) {
+	command, dir := setupFakeDocker(t)
+	client := NewClient(command)
+
+	if _, err := client.Quiesce(context.Background(), "pause", []string{"c1", "c2"}); err == nil {
+		t.Fatal("expected an error when a container cannot be paused")
+	}
+	if calls := readCalls(t, dir); calls != "pause c1\npause c2\nunpause c1\n" {
+		t.Errorf("unexpected calls:\n%s", calls)
+	}
+
+	resume, err := client.Quiesce(context.Background(), "stop", []string{"c1", "c2"})
+	if err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if err := resume(context.Background()); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if calls := readCalls(t, dir); !strings.HasSuffix(calls, "stop c1\nstop c2\nstart c1 c2\n") {
+		t.Errorf("unexpected calls:\n%s", calls)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	command, dir := setupFakeDocker(t)
+	client := NewClient(command)
+
+	v, err := client.Create(context.Background(), Volume{Name: "db", Driver: "local", Labels: map[string]string{"b": "2", "a": "1"}})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if v.Mountpoint != filepath.Join(dir, "volumes", "db") {
+		t.Errorf("unexpected mountpoint %s", v.Mountpoint)
+	}
+	if !strings.Contains(readCalls(t, dir), "volume create --driver local --label a=1 --label b=2 db") {
+		t.Errorf("unexpected calls:\n%s", readCalls(t, dir))
+	}
+	if ok, err := client.Exists(context.Background(), "db"); err != nil || !ok {
+		t.Errorf("expected db to exist, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package gcs provides a wrapper around the Google Cloud Storage SDK.
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	backend "github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+var _ backend.Backend = (*Client)(nil)
+
+// Options configures the Google Cloud Storage connection. Without explicit credentials the
+// application default credentials are used. Setting STORAGE_EMULATOR_HOST points the client
+// at an emulator such as fake-gcs-server.
+type Options struct {
+	Bucket string
+	Prefix string
+	// CredentialsFile is the path to a service account JSON key.
+	CredentialsFile string
+	// CredentialsJSON is the content of a service account JSON key.
+	CredentialsJSON string
+	// Endpoint overrides the API endpoint, e.g. http://localhost:4443/storage/v1/.
+	Endpoint string
+	// Anonymous disables authentication, for emulators and public buckets.
+	Anonymous bool
+	// UploadLimiter and DownloadLimiter, if set, throttle the data streams. They may be shared
+	// with other clients.
+	UploadLimiter   *ratelimit.Limiter
+	DownloadLimiter *ratelimit.Limiter
+}
+
+// Client is a wrapper around a Google Cloud Storage bucket handle.
+type Client struct {
+	client    *storage.Client
+	bucket    *storage.BucketHandle
+	prefix    string
+	upLimit   *ratelimit.Limiter
+	downLimit *ratelimit.Limiter
+}
+
+// NewClient creates a new Google Cloud Storage client for the configured bucket.
+func NewClient(ctx context.Context, opts Options) (*Client, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("gcs bucket is not configured")
+	}
+
+	var clientOpts []option.ClientOption
+	switch {
+	case opts.Anonymous:
+		clientOpts = append(clientOpts, option.WithoutAuthentication())
+	case opts.CredentialsJSON != "":
+		clientOpts = append(clientOpts, option.WithAuthCredentialsJSON(option.ServiceAccount, []byte(opts.CredentialsJSON)))
+	case opts.CredentialsFile != "":
+		clientOpts = append(clientOpts, option.WithAuthCredentialsFile(option.ServiceAccount, opts.CredentialsFile))
+	}
+	if opts.Endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(opts.Endpoint))
+	}
+
+	client, err := storage.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcs client: %w", err)
+	}
+	return &Client{
+		client:    client,
+		bucket:    client.Bucket(opts.Bucket),
+		prefix:    opts.Prefix,
+		upLimit:   opts.UploadLimiter,
+		downLimit: opts.DownloadLimiter,
+	}, nil
+}
+
+// Close releases the underlying connections.
+func (c *Client) Close() error {
+	if err := c.client.Close(); err != nil {
+		return fmt.Errorf("failed to close gcs client: %w", err)
+	}
+	return nil
+}
+
+// Put uploads a local file to the bucket.
+func (c *Client) Put(ctx context.Context, filePath string) error {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	key := path.Join(c.prefix, filepath.Base(filePath))
+	// Cancelling the writer's context aborts the upload, whereas closing it would finalize a
+	// truncated object under the archive name.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := c.bucket.Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, c.upLimit.Reader(ctx, file)); err != nil {
+		cancel()
+		return fmt.Errorf("failed to upload to gcs: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to upload to gcs: %w", err)
+	}
+	return nil
+}
+
+// Get downloads an object to a local target path.
+func (c *Client) Get(ctx context.Context, key, targetPath string) error {
+	r, err := c.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%s: %w", key, backend.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download from gcs: %w", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	file, err := os.Create(targetPath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := io.Copy(file, c.downLimit.Reader(ctx, r)); err != nil {
+		return fmt.Errorf("failed to download from gcs: %w", err)
+	}
+	return nil
+}
+
+// List lists all objects in the bucket under the configured prefix.
+func (c *Client) List(ctx context.Context) ([]string, error) {
+	var keys []string
+	it := c.bucket.Objects(ctx, &storage.Query{Prefix: c.prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list gcs objects: %w", err)
+		}
+		keys = append(keys, attrs.Name)
+	}
+	return keys, nil
+}
+
+// Delete deletes an object by its key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if err := c.bucket.Object(key).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete gcs object: %w", err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of an object.
+func (c *Client) Stat(ctx context.Context, key string) (*backend.ObjectInfo, error) {
+	attrs, err := c.bucket.Object(key).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, backend.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat gcs object: %w", err)
+	}
+	return &backend.ObjectInfo{Key: key, Size: attrs.Size, ModTime: attrs.Updated}, nil
+}
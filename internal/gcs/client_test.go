@@ -0,0 +1,44 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	backend "github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/mikhail-angelov/backup-service/internal/storage/storagetest"
+	"google.golang.org/api/option"
+)
+
+// TestBackendFakeGCS runs against a local fake-gcs-server, e.g.
+//
+//	docker run -p 4443:4443 fsouza/fake-gcs-server -scheme http
+//	STORAGE_EMULATOR_HOST=localhost:4443 go test ./internal/gcs/
+func TestBackendFakeGCS(t *testing.T) {
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST is not set")
+	}
+
+	ctx := context.Background()
+	bucket := fmt.Sprintf("backup-test-%d", time.Now().UnixNano())
+	admin, err := storage.NewClient(ctx, option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = admin.Close() }()
+	if err := admin.Bucket(bucket).Create(ctx, "test-project", nil); err != nil {
+		t.Fatalf("failed to create bucket: %v", err)
+	}
+
+	storagetest.Run(t, func(t *testing.T, prefix string) backend.Backend {
+		client, err := NewClient(ctx, Options{Bucket: bucket, Prefix: prefix, Anonymous: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	})
+}
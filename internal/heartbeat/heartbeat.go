@@ -0,0 +1,156 @@
+// Package heartbeat pings dead man's switch monitors such as healthchecks.io and Uptime Kuma push
+// monitors, which alert when the expected pings stop arriving.
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Monitor types.
+const (
+	TypeHealthchecks = "healthchecks"
+	TypeUptimeKuma   = "uptime-kuma"
+)
+
+// MaxBodySize is the largest log excerpt sent with a ping; healthchecks.io keeps up to 100 KB.
+const MaxBodySize = 10 << 10
+
+// maxMessageSize limits the status message of Uptime Kuma pings, which is sent in the URL.
+const maxMessageSize = 200
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Pinger reports the start and the outcome of a run to a monitor.
+type Pinger struct {
+	Type string // healthchecks (default) or uptime-kuma
+	URL  string
+}
+
+// Start signals that a run began, so that healthchecks.io can measure its duration and alert
+// when it never finishes. Uptime Kuma has no such signal and is not pinged.
+func (p *Pinger) Start(ctx context.Context) error {
+	if p.Type == TypeUptimeKuma {
+		return nil
+	}
+	return p.ping(ctx, strings.TrimSuffix(p.URL, "/")+"/start", "")
+}
+
+// Success signals a successful run, with body, e.g. an excerpt of its log, as details.
+func (p *Pinger) Success(ctx context.Context, body string) error {
+	if p.Type == TypeUptimeKuma {
+		return p.ping(ctx, kumaURL(p.URL, "up", body), "")
+	}
+	return p.ping(ctx, p.URL, body)
+}
+
+// Failure signals a failed run, with body describing what went wrong.
+func (p *Pinger) Failure(ctx context.Context, body string) error {
+	if p.Type == TypeUptimeKuma {
+		return p.ping(ctx, kumaURL(p.URL, "down", body), "")
+	}
+	return p.ping(ctx, strings.TrimSuffix(p.URL, "/")+"/fail", body)
+}
+
+// kumaURL sets the status and msg parameters of an Uptime Kuma push URL. The message is the last
+// line of body, since Uptime Kuma shows a single line.
+func kumaURL(pushURL, status, body string) string {
+	u, err := url.Parse(pushURL)
+	if err != nil {
+		return pushURL
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	msg := lines[len(lines)-1]
+	msg = msg[:headEnd(msg, maxMessageSize)]
+	if msg == "" {
+		msg = "OK"
+	}
+	q := u.Query()
+	q.Set("status", status)
+	q.Set("msg", msg)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (p *Pinger) ping(ctx context.Context, pingURL, body string) error {
+	body = body[tailStart(body, MaxBodySize):]
+	method := http.MethodGet
+	if body != "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, pingURL, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create heartbeat request: %w", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	resp, err := httpClient.Do(req) // #nosec G107
+	if err != nil {
+		return fmt.Errorf("failed to ping %s: %w", req.URL.Host, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("heartbeat %s returned status %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// Tail is an io.Writer keeping the last Limit bytes written to it, used to collect the end of a
+// run's log for pings.
+type Tail struct {
+	Limit int
+	mu    sync.Mutex
+	buf   []byte
+}
+
+// Write implements io.Writer.
+func (t *Tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if start := tailStart(t.buf, t.Limit); start > 0 {
+		t.buf = append(t.buf[:0], t.buf[start:]...)
+	}
+	return len(p), nil
+}
+
+// headEnd returns the length of the longest prefix of s that has at most n bytes and does not cut
+// a rune, so that truncated text stays valid UTF-8.
+func headEnd[T ~string | ~[]byte](s T, n int) int {
+	if len(s) <= n {
+		return len(s)
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+// tailStart returns where the longest suffix of s that has at most n bytes and does not cut a rune
+// begins.
+func tailStart[T ~string | ~[]byte](s T, n int) int {
+	if len(s) <= n {
+		return 0
+	}
+	i := len(s) - n
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
+}
+
+// String returns the collected text.
+func (t *Tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
@@ -0,0 +1,101 @@
+package heartbeat
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+type ping struct {
+	method, path, query, body string
+}
+
+func recorder(t *testing.T) (*httptest.Server, *[]ping) {
+	var pings []ping
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pings = append(pings, ping{r.Method, r.URL.Path, r.URL.RawQuery, string(body)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &pings
+}
+
+func TestHealthchecks(t *testing.T) {
+	srv, pings := recorder(t)
+	p := &Pinger{URL: srv.URL + "/uuid"}
+	ctx := context.Background()
+	if err := p.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Success(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Failure(ctx, strings.Repeat("x", MaxBodySize)+"tar failed"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := *pings
+	if len(got) != 3 || got[0].path != "/uuid/start" || got[1] != (ping{"GET", "/uuid", "", ""}) || got[2].path != "/uuid/fail" || got[2].method != "POST" {
+		t.Fatalf("unexpected pings %+v", got)
+	}
+	if len(got[2].body) != MaxBodySize || !strings.HasSuffix(got[2].body, "tar failed") {
+		t.Errorf("expected the end of the log as body, got %d bytes", len(got[2].body))
+	}
+}
+
+func TestFailureBodyTruncatesOnRuneBoundary(t *testing.T) {
+	srv, pings := recorder(t)
+	p := &Pinger{URL: srv.URL + "/uuid"}
+	if err := p.Failure(context.Background(), strings.Repeat("é", MaxBodySize)+"!"); err != nil {
+		t.Fatal(err)
+	}
+	body := (*pings)[0].body
+	if !utf8.ValidString(body) || len(body) != MaxBodySize-1 || !strings.HasSuffix(body, "é!") {
+		t.Errorf("expected a valid body of %d bytes, got %d bytes", MaxBodySize-1, len(body))
+	}
+}
+
+func TestUptimeKuma(t *testing.T) {
+	srv, pings := recorder(t)
+	p := &Pinger{Type: TypeUptimeKuma, URL: srv.URL + "/api/push/abc?ping="}
+	ctx := context.Background()
+	_ = p.Start(ctx)
+	if err := p.Failure(ctx, "starting\nupload to s3 failed"); err != nil {
+		t.Fatal(err)
+	}
+	got := *pings
+	if len(got) != 1 || got[0].path != "/api/push/abc" || got[0].query != "msg=upload+to+s3+failed&ping=&status=down" {
+		t.Fatalf("unexpected pings %+v", got)
+	}
+}
+
+func TestKumaURLTruncatesOnRuneBoundary(t *testing.T) {
+	u, err := url.Parse(kumaURL("https://kuma/api/push/abc", "down", "a"+strings.Repeat("é", maxMessageSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := u.Query().Get("msg")
+	if !utf8.ValidString(msg) || len(msg) != maxMessageSize-1 {
+		t.Errorf("expected a valid message of %d bytes, got %d bytes %q", maxMessageSize-1, len(msg), msg)
+	}
+}
+
+func TestTail(t *testing.T) {
+	tail := &Tail{Limit: 8}
+	_, _ = tail.Write([]byte("hello "))
+	_, _ = tail.Write([]byte("world"))
+	if got := tail.String(); got != "lo world" {
+		t.Errorf("expected the last 8 bytes, got %q", got)
+	}
+
+	tail = &Tail{Limit: 3}
+	_, _ = tail.Write([]byte("aéé"))
+	if got := tail.String(); got != "é" {
+		t.Errorf("expected the tail to start on a rune boundary, got %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+// Package history keeps the reports of past backup runs in a local bbolt database, so that runs
+// and the health of each set can be reviewed without the notifications or the destinations.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	bolt "go.etcd.io/bbolt"
+)
+
+// File is the name of the database in the state directory.
+const File = "history.db"
+
+// DefaultMaxRuns is the number of runs kept when DB.MaxRuns is not set.
+const DefaultMaxRuns = 1000
+
+// ErrBusy is returned by Open when another process holds the database for longer than the timeout.
+var ErrBusy = errors.New("history database is in use by another process")
+
+var runsBucket = []byte("runs")
+
+// DB is a run history. bbolt allows a single process to open the database, so callers should
+// close it as soon as they are done rather than keep it open for the lifetime of a daemon.
+type DB struct {
+	db *bolt.DB
+	// MaxRuns is the number of most recent runs kept by Add; older runs are dropped.
+	MaxRuns int
+}
+
+// Open opens the database at path, creating it and its directory if needed. It waits up to
+// timeout for another process to close it.
+func Open(path string, timeout time.Duration) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: timeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, ErrBusy
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(runsBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+	return &DB{db: db, MaxRuns: DefaultMaxRuns}, nil
+}
+
+// Close releases the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// runKey orders runs by start time; the run ID keeps runs started in the same nanosecond apart.
+func runKey(rep *report.Report) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(rep.Started.UnixNano())) // #nosec G115 -- times after 1970
+	return append(key, rep.RunID...)
+}
+
+// Add records a run and drops the oldest runs beyond MaxRuns.
+func (d *DB) Add(rep *report.Report) error {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket)
+		if err := b.Put(runKey(rep), data); err != nil {
+			return fmt.Errorf("failed to record run: %w", err)
+		}
+		maxRuns := d.MaxRuns
+		if maxRuns <= 0 {
+			maxRuns = DefaultMaxRuns
+		}
+		var old [][]byte
+		c := b.Cursor()
+		n := 0
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			if n++; n > maxRuns {
+				old = append(old, k)
+			}
+		}
+		for _, k := range old {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("failed to drop old run: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Runs returns up to limit runs, newest first, that include the given set; an empty set matches
+// every run and a limit of 0 returns all of them.
+func (d *DB) Runs(limit int, set string) ([]*report.Report, error) {
+	var runs []*report.Report
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(runs) < limit); k, v = c.Prev() {
+			var rep report.Report
+			if err := json.Unmarshal(v, &rep); err != nil {
+				return fmt.Errorf("failed to decode run %x: %w", k, err)
+			}
+			if _, ok := rep.Set(set); set == "" || ok {
+				runs = append(runs, &rep)
+			}
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// SetHealth summarizes the recorded runs of one set.
+type SetHealth struct {
+	Name    string    `json:"name"`
+	LastRun time.Time `json:"last_run,omitzero"`
+	// Status is the outcome of the latest run of the set.
+	Status      string    `json:"status,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	// Failures counts the consecutive failed runs up to the latest one.
+	Failures int `json:"failures"`
+	// Latest describes the set in its latest run.
+	Latest *report.Set `json:"latest,omitempty"`
+	// LastArchive describes the set in the latest run that created an archive.
+	LastArchive *report.Set `json:"last_archive,omitempty"`
+}
+
+// Health returns the health of the given sets, in the same order. Sets without any recorded run
+// only have a name.
+func (d *DB) Health(sets []string) ([]SetHealth, error) {
+	health := make([]SetHealth, len(sets))
+	index := make(map[string]int, len(sets))
+	for i, name := range sets {
+		health[i].Name = name
+		index[name] = i
+	}
+	done := make(map[string]bool, len(sets))
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(done) < len(sets); k, v = c.Prev() {
+			var rep report.Report
+			if err := json.Unmarshal(v, &rep); err != nil {
+				return fmt.Errorf("failed to decode run %x: %w", k, err)
+			}
+			for _, s := range rep.Sets {
+				i, ok := index[s.Name]
+				if !ok || done[s.Name] {
+					continue
+				}
+				h := &health[i]
+				if h.Latest == nil {
+					h.LastRun, h.Status, h.Latest = rep.Finished, s.Status(), &s
+				}
+				if h.LastArchive == nil && s.Archive != "" {
+					h.LastArchive = &s
+				}
+				if s.Status() == report.StatusFailure {
+					if h.LastSuccess.IsZero() {
+						h.Failures++
+					}
+				} else if h.LastSuccess.IsZero() {
+					h.LastSuccess = rep.Finished
+				}
+				if !h.LastSuccess.IsZero() && h.LastArchive != nil {
+					done[s.Name] = true
+				}
+			}
+		}
+		return nil
+	})
+	return health, err
+}
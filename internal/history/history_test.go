@@ -0,0 +1,108 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/report"
+)
+
+func run(id string, started time.Time, sets ...report.Set) *report.Report {
+	return &report.Report{RunID: id, Started: started, Finished: started.Add(time.Minute), Sets: sets}
+}
+
+func TestRuns(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "state", File), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	db.MaxRuns = 3
+
+	start := time.Date(2026, 10, 1, 3, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c", "d"} {
+		sets := []report.Set{{Name: "app", Archive: "app_" + id + ".tar.gz", Size: 10}}
+		if i%2 == 1 {
+			sets = append(sets, report.Set{Name: "db"})
+		}
+		if err := db.Add(run(id, start.Add(time.Duration(i)*time.Hour), sets...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := db.Runs(0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || runs[0].RunID != "d" || runs[2].RunID != "b" {
+		t.Fatalf("expected the 3 newest runs newest first, got %v", runIDs(runs))
+	}
+	if runs[0].Sets[0].Archive != "app_d.tar.gz" || !runs[0].Finished.Equal(start.Add(3*time.Hour+time.Minute)) {
+		t.Errorf("run not stored as recorded: %+v", runs[0])
+	}
+	if runs, _ := db.Runs(1, ""); len(runs) != 1 || runs[0].RunID != "d" {
+		t.Errorf("expected the newest run, got %v", runIDs(runs))
+	}
+	if runs, _ := db.Runs(0, "db"); len(runs) != 2 || runs[0].RunID != "d" || runs[1].RunID != "b" {
+		t.Errorf("expected the runs of db, got %v", runIDs(runs))
+	}
+}
+
+func TestHealth(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), File), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	start := time.Date(2026, 10, 1, 3, 0, 0, 0, time.UTC)
+	failed := report.Set{Name: "app", Errors: []string{"upload failed"}}
+	for i, sets := range [][]report.Set{
+		{{Name: "app", Archive: "app_1.tar.gz", Size: 42}, {Name: "db", Archive: "db_1.sql.gz"}},
+		{failed, {Name: "db", Archive: "db_2.sql.gz", Warnings: []string{"slow"}}},
+		{failed},
+	} {
+		if err := db.Add(run(string(rune('a'+i)), start.Add(time.Duration(i)*time.Hour), sets...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	health, err := db.Health([]string{"app", "db", "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, dbSet, fresh := health[0], health[1], health[2]
+	if app.Status != report.StatusFailure || app.Failures != 2 || !app.LastRun.Equal(start.Add(2*time.Hour+time.Minute)) ||
+		!app.LastSuccess.Equal(start.Add(time.Minute)) || app.LastArchive == nil || app.LastArchive.Size != 42 {
+		t.Errorf("unexpected app health %+v", app)
+	}
+	if dbSet.Status != report.StatusWarning || dbSet.Failures != 0 || dbSet.LastArchive.Archive != "db_2.sql.gz" ||
+		!dbSet.LastSuccess.Equal(dbSet.LastRun) {
+		t.Errorf("unexpected db health %+v", dbSet)
+	}
+	if fresh.Name != "new" || fresh.Latest != nil || !fresh.LastRun.IsZero() {
+		t.Errorf("expected no history for a new set, got %+v", fresh)
+	}
+}
+
+func TestOpenBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+	db, err := Open(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	if _, err := Open(path, 50*time.Millisecond); !errors.Is(err, ErrBusy) {
+		t.Errorf("expected ErrBusy while the database is open, got %v", err)
+	}
+}
+
+func runIDs(runs []*report.Report) []string {
+	ids := make([]string, len(runs))
+	for i, r := range runs {
+		ids[i] = r.RunID
+	}
+	return ids
+}
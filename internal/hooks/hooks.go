@@ -0,0 +1,95 @@
+// Package hooks runs user-defined shell commands around backups and restores.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+)
+
+// DefaultTimeout bounds a single hook command when no timeout is configured.
+const DefaultTimeout = 5 * time.Minute
+
+// Runner executes the commands of one hook phase.
+type Runner struct {
+	// Timeout bounds each command; zero means DefaultTimeout.
+	Timeout time.Duration
+	// Logger receives the commands and their output; nil means the logger of the context.
+	Logger *slog.Logger
+}
+
+// Run executes commands one by one with sh -c, stopping at the first failure. The variables in
+// env and BACKUP_HOOK, set to the phase, are added to the service's own environment.
+func (r *Runner) Run(ctx context.Context, phase string, commands []string, env map[string]string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	logger := r.Logger
+	if logger == nil {
+		logger = logging.FromContext(ctx)
+	}
+	logger = logger.With("hook", phase)
+
+	environ := append(os.Environ(), "BACKUP_HOOK="+phase)
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		environ = append(environ, k+"="+env[k])
+	}
+
+	for _, command := range commands {
+		logger.Info("Running hook", "command", command)
+		if err := runCommand(ctx, phase, command, environ, timeout, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCommand(ctx context.Context, phase, command string, environ []string, timeout time.Duration, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command) // #nosec G204
+	cmd.Env = environ
+	// Run the hook in its own process group so that a timeout also stops the commands it spawned.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if out := strings.TrimSpace(output.String()); out != "" {
+		for _, line := range strings.Split(out, "\n") {
+			logger.Info("Hook output", "output", line)
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s hook %q timed out after %s", phase, command, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook %q failed: %w", phase, command, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunPassesEnvironment(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	r := &Runner{}
+	err := r.Run(context.Background(), "pre_backup", []string{`echo "$BACKUP_SET $BACKUP_TYPE" > ` + out}, map[string]string{
+		"BACKUP_SET":  "web",
+		"BACKUP_TYPE": "full",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(data)) != "web full" {
+		t.Errorf("unexpected hook output %q", data)
+	}
+}
+
+func TestRunStopsAtFirstFailure(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	var logs bytes.Buffer
+	r := &Runner{Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+	err := r.Run(context.Background(), "pre_backup", []string{"echo failing >&2; exit 3", "touch " + marker}, nil)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected exit status error, got %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("expected commands after the failure to be skipped")
+	}
+	if !strings.Contains(logs.String(), "failing") {
+		t.Errorf("expected hook output to be logged, got %q", logs.String())
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	r := &Runner{Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err := r.Run(context.Background(), "post_backup", []string{"sleep 10"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("hook was not stopped at the timeout")
+	}
+}
@@ -0,0 +1,170 @@
+// Package localfs stores backups on a local or mounted filesystem, such as a NAS share.
+package localfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+var _ storage.Backend = (*Client)(nil)
+
+// Options configures a local filesystem client.
+type Options struct {
+	// Path is the root directory, e.g. the mount point of a NAS share.
+	Path   string
+	Prefix string
+	// UploadLimiter and DownloadLimiter, if set, throttle copies to and from the storage
+	// directory. They may be shared with other clients.
+	UploadLimiter   *ratelimit.Limiter
+	DownloadLimiter *ratelimit.Limiter
+}
+
+// Client stores backup files in a directory tree rooted at a local path.
+type Client struct {
+	root      string
+	prefix    string
+	upLimit   *ratelimit.Limiter
+	downLimit *ratelimit.Limiter
+}
+
+// NewClient creates a new local filesystem client. The root directory must already exist,
+// so that an unmounted NAS share is reported instead of silently filling the local disk.
+func NewClient(opts Options) (*Client, error) {
+	root := opts.Path
+	if root == "" {
+		return nil, errors.New("local storage path is not configured")
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access local storage path: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("local storage path %s is not a directory", root)
+	}
+	return &Client{root: root, prefix: opts.Prefix, upLimit: opts.UploadLimiter, downLimit: opts.DownloadLimiter}, nil
+}
+
+// Put copies a local file into the storage directory.
+func (c *Client) Put(ctx context.Context, filePath string) error {
+	key := path.Join(filepath.ToSlash(c.prefix), filepath.Base(filePath))
+	target := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Copy to a temporary name first so that an interrupted copy never looks like a complete backup.
+	tmpPath := target + ".partial"
+	if err := copyFile(ctx, c.upLimit, filePath, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	return nil
+}
+
+// Get copies a stored file to a local target path.
+func (c *Client) Get(ctx context.Context, key, targetPath string) error {
+	if _, err := os.Stat(c.path(key)); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+	}
+	return copyFile(ctx, c.downLimit, c.path(key), targetPath)
+}
+
+// List returns the keys of all files under the prefix directory.
+func (c *Client) List(_ context.Context) ([]string, error) {
+	prefix := filepath.ToSlash(c.prefix)
+	start := c.root
+	if prefix != "" {
+		// Walk only the directory containing the prefix instead of the whole share.
+		dir := prefix
+		if !strings.HasSuffix(prefix, "/") {
+			dir = path.Dir(prefix)
+		}
+		start = c.path(dir)
+	}
+
+	var keys []string
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".partial") {
+			return nil
+		}
+		rel, err := filepath.Rel(c.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list local storage: %w", err)
+	}
+	return keys, nil
+}
+
+// Delete removes a stored file.
+func (c *Client) Delete(_ context.Context, key string) error {
+	if err := os.Remove(c.path(key)); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of a stored file.
+func (c *Client) Stat(_ context.Context, key string) (*storage.ObjectInfo, error) {
+	info, err := os.Stat(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return &storage.ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (c *Client) path(key string) string {
+	return filepath.Join(c.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func copyFile(ctx context.Context, limit *ratelimit.Limiter, src, dst string) error {
+	in, err := os.Open(src) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(dst) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := io.Copy(out, limit.Reader(ctx, in)); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	return nil
+}
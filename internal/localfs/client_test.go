@@ -0,0 +1,48 @@
+package localfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/mikhail-angelov/backup-service/internal/storage/storagetest"
+)
+
+func TestBackend(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, prefix string) storage.Backend {
+		client, err := NewClient(Options{Path: t.TempDir(), Prefix: prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	})
+}
+
+func TestNewClientMissingRoot(t *testing.T) {
+	if _, err := NewClient(Options{Path: "/nonexistent/nas/mount"}); err == nil {
+		t.Error("expected error for missing root directory")
+	}
+}
+
+func TestPutThrottled(t *testing.T) {
+	client, err := NewClient(Options{Path: t.TempDir(), UploadLimiter: ratelimit.New(1 << 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "app_20250101000000.full.tar.gz")
+	if err := os.WriteFile(src, make([]byte, 64<<10), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Put(ctx, src); err == nil {
+		t.Error("expected the throttled copy to stop once the context is canceled")
+	}
+	if keys, _ := client.List(context.Background()); len(keys) != 0 {
+		t.Errorf("expected no archive after a failed copy, got %v", keys)
+	}
+}
@@ -0,0 +1,345 @@
+// Package lock prevents overlapping backup runs, both on one host and across hosts that share a destination.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+// ErrLocked is returned when a lock is held by another run.
+var ErrLocked = errors.New("locked by another run")
+
+// ErrLost is reported by Remote.Err when a remote lock expired because it could not be refreshed.
+var ErrLost = errors.New("lock lost")
+
+// ObjectName is the base name of the lock object kept in a destination.
+const ObjectName = "backup-service.lock"
+
+// Owner identifies the holder of a lock.
+type Owner struct {
+	// ID distinguishes runs, even of the same process.
+	ID         string    `json:"id"`
+	Hostname   string    `json:"hostname"`
+	PID        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+}
+
+func (o *Owner) String() string {
+	s := fmt.Sprintf("%s (pid %d) since %s", o.Hostname, o.PID, o.AcquiredAt.Format(time.RFC3339))
+	if !o.ExpiresAt.IsZero() {
+		s += fmt.Sprintf(", expires %s", o.ExpiresAt.Format(time.RFC3339))
+	}
+	return s
+}
+
+// Expired reports whether a remote lock has outlived its TTL.
+func (o *Owner) Expired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && now.After(o.ExpiresAt)
+}
+
+func (o *Owner) same(other *Owner) bool {
+	return o.ID == other.ID
+}
+
+func newOwner() Owner {
+	hostname, _ := os.Hostname()
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return Owner{ID: hex.EncodeToString(id), Hostname: hostname, PID: os.Getpid(), AcquiredAt: time.Now().UTC().Truncate(time.Second)}
+}
+
+// Local is an exclusive lock on a file in the state directory. The operating system releases it
+// when the process exits, so a crashed run never leaves it behind.
+type Local struct {
+	file *os.File
+}
+
+// AcquireLocal takes the lock on path without waiting. If another process holds it, the returned
+// error wraps ErrLocked and names the holder.
+func AcquireLocal(path string) (*Local, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil { // #nosec G115
+		defer func() { _ = file.Close() }()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			var owner Owner
+			if data, readErr := io.ReadAll(file); readErr == nil && json.Unmarshal(data, &owner) == nil {
+				return nil, fmt.Errorf("%w: %s", ErrLocked, owner.String())
+			}
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	owner := newOwner()
+	data, _ := json.Marshal(&owner)
+	if err := file.Truncate(0); err == nil {
+		_, _ = file.WriteAt(data, 0)
+	}
+	return &Local{file: file}, nil
+}
+
+// InspectLocal returns the owner of the lock on path, or nil if no running process holds it. It
+// only reads the owner record and checks that its process is alive, so it never keeps a run from
+// taking the lock.
+func InspectLocal(path string) (*Owner, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	// Release empties the file; a crashed run leaves its record behind with a dead PID.
+	var owner Owner
+	if len(data) == 0 || json.Unmarshal(data, &owner) != nil || !alive(owner.PID) {
+		return nil, nil
+	}
+	return &owner, nil
+}
+
+// alive reports whether a process with the given PID exists.
+func alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Release gives up the lock.
+func (l *Local) Release() error {
+	_ = l.file.Truncate(0)
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
+
+// Remote is a lock object stored in a destination, so that hosts sharing a bucket or path do not
+// write to the same backup chains at once. It expires after its TTL unless refreshed, which
+// happens in the background for as long as the lock is held.
+type Remote struct {
+	store storage.Backend
+	ttl   time.Duration
+	owner Owner
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu sync.Mutex
+	// expires is the expiry written by the last successful refresh.
+	expires time.Time
+	// lastErr is the failure of the latest refresh, if it failed.
+	lastErr error
+	lost    error
+}
+
+// AcquireRemote creates the lock object in store. If a lock held by someone else has not expired,
+// the returned error wraps ErrLocked and names the holder.
+func AcquireRemote(ctx context.Context, store storage.Backend, ttl time.Duration) (*Remote, error) {
+	current, _, err := Inspect(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && !current.Expired(time.Now()) {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, current.String())
+	}
+
+	r := &Remote{store: store, ttl: ttl, owner: newOwner()}
+	expires := time.Now().UTC().Add(ttl).Truncate(time.Second)
+	if err := r.write(ctx, expires); err != nil {
+		return nil, err
+	}
+	r.expires = expires
+	// Storage backends offer no compare-and-swap, so two hosts may write at the same moment.
+	// Reading the object back tells which write won.
+	current, _, err = Inspect(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || !current.same(&r.owner) {
+		if current == nil {
+			return nil, fmt.Errorf("%w: lock object disappeared while acquiring it", ErrLocked)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrLocked, current.String())
+	}
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.refresh()
+	return r, nil
+}
+
+// refresh extends the lock's expiry while it is held.
+func (r *Remote) refresh() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.renew()
+		}
+	}
+}
+
+// renew writes a new expiry. A write that hangs is given up before the next refresh is due, so
+// that Release never waits longer than that.
+func (r *Remote) renew() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.ttl/3)
+	defer cancel()
+	expires := time.Now().UTC().Add(r.ttl).Truncate(time.Second)
+	err := r.write(ctx, expires)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.lastErr = err
+	}
+	// Once the lock has lapsed another host may have taken it, so a later write does not restore it.
+	r.checkExpired()
+	if err == nil && r.lost == nil {
+		r.expires = expires
+		r.lastErr = nil
+	}
+}
+
+// checkExpired marks the lock as lost once its last written expiry has passed. r.mu must be held.
+func (r *Remote) checkExpired() {
+	if r.lost != nil || !time.Now().After(r.expires) {
+		return
+	}
+	if r.lastErr != nil {
+		r.lost = fmt.Errorf("%w: expired at %s after failed refreshes: %w", ErrLost, r.expires.Format(time.RFC3339), r.lastErr)
+	} else {
+		r.lost = fmt.Errorf("%w: expired at %s without being refreshed", ErrLost, r.expires.Format(time.RFC3339))
+	}
+}
+
+// Err returns an error wrapping ErrLost if the lock expired while it was held because refreshing
+// it failed. Another host may then have written to the destination during the run.
+func (r *Remote) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkExpired()
+	return r.lost
+}
+
+func (r *Remote) write(ctx context.Context, expires time.Time) error {
+	r.owner.ExpiresAt = expires
+	dir, err := os.MkdirTemp("", "backup-lock-")
+	if err != nil {
+		return fmt.Errorf("failed to create lock file: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, ObjectName)
+	data, err := json.Marshal(&r.owner)
+	if err != nil {
+		return fmt.Errorf("failed to encode lock: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to create lock file: %w", err)
+	}
+	put := r.store.Put
+	if p, ok := r.store.(storage.PlainPutter); ok {
+		put = p.PutPlain
+	}
+	if err := put(ctx, path); err != nil {
+		return fmt.Errorf("failed to write lock object: %w", err)
+	}
+	return nil
+}
+
+// Release stops refreshing the lock and deletes the lock object if it is still ours.
+func (r *Remote) Release(ctx context.Context) error {
+	close(r.stop)
+	<-r.done
+	current, key, err := Inspect(ctx, r.store)
+	if err != nil {
+		return err
+	}
+	if current == nil || !current.same(&r.owner) {
+		return nil
+	}
+	if err := r.store.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete lock object: %w", err)
+	}
+	return nil
+}
+
+// Inspect returns the current holder of the lock object in store and its key, or nil if there is none.
+func Inspect(ctx context.Context, store storage.Backend) (*Owner, string, error) {
+	key, err := findObject(ctx, store)
+	if err != nil || key == "" {
+		return nil, "", err
+	}
+
+	dir, err := os.MkdirTemp("", "backup-lock-")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lock object: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, ObjectName)
+	if err := store.Get(ctx, key, path); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("failed to read lock object: %w", err)
+	}
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lock object: %w", err)
+	}
+	var owner Owner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return nil, key, fmt.Errorf("failed to parse lock object %s: %w", key, err)
+	}
+	return &owner, key, nil
+}
+
+func findObject(ctx context.Context, store storage.Backend) (string, error) {
+	keys, err := store.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to look for lock object: %w", err)
+	}
+	for _, k := range keys {
+		if filepath.Base(k) == ObjectName {
+			return k, nil
+		}
+	}
+	return "", nil
+}
+
+// ForceRelease deletes the lock object in store regardless of its holder and returns the former holder,
+// which is nil when there was no lock or it could not be read.
+func ForceRelease(ctx context.Context, store storage.Backend) (*Owner, error) {
+	owner, key, err := Inspect(ctx, store)
+	if key == "" {
+		return nil, err
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		return owner, fmt.Errorf("failed to delete lock object: %w", err)
+	}
+	return owner, nil
+}
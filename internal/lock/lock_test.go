@@ -0,0 +1,169 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/localfs"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+func TestAcquireLocal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.lock")
+	l, err := AcquireLocal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireLocal(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked while held, got %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = AcquireLocal(path)
+	if err != nil {
+		t.Fatalf("expected lock to be free after release: %v", err)
+	}
+	_ = l.Release()
+}
+
+func TestInspectLocal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.lock")
+	if owner, err := InspectLocal(path); err != nil || owner != nil {
+		t.Fatalf("expected no owner without a lock file, got %v %v", owner, err)
+	}
+
+	l, err := AcquireLocal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := InspectLocal(path)
+	if err != nil || owner == nil || owner.PID != os.Getpid() {
+		t.Fatalf("expected this process as the owner, got %v %v", owner, err)
+	}
+	_ = l.Release()
+	if owner, err := InspectLocal(path); err != nil || owner != nil {
+		t.Fatalf("expected no owner after release, got %v %v", owner, err)
+	}
+
+	// A run that crashed leaves its record behind.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(&Owner{ID: "x", Hostname: "host", PID: cmd.Process.Pid})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := InspectLocal(path); err != nil || owner != nil {
+		t.Fatalf("expected a dead owner to be ignored, got %v %v", owner, err)
+	}
+}
+
+func TestRemoteLock(t *testing.T) {
+	ctx := context.Background()
+	store, err := localfs.NewClient(localfs.Options{Path: t.TempDir(), Prefix: "host1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := AcquireRemote(ctx, store, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireRemote(ctx, store, time.Hour); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked while held, got %v", err)
+	}
+	owner, key, err := Inspect(ctx, store)
+	if err != nil || owner == nil {
+		t.Fatalf("expected lock holder, got %v, %v", owner, err)
+	}
+	if key != filepath.Join("host1", ObjectName) {
+		t.Errorf("unexpected lock key %s", key)
+	}
+
+	if err := r.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _, _ := Inspect(ctx, store); owner != nil {
+		t.Errorf("expected lock object to be deleted, held by %s", owner.String())
+	}
+}
+
+func TestRemoteLockExpiryAndForce(t *testing.T) {
+	ctx := context.Background()
+	store, err := localfs.NewClient(localfs.Options{Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := AcquireRemote(ctx, store, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(stale.stop) // simulate a crashed run that no longer refreshes its lock
+	<-stale.done
+	time.Sleep(2100 * time.Millisecond)
+
+	r, err := AcquireRemote(ctx, store, time.Hour)
+	if err != nil {
+		t.Fatalf("expected expired lock to be taken over: %v", err)
+	}
+	defer func() { close(r.stop) }()
+
+	owner, err := ForceRelease(ctx, store)
+	if err != nil || owner == nil {
+		t.Fatalf("expected forced release of held lock, got %v, %v", owner, err)
+	}
+	if owner, _, _ := Inspect(ctx, store); owner != nil {
+		t.Error("expected no lock after forced release")
+	}
+}
+
+// failingStore fails every Put once broken is set.
+type failingStore struct {
+	storage.Backend
+	broken atomic.Bool
+}
+
+func (s *failingStore) Put(ctx context.Context, path string) error {
+	if s.broken.Load() {
+		return errors.New("storage unavailable")
+	}
+	return s.Backend.Put(ctx, path)
+}
+
+func TestRemoteLockLost(t *testing.T) {
+	ctx := context.Background()
+	local, err := localfs.NewClient(localfs.Options{Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &failingStore{Backend: local}
+
+	r, err := AcquireRemote(ctx, store, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("expected a held lock, got %v", err)
+	}
+	store.broken.Store(true)
+	time.Sleep(2500 * time.Millisecond)
+	store.broken.Store(false)
+
+	if err := r.Err(); !errors.Is(err, ErrLost) || !strings.Contains(err.Error(), "storage unavailable") {
+		t.Errorf("expected ErrLost naming the refresh failure, got %v", err)
+	}
+	if err := r.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
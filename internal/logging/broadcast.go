@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Broadcast is an io.Writer that passes each line written to it to its subscribers, e.g. to stream
+// the logs of a daemon over HTTP. It keeps the latest lines for subscribers that join later.
+// Subscribers that do not keep up miss lines rather than holding up logging.
+type Broadcast struct {
+	mu      sync.Mutex
+	backlog []string
+	size    int
+	subs    map[chan string]struct{}
+}
+
+// NewBroadcast returns a Broadcast keeping the last size lines.
+func NewBroadcast(size int) *Broadcast {
+	return &Broadcast{size: size, subs: make(map[chan string]struct{})}
+}
+
+// Write implements io.Writer. slog handlers write one record per call.
+func (b *Broadcast) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for line := range bytes.Lines(p) {
+		s := string(bytes.TrimRight(line, "\n"))
+		if len(b.backlog) == b.size {
+			b.backlog = b.backlog[1:]
+		}
+		b.backlog = append(b.backlog, s)
+		for ch := range b.subs {
+			select {
+			case ch <- s:
+			default:
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Subscribe returns the lines kept so far and a channel receiving the following ones. The
+// returned function ends the subscription.
+func (b *Broadcast) Subscribe() (backlog []string, lines <-chan string, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan string, 64)
+	b.subs[ch] = struct{}{}
+	return append([]string(nil), b.backlog...), ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, ch)
+	}
+}
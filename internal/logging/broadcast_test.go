@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	b := NewBroadcast(2)
+	logger := slog.New(slog.NewJSONHandler(b, nil))
+	logger.Info("one")
+	logger.Info("two")
+	logger.Info("three")
+
+	backlog, lines, cancel := b.Subscribe()
+	if len(backlog) != 2 || !strings.Contains(backlog[0], `"msg":"two"`) || !strings.Contains(backlog[1], `"msg":"three"`) {
+		t.Fatalf("expected the last 2 lines, got %q", backlog)
+	}
+	logger.Info("four", "set", "app")
+	if line := <-lines; !strings.Contains(line, `"msg":"four","set":"app"`) || strings.HasSuffix(line, "\n") {
+		t.Errorf("unexpected line %q", line)
+	}
+
+	cancel()
+	logger.Info("five")
+	select {
+	case line := <-lines:
+		t.Errorf("expected no line after cancel, got %q", line)
+	default:
+	}
+}
@@ -0,0 +1,160 @@
+// Package logging sets up structured logging with log/slog and carries the logger of a run,
+// with its run ID and backup set, through contexts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Options configures the logger built by Setup.
+type Options struct {
+	Format string // text (default) or json
+	Level  string // debug, info (default), warn or error
+	// File receives the logs instead of stderr when set, rotated according to MaxSize and MaxFiles.
+	File     string
+	MaxSize  int64 // Bytes; 0 means DefaultMaxSize
+	MaxFiles int   // Rotated files kept besides the current one; 0 means DefaultMaxFiles
+}
+
+// ParseLevel converts a level name to a slog.Level.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// HandlerOptions returns the options of the handlers built for opts, so that further handlers,
+// such as one streaming the logs, log at the same level.
+func (o Options) HandlerOptions() (*slog.HandlerOptions, error) {
+	level := slog.LevelInfo
+	if o.Level != "" {
+		var err error
+		if level, err = ParseLevel(o.Level); err != nil {
+			return nil, err
+		}
+	}
+	return &slog.HandlerOptions{Level: level}, nil
+}
+
+// Setup builds the logger described by opts and makes it the default, also for the standard log
+// package. The returned closer releases the log file, if any.
+func Setup(opts Options) (*slog.Logger, io.Closer, error) {
+	handlerOpts, err := opts.HandlerOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if opts.File != "" {
+		f, err := OpenRotatingFile(opts.File, opts.MaxSize, opts.MaxFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		_ = closer.Close()
+		return nil, nil, fmt.Errorf("invalid log format %q, expected text or json", opts.Format)
+	}
+
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	// Libraries writing to the standard logger end up in the same output.
+	log.SetFlags(0)
+	return logger, closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+type contextKey struct{}
+
+// WithContext returns a context carrying logger.
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns a context whose logger adds the given attributes to every record.
+func With(ctx context.Context, args ...any) (context.Context, *slog.Logger) {
+	logger := FromContext(ctx).With(args...)
+	return WithContext(ctx, logger), logger
+}
+
+// NewRunID returns a random identifier for the log lines of one run.
+func NewRunID() string {
+	id := make([]byte, 6)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Tee returns a handler passing records to all of handlers.
+func Tee(handlers ...slog.Handler) slog.Handler {
+	return teeHandler(handlers)
+}
+
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range t {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hs := make(teeHandler, len(t))
+	for i, h := range t {
+		hs[i] = h.WithAttrs(attrs)
+	}
+	return hs
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	hs := make(teeHandler, len(t))
+	for i, h := range t {
+		hs[i] = h.WithGroup(name)
+	}
+	return hs
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupJSONFile(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	path := filepath.Join(t.TempDir(), "logs", "backup.log")
+	_, closer, err := Setup(Options{Format: "json", Level: "warn", File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, _ := With(context.Background(), "run_id", "abc123")
+	ctx, logger := With(ctx, "set", "app")
+	logger.Info("Not logged below warn")
+	FromContext(ctx).Warn("Upload failed", "destination", "s3")
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one record, got %q", data)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]any{"level": "WARN", "msg": "Upload failed", "run_id": "abc123", "set": "app", "destination": "s3"} {
+		if rec[k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, rec[k])
+		}
+	}
+}
+
+func TestSetupInvalidOptions(t *testing.T) {
+	if _, _, err := Setup(Options{Format: "xml"}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, _, err := Setup(Options{Level: "verbose"}); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestHandlerOptions(t *testing.T) {
+	opts, err := Options{Level: "warn"}.HandlerOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Level.Level() != slog.LevelWarn {
+		t.Errorf("expected warn, got %s", opts.Level.Level())
+	}
+	if opts, _ := (Options{}).HandlerOptions(); opts.Level.Level() != slog.LevelInfo {
+		t.Errorf("expected info by default, got %s", opts.Level.Level())
+	}
+}
+
+func TestTee(t *testing.T) {
+	var all, warnings bytes.Buffer
+	logger := slog.New(Tee(
+		slog.NewTextHandler(&all, nil),
+		slog.NewTextHandler(&warnings, &slog.HandlerOptions{Level: slog.LevelWarn}),
+	)).With("set", "app")
+	logger.Info("Backing up")
+	logger.Warn("Archive created with warnings")
+
+	if !strings.Contains(all.String(), `msg="Backing up" set=app`) || !strings.Contains(all.String(), "Archive created") {
+		t.Errorf("expected both records, got %q", all.String())
+	}
+	if strings.Contains(warnings.String(), "Backing up") || !strings.Contains(warnings.String(), `msg="Archive created with warnings" set=app`) {
+		t.Errorf("expected only the warning, got %q", warnings.String())
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	a, b := NewRunID(), NewRunID()
+	if len(a) != 12 || a == b {
+		t.Errorf("expected distinct 12 character IDs, got %q and %q", a, b)
+	}
+}
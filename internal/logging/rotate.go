@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Defaults of log file rotation.
+const (
+	DefaultMaxSize  = 100 << 20
+	DefaultMaxFiles = 5
+)
+
+// RotatingFile is a log file that is renamed to path.1 once it reaches its maximum size, shifting
+// older files up to path.<maxFiles> and removing the oldest one.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending, creating it and its directory if needed.
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+	r := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o750); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640) // #nosec G302 G304
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// Write implements io.Writer. A write that would take the file past its maximum size rotates it
+// first, so that records are never split between files. If rotation fails, the record is still
+// appended to the current file and the rotation error is returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rotateErr error
+	if r.file != nil && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		rotateErr = r.rotate()
+	}
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, errors.Join(rotateErr, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("failed to write log file: %w", err)
+	}
+	return n, rotateErr
+}
+
+// rotate closes the current file, shifts the rotated files and opens a new one. On failure it
+// reopens path for appending, so that logging goes on; the next attempt is then made once another
+// maxSize bytes have been written rather than on every write.
+func (r *RotatingFile) rotate() error {
+	err := r.file.Close()
+	if err != nil {
+		err = fmt.Errorf("failed to close log file: %w", err)
+	} else {
+		err = r.shift()
+	}
+	if openErr := r.open(); openErr != nil {
+		r.file = nil
+		return errors.Join(err, openErr)
+	}
+	if err != nil {
+		r.size = 0
+		return err
+	}
+	return nil
+}
+
+func (r *RotatingFile) shift() error {
+	_ = os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return nil
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	return nil
+}
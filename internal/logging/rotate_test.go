@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every write exceeds the size left, so each record starts a new file and the oldest is dropped.
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Errorf("expected %s to hold %q, got %q (%v)", filepath.Base(name), want, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no more than 2 rotated files, got %v", err)
+	}
+
+	// Reopening appends to the current file.
+	f, err = OpenRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("fifth\n"))
+	_ = f.Close()
+	if data, _ := os.ReadFile(path); !strings.HasSuffix(string(data), "fourth\nfifth\n") {
+		t.Errorf("expected the reopened file to be appended to, got %q", data)
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.log")
+	// A non-empty directory in the way of backup.log.1 makes the rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("second\n")); err == nil {
+		t.Error("expected the failed rotation to be reported")
+	}
+	// The next attempt waits for another 10 bytes, so this write goes through without one.
+	if _, err := f.Write([]byte("3\n")); err != nil {
+		t.Errorf("expected writes to go on after a failed rotation, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first\nsecond\n3\n" {
+		t.Errorf("expected every record in the current file, got %q", data)
+	}
+}
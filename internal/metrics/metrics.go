@@ -0,0 +1,205 @@
+// Package metrics exports the outcome of backup runs as Prometheus metrics, over HTTP or as a
+// node_exporter textfile.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// StateFile is the name of the metrics state in the state directory.
+const StateFile = "metrics.json"
+
+// Stage of failures not tied to a backup set, e.g. unreachable destinations or failed rotation.
+const StageRun = "run"
+
+// State holds the values behind the metrics. It is kept in the state directory, so that counters
+// survive between cron runs and the daemon exports runs started from the command line too.
+type State struct {
+	Sets map[string]*SetState `json:"sets,omitempty"`
+	// Runs counts runs by status.
+	Runs map[string]float64 `json:"runs,omitempty"`
+	// Rotated counts the archives deleted by rotation, by destination.
+	Rotated map[string]float64 `json:"rotated,omitempty"`
+	// Failures counts failures by set and stage; run-level failures have an empty set.
+	Failures map[string]map[string]float64 `json:"failures,omitempty"`
+}
+
+// SetState describes the latest backup of a set.
+type SetState struct {
+	LastRun     time.Time     `json:"last_run"`
+	LastSuccess time.Time     `json:"last_success,omitzero"`
+	Success     bool          `json:"success"`
+	Duration    time.Duration `json:"duration"`
+	// The values below describe the latest archive that was created.
+	ArchiveBytes int64 `json:"archive_bytes"`
+	Files        int   `json:"files"`
+	Chain        int   `json:"chain"`
+	// Throughput is the upload rate in bytes per second, by destination.
+	Throughput map[string]float64 `json:"throughput,omitempty"`
+}
+
+// Record adds a run to the state.
+func (s *State) Record(rep *report.Report) {
+	if s.Sets == nil {
+		s.Sets = make(map[string]*SetState)
+	}
+	if s.Runs == nil {
+		s.Runs = make(map[string]float64)
+	}
+	if s.Rotated == nil {
+		s.Rotated = make(map[string]float64)
+	}
+	s.Runs[rep.Status()]++
+	for _, r := range rep.Rotations {
+		s.Rotated[r.Destination] += float64(len(r.Deleted))
+	}
+	if len(rep.Errors) > 0 {
+		s.fail("", StageRun, len(rep.Errors))
+	}
+
+	for _, set := range rep.Sets {
+		st, ok := s.Sets[set.Name]
+		if !ok {
+			st = &SetState{}
+			s.Sets[set.Name] = st
+		}
+		st.LastRun = rep.Finished
+		st.Duration = set.Duration
+		st.Success = set.Status() != report.StatusFailure
+		if st.Success {
+			st.LastSuccess = rep.Finished
+		} else {
+			stage := set.Stage
+			if stage == "" {
+				stage = "other"
+			}
+			s.fail(set.Name, stage, 1)
+		}
+		if set.Archive == "" {
+			continue
+		}
+		st.ArchiveBytes, st.Files, st.Chain = set.Size, set.Files, set.Chain
+		st.Throughput = make(map[string]float64)
+		for _, u := range set.Uploads {
+			if u.Error == "" {
+				st.Throughput[u.Destination] = u.Rate()
+			}
+		}
+	}
+}
+
+func (s *State) fail(set, stage string, n int) {
+	if s.Failures == nil {
+		s.Failures = make(map[string]map[string]float64)
+	}
+	if s.Failures[set] == nil {
+		s.Failures[set] = make(map[string]float64)
+	}
+	s.Failures[set][stage] += float64(n)
+}
+
+var (
+	lastRunDesc = prometheus.NewDesc("backup_service_last_run_timestamp_seconds",
+		"Time the latest backup of the set finished.", []string{"set"}, nil)
+	lastSuccessDesc = prometheus.NewDesc("backup_service_last_success_timestamp_seconds",
+		"Time the latest successful backup of the set finished.", []string{"set"}, nil)
+	successDesc = prometheus.NewDesc("backup_service_last_run_success",
+		"Whether the latest backup of the set succeeded (1) or failed (0).", []string{"set"}, nil)
+	durationDesc = prometheus.NewDesc("backup_service_duration_seconds",
+		"Duration of the latest backup of the set.", []string{"set"}, nil)
+	archiveBytesDesc = prometheus.NewDesc("backup_service_archive_bytes",
+		"Size of the latest archive of the set, after encryption.", []string{"set"}, nil)
+	filesDesc = prometheus.NewDesc("backup_service_archive_files",
+		"Files in the latest archive of the set.", []string{"set"}, nil)
+	chainDesc = prometheus.NewDesc("backup_service_chain_length",
+		"Archives needed to restore the latest backup of the set: the full backup and its incrementals.", []string{"set"}, nil)
+	throughputDesc = prometheus.NewDesc("backup_service_upload_throughput_bytes_per_second",
+		"Upload rate of the latest archive of the set to the destination.", []string{"set", "destination"}, nil)
+	runsDesc = prometheus.NewDesc("backup_service_runs_total",
+		"Backup runs by status.", []string{"status"}, nil)
+	rotatedDesc = prometheus.NewDesc("backup_service_rotation_deleted_total",
+		"Archives deleted from the destination by rotation.", []string{"destination"}, nil)
+	failuresDesc = prometheus.NewDesc("backup_service_failures_total",
+		"Failures by set and stage (destination, hook, archive, encrypt, upload; run for failures outside sets).", []string{"set", "stage"}, nil)
+)
+
+// Collector exports a State loaded at every collection.
+type Collector struct {
+	Load func() (*State, error)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{lastRunDesc, lastSuccessDesc, successDesc, durationDesc, archiveBytesDesc,
+		filesDesc, chainDesc, throughputDesc, runsDesc, rotatedDesc, failuresDesc} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s, err := c.Load()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(runsDesc, err)
+		return
+	}
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+	counter := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, labels...)
+	}
+
+	for name, st := range s.Sets {
+		gauge(lastRunDesc, unix(st.LastRun), name)
+		if !st.LastSuccess.IsZero() {
+			gauge(lastSuccessDesc, unix(st.LastSuccess), name)
+		}
+		gauge(successDesc, map[bool]float64{true: 1}[st.Success], name)
+		gauge(durationDesc, st.Duration.Seconds(), name)
+		gauge(archiveBytesDesc, float64(st.ArchiveBytes), name)
+		gauge(filesDesc, float64(st.Files), name)
+		gauge(chainDesc, float64(st.Chain), name)
+		for dest, rate := range st.Throughput {
+			gauge(throughputDesc, rate, name, dest)
+		}
+	}
+	for status, n := range s.Runs {
+		counter(runsDesc, n, status)
+	}
+	for dest, n := range s.Rotated {
+		counter(rotatedDesc, n, dest)
+	}
+	for set, stages := range s.Failures {
+		for stage, n := range stages {
+			counter(failuresDesc, n, set, stage)
+		}
+	}
+}
+
+func unix(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// NewRegistry returns a registry exporting the state returned by load.
+func NewRegistry(load func() (*State, error)) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&Collector{Load: load})
+	return reg
+}
+
+// Handler serves the metrics of reg, e.g. on /metrics.
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
+
+// WriteTextfile atomically writes the metrics of reg to path, in the format of the node_exporter
+// textfile collector, whose file names must end in .prom.
+func WriteTextfile(path string, reg *prometheus.Registry) error {
+	return prometheus.WriteToTextfile(path, reg)
+}
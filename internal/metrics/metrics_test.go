@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/report"
+)
+
+func TestRecordAndExport(t *testing.T) {
+	finished := time.Unix(1735787130, 0)
+	var s State
+	s.Record(&report.Report{
+		Finished: finished,
+		Sets: []report.Set{
+			{Name: "web", Archive: "web_1.inc.tar.gz", Size: 2048, Files: 3, Chain: 4, Duration: 90 * time.Second,
+				Uploads: []report.Upload{{Destination: "s3", Bytes: 2048, Duration: 2 * time.Second}, {Destination: "nas", Error: "timeout"}}},
+			{Name: "db", Errors: []string{"dump failed"}, Stage: "archive"},
+		},
+		Rotations: []report.Rotation{{Destination: "s3", Deleted: []string{"a", "b"}}},
+	})
+	s.Record(&report.Report{Finished: finished, Errors: []string{"nas unreachable"}})
+
+	reg := NewRegistry(func() (*State, error) { return &s, nil })
+	path := filepath.Join(t.TempDir(), "backup.prom")
+	if err := WriteTextfile(path, reg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`backup_service_last_success_timestamp_seconds{set="web"} 1.73578713e+09`,
+		`backup_service_last_run_success{set="db"} 0`,
+		`backup_service_archive_bytes{set="web"} 2048`,
+		`backup_service_chain_length{set="web"} 4`,
+		`backup_service_duration_seconds{set="web"} 90`,
+		`backup_service_upload_throughput_bytes_per_second{destination="s3",set="web"} 1024`,
+		`backup_service_rotation_deleted_total{destination="s3"} 2`,
+		`backup_service_failures_total{set="db",stage="archive"} 1`,
+		`backup_service_failures_total{set="",stage="run"} 1`,
+		`backup_service_runs_total{status="failure"} 2`,
+	} {
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("textfile lacks %s:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), `destination="nas",set="web"`) || strings.Contains(string(data), `last_success_timestamp_seconds{set="db"}`) {
+		t.Errorf("unexpected series for failures:\n%s", data)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `backup_service_archive_files{set="web"} 3`) {
+		t.Errorf("unexpected /metrics response %d:\n%s", rec.Code, rec.Body)
+	}
+}
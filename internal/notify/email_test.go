@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one session and returns the commands and message data it received.
+func fakeSMTP(t *testing.T) (host string, port int, session <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	out := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+		var lines []string
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				out <- lines
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO":
+				reply("250-fake\r\n250 AUTH PLAIN")
+			case "AUTH":
+				reply("235 ok")
+			case "DATA":
+				reply("354 go on")
+				for {
+					data, _ := r.ReadString('\n')
+					if data == ".\r\n" || data == "" {
+						break
+					}
+					lines = append(lines, "> "+strings.TrimRight(data, "\r\n"))
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				out <- lines
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	h, p, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ = strconv.Atoi(p)
+	return h, port, out
+}
+
+func TestEmail(t *testing.T) {
+	host, port, session := fakeSMTP(t)
+	e := &Email{
+		Host: host, Port: port, Username: "backup", Password: "pw",
+		From: "backup@example.com", To: []string{"ops@example.com", "me@example.com"},
+	}
+	if err := e.Notify(context.Background(), testMessage); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	got := strings.Join(<-session, "\n")
+
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00backup\x00pw"))
+	for _, want := range []string{
+		"AUTH PLAIN " + auth,
+		"MAIL FROM:<backup@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<me@example.com>",
+		"> To: ops@example.com, me@example.com",
+		"> Subject: =?utf-8?q?=E2=9D=8C_Backup_Failed?=",
+		"> - upload failed",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("session lacks %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package notify sends run notifications to chat, email and webhook channels.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/mikhail-angelov/backup-service/internal/telegram"
+)
+
+// Message is a notification about a backup run.
+type Message struct {
+	Subject string
+	// Body is rendered in Format, one of the report formats.
+	Body   string
+	Format string
+	// Report is the run the message is about, if any.
+	Report *report.Report
+}
+
+// Text returns the subject, in bold where the format allows it, followed by the body.
+func (m Message) Text() string {
+	subject := report.Bold(m.Format, m.Subject)
+	if m.Body == "" {
+		return subject
+	}
+	return subject + "\n" + m.Body
+}
+
+// Notifier delivers messages to one channel.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// httpClient is shared by the HTTP based notifiers.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// send performs req and turns non-2xx responses into errors that include the start of the response body.
+func send(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, url string, payload any, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return send(req)
+}
+
+// Telegram sends messages through a Telegram bot, using the parse mode matching the message format.
+// Long messages are split.
+type Telegram struct {
+	Client *telegram.Client
+}
+
+// Notify implements Notifier.
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	parseMode := ""
+	switch msg.Format {
+	case report.FormatHTML:
+		parseMode = telegram.ParseModeHTML
+	case report.FormatMarkdownV2:
+		parseMode = telegram.ParseModeMarkdownV2
+	}
+	return t.Client.Send(ctx, msg.Text(), parseMode)
+}
+
+// Slack posts messages to a Slack incoming webhook. Messages should use the slack format.
+type Slack struct {
+	WebhookURL string
+}
+
+// Notify implements Notifier.
+func (s *Slack) Notify(ctx context.Context, msg Message) error {
+	if err := postJSON(ctx, s.WebhookURL, map[string]string{"text": msg.Text()}, nil); err != nil {
+		return fmt.Errorf("failed to send slack message: %w", err)
+	}
+	return nil
+}
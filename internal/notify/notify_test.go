@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/report"
+	"github.com/mikhail-angelov/backup-service/internal/telegram"
+)
+
+// request is what the test server received.
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+// recorder starts a server that records the last request and answers with status.
+func recorder(t *testing.T, status int) (*httptest.Server, *request) {
+	t.Helper()
+	got := &request{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*got = request{method: r.Method, path: r.URL.Path, header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("denied"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+var testMessage = Message{Subject: "❌ Backup Failed", Body: "- upload failed\n"}
+
+func TestTelegram(t *testing.T) {
+	srv, got := recorder(t, http.StatusOK)
+	client := telegram.NewClient("TOKEN", "42")
+	client.BaseURL = srv.URL
+
+	msg := testMessage
+	msg.Format = report.FormatHTML
+	if err := (&Telegram{Client: client}).Notify(context.Background(), msg); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(got.body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if got.path != "/botTOKEN/sendMessage" || payload["chat_id"] != "42" || payload["parse_mode"] != "HTML" ||
+		payload["text"] != "<b>❌ Backup Failed</b>\n- upload failed" {
+		t.Errorf("unexpected request %s %v", got.path, payload)
+	}
+}
+
+// The error of a failed notification is logged, so it must not reveal the bot token.
+func TestTelegramErrorOmitsToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	client := telegram.NewClient("123456:SECRET-TOKEN", "42")
+	client.BaseURL = srv.URL
+
+	err := (&Telegram{Client: client}).Notify(context.Background(), testMessage)
+	if err == nil || strings.Contains(err.Error(), "SECRET-TOKEN") {
+		t.Errorf("expected an error without the token, got %v", err)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	srv, got := recorder(t, http.StatusOK)
+	msg := testMessage
+	msg.Format = report.FormatSlack
+	if err := (&Slack{WebhookURL: srv.URL + "/services/T/B/X"}).Notify(context.Background(), msg); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if got.body != `{"text":"*❌ Backup Failed*\n- upload failed\n"}` {
+		t.Errorf("unexpected body %s", got.body)
+	}
+
+	srv, _ = recorder(t, http.StatusForbidden)
+	err := (&Slack{WebhookURL: srv.URL}).Notify(context.Background(), testMessage)
+	if err == nil || !strings.Contains(err.Error(), "status 403: denied") {
+		t.Errorf("expected the error status and body, got %v", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	srv, got := recorder(t, http.StatusNoContent)
+	w, err := NewWebhook(srv.URL+"/hook", "PUT", map[string]string{"Authorization": "Bearer x"}, `{"text": {{json .Subject}}}`, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Notify(context.Background(), testMessage); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if got.method != "PUT" || got.body != `{"text": "❌ Backup Failed"}` || got.header.Get("Authorization") != "Bearer x" {
+		t.Errorf("unexpected request %s %s %v", got.method, got.body, got.header)
+	}
+	if sig := got.header.Get(SignatureHeader); sig != "sha256="+Sign("s3cret", []byte(got.body)) {
+		t.Errorf("unexpected signature %q", sig)
+	}
+
+	w, err = NewWebhook(srv.URL, "", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Notify(context.Background(), testMessage); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(got.body), &payload); err != nil {
+		t.Fatalf("default template is not JSON: %v\n%s", err, got.body)
+	}
+	if got.method != "POST" || payload["subject"] != testMessage.Subject || payload["body"] != testMessage.Body || got.header.Get(SignatureHeader) != "" {
+		t.Errorf("unexpected request %s %v", got.method, payload)
+	}
+
+	if _, err := NewWebhook(srv.URL, "", nil, "{{.Missing", ""); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	srv, got := recorder(t, http.StatusOK)
+	n := &Ntfy{URL: srv.URL + "/", Topic: "backups", Token: "tk", Priority: "high"}
+	if err := n.Notify(context.Background(), testMessage); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if got.path != "/backups" || got.body != testMessage.Body || got.header.Get("Priority") != "high" || got.header.Get("Authorization") != "Bearer tk" {
+		t.Errorf("unexpected request %s %q %v", got.path, got.body, got.header)
+	}
+	// Non-ASCII header values are sent as-is; ntfy accepts them.
+	if got.header.Get("Title") != testMessage.Subject {
+		t.Errorf("unexpected title %q", got.header.Get("Title"))
+	}
+}
+
+func TestGotify(t *testing.T) {
+	srv, got := recorder(t, http.StatusOK)
+	g := &Gotify{URL: srv.URL, Token: "app", Priority: 8}
+	if err := g.Notify(context.Background(), Message{Subject: "✅ Backup completed successfully"}); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(got.body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if got.path != "/message" || got.header.Get("X-Gotify-Key") != "app" || payload["message"] != "✅ Backup completed successfully" || payload["priority"] != float64(8) {
+		t.Errorf("unexpected request %s %v %v", got.path, got.header, payload)
+	}
+}
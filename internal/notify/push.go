@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultNtfyURL is the public ntfy server.
+const DefaultNtfyURL = "https://ntfy.sh"
+
+// Ntfy publishes messages to an ntfy topic.
+type Ntfy struct {
+	URL      string
+	Topic    string
+	Token    string // Access token, optional
+	Priority string // 1-5 or min, low, default, high, max
+}
+
+// Notify implements Notifier.
+func (n *Ntfy) Notify(ctx context.Context, msg Message) error {
+	base := n.URL
+	if base == "" {
+		base = DefaultNtfyURL
+	}
+	body := msg.Body
+	if body == "" {
+		body = msg.Subject
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(base, "/")+"/"+n.Topic, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create ntfy request: %w", err)
+	}
+	req.Header.Set("Title", msg.Subject)
+	if n.Priority != "" {
+		req.Header.Set("Priority", n.Priority)
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	if err := send(req); err != nil {
+		return fmt.Errorf("failed to publish to ntfy: %w", err)
+	}
+	return nil
+}
+
+// Gotify pushes messages to a Gotify server with an application token.
+type Gotify struct {
+	URL      string
+	Token    string
+	Priority int
+}
+
+// Notify implements Notifier.
+func (g *Gotify) Notify(ctx context.Context, msg Message) error {
+	// Gotify rejects empty messages.
+	body := msg.Body
+	if body == "" {
+		body = msg.Subject
+	}
+	payload := map[string]any{
+		"title":    msg.Subject,
+		"message":  body,
+		"priority": g.Priority,
+	}
+	if err := postJSON(ctx, strings.TrimSuffix(g.URL, "/")+"/message", payload, map[string]string{"X-Gotify-Key": g.Token}); err != nil {
+		return fmt.Errorf("failed to push to gotify: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of webhook bodies as "sha256=<hex>".
+const SignatureHeader = "X-Signature"
+
+// DefaultWebhookTemplate renders messages, including the full run report, as a JSON document.
+const DefaultWebhookTemplate = `{"subject":{{json .Subject}},"body":{{json .Body}},"host":{{json .Hostname}},"time":{{json .Time}},"report":{{json .Report}}}`
+
+// Webhook sends messages to an arbitrary HTTP endpoint with a templated body.
+type Webhook struct {
+	URL     string
+	Method  string
+	Headers map[string]string
+	Secret  string
+	tmpl    *template.Template
+}
+
+// WebhookData is what webhook templates are executed with.
+type WebhookData struct {
+	Message
+	Hostname string
+	Time     time.Time
+}
+
+// NewWebhook parses the body template, DefaultWebhookTemplate when empty. Templates can use the
+// json function to quote values.
+func NewWebhook(url, method string, headers map[string]string, tmpl, secret string) (*Webhook, error) {
+	if tmpl == "" {
+		tmpl = DefaultWebhookTemplate
+	}
+	if method == "" {
+		method = http.MethodPost
+	}
+	t, err := template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+	return &Webhook{URL: url, Method: method, Headers: headers, Secret: secret, tmpl: t}, nil
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	hostname, _ := os.Hostname()
+	var body bytes.Buffer
+	if err := w.tmpl.Execute(&body, WebhookData{Message: msg, Hostname: hostname, Time: time.Now().UTC()}); err != nil {
+		return fmt.Errorf("failed to render webhook body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.Method, w.URL, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, body.Bytes()))
+	}
+	if err := send(req); err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body, as sent in SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,134 @@
+// Package ratelimit throttles data streams with a shared token bucket.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// minBurst bounds the size of a single read so that slow limits still make steady progress.
+const minBurst = 32 << 10
+
+// Limiter caps the combined throughput of every stream wrapped with it. The rate can be
+// changed while streams are in flight. A nil Limiter does not limit.
+type Limiter struct {
+	mu   sync.Mutex
+	rate int64
+	l    *rate.Limiter
+}
+
+// New creates a limiter allowing bytesPerSecond; zero or less means unlimited.
+func New(bytesPerSecond int64) *Limiter {
+	l := &Limiter{l: rate.NewLimiter(rate.Inf, minBurst)}
+	l.SetRate(bytesPerSecond)
+	return l
+}
+
+// SetRate changes the allowed throughput; zero or less means unlimited.
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = max(bytesPerSecond, 0)
+	if l.rate == 0 {
+		l.l.SetLimit(rate.Inf)
+		return
+	}
+	l.l.SetBurst(int(min(max(l.rate, minBurst), 1<<30)))
+	l.l.SetLimit(rate.Limit(l.rate))
+}
+
+// Rate returns the current limit in bytes per second, zero when unlimited.
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Reader returns r throttled by the limiter.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, l: l.l}
+}
+
+// ReadSeeker returns r throttled by the limiter, keeping it seekable so that SDKs can rewind
+// the body when retrying a request.
+func (l *Limiter) ReadSeeker(ctx context.Context, r io.ReadSeeker) io.ReadSeeker {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, l: l.l}
+}
+
+// Writer returns w throttled by the limiter. Each write is passed on in chunks of at most the
+// current burst, so that a stalled writer holds back whatever produces the data.
+func (l *Limiter) Writer(ctx context.Context, w io.Writer) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, l: l.l}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *rate.Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if burst := r.l.Burst(); r.l.Limit() != rate.Inf && len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	// The rate, and with it the burst, may change during the read, e.g. when a bandwidth window
+	// starts. Charge the bytes in chunks of the current burst, which WaitN never rejects.
+	for remaining := n; remaining > 0 && r.l.Limit() != rate.Inf; {
+		chunk := min(remaining, r.l.Burst())
+		if werr := r.l.WaitN(r.ctx, chunk); werr != nil {
+			return n, werr
+		}
+		remaining -= chunk
+	}
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("ratelimit: underlying reader is not seekable")
+	}
+	return s.Seek(offset, whence)
+}
+
+type writer struct {
+	ctx context.Context
+	w   io.Writer
+	l   *rate.Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := len(p) - written
+		if w.l.Limit() != rate.Inf {
+			chunk = min(chunk, w.l.Burst())
+			if err := w.l.WaitN(w.ctx, chunk); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.w.Write(p[written : written+chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReaderLimitsThroughput(t *testing.T) {
+	l := New(64 << 10)
+	data := make([]byte, 160<<10)
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, l.Reader(context.Background(), bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("expected %d bytes, got %d", len(data), n)
+	}
+	// The first 64 KiB burst is free, the remaining 96 KiB take about 1.5s.
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected throttled copy to take over 1s, took %s", elapsed)
+	}
+}
+
+func TestWriterLimitsThroughput(t *testing.T) {
+	l := New(64 << 10)
+	var buf bytes.Buffer
+	data := make([]byte, 160<<10)
+
+	start := time.Now()
+	if n, err := l.Writer(context.Background(), &buf).Write(data); err != nil || n != len(data) {
+		t.Fatalf("wrote %d bytes, error %v", n, err)
+	}
+	if buf.Len() != len(data) {
+		t.Fatalf("expected %d bytes, got %d", len(data), buf.Len())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected throttled write to take over 1s, took %s", elapsed)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := New(0)
+	data := make([]byte, 10<<20)
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, l.Reader(context.Background(), bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("unlimited copy took %s", elapsed)
+	}
+	var nilLimiter *Limiter
+	if r := bytes.NewReader(data); nilLimiter.Reader(context.Background(), r) != r {
+		t.Error("expected nil limiter to return the reader unchanged")
+	}
+	if w := io.Discard; nilLimiter.Writer(context.Background(), w) != w {
+		t.Error("expected nil limiter to return the writer unchanged")
+	}
+}
+
+func TestReaderCanceled(t *testing.T) {
+	l := New(1 << 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := io.Copy(io.Discard, l.Reader(ctx, bytes.NewReader(make([]byte, 64<<10))))
+	if err == nil {
+		t.Error("expected error after cancellation")
+	}
+}
+
+// rateSwitcher changes the rate of a limiter in the middle of each read, like a bandwidth window
+// starting during a transfer.
+type rateSwitcher struct {
+	l    *Limiter
+	rate int64
+}
+
+func (s *rateSwitcher) Read(p []byte) (int, error) {
+	s.l.SetRate(s.rate)
+	return len(p), nil
+}
+
+func TestSetRateDuringRead(t *testing.T) {
+	for _, from := range []int64{0, 1 << 20} {
+		l := New(from)
+		r := l.Reader(context.Background(), &rateSwitcher{l: l, rate: 64 << 10})
+		if n, err := r.Read(make([]byte, 80<<10)); err != nil || n != 80<<10 {
+			t.Errorf("switching from %d to 64 KiB/s: read %d bytes, error %v", from, n, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Output formats of rendered reports.
+const (
+	FormatText       = "text"
+	FormatHTML       = "html"       // Telegram HTML parse mode
+	FormatMarkdownV2 = "markdownv2" // Telegram MarkdownV2 parse mode
+	FormatSlack      = "slack"      // Slack mrkdwn
+)
+
+// DefaultTemplate renders the details of a run below its subject. It uses the format-aware
+// functions esc, bold and code so that the same template works for every format.
+const DefaultTemplate = `{{esc .Hostname}} · {{esc (.Started.Format "2006-01-02 15:04")}} · {{esc (duration .Duration)}}
+{{- range .Sets}}
+
+{{icon .Status}} {{bold .Name}} {{esc (printf "(%s" .Type)}}{{if .BackupType}}{{esc (printf ", %s" .BackupType)}}{{end}}{{esc ")"}}
+{{- if .Archive}}
+{{code .Archive}} {{esc (bytes .Size)}}{{if .Files}}{{esc (printf ", %d files" .Files)}}{{end}}{{esc (printf " in %s" (duration .Duration))}}
+{{- end}}
+{{- range .Uploads}}
+{{esc "→"}} {{esc .Destination}}{{if .Error}}{{esc ": failed"}}{{else}}{{esc (printf ": %s/s" (rate .Rate))}}{{end}}
+{{- end}}
+{{- range .Warnings}}
+{{esc (printf "⚠️ %s" .)}}
+{{- end}}
+{{- range .Errors}}
+{{esc (printf "✗ %s" .)}}
+{{- end}}
+{{- end}}
+{{- range .Rotations}}{{if .Deleted}}
+
+{{esc (printf "🗑 %s: rotated out %d archive(s)" .Destination (len .Deleted))}}
+{{- end}}{{end}}
+{{- if .Errors}}
+
+{{bold "Errors"}}
+{{- range .Errors}}
+{{esc (printf "- %s" .)}}
+{{- end}}
+{{- end}}
+`
+
+// DefaultDigestTemplate summarizes the runs of a digest, listing the sets that did not succeed.
+const DefaultDigestTemplate = `{{esc (printf "%s – %s" (.Since.Format "2006-01-02 15:04") (.Until.Format "2006-01-02 15:04"))}}
+{{esc (printf "%d run(s): %d succeeded, %d with warnings, %d failed" (len .Runs) (.Count "success") (.Count "warning") (.Count "failure"))}}
+{{- range .Runs}}
+
+{{icon .Status}} {{bold (.Started.Format "Mon 2006-01-02 15:04")}} {{esc (printf "%s · %d set(s) · %s" .Hostname (len .Sets) (duration .Duration))}}
+{{- range .Sets}}{{if ne .Status "success"}}
+{{esc (printf "%s %s: %d warning(s), %d error(s)" (icon .Status) .Name (len .Warnings) (len .Errors))}}
+{{- range .Errors}}
+{{esc (printf "✗ %s" .)}}
+{{- end}}
+{{- end}}{{end}}
+{{- range .Errors}}
+{{esc (printf "✗ %s" .)}}
+{{- end}}
+{{- end}}
+`
+
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`",
+	">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Escape makes s safe to embed in text of the given format.
+func Escape(format, s string) string {
+	switch format {
+	case FormatHTML:
+		return html.EscapeString(s)
+	case FormatMarkdownV2:
+		return markdownV2Escaper.Replace(s)
+	case FormatSlack:
+		return slackEscaper.Replace(s)
+	}
+	return s
+}
+
+// Bold escapes s and marks it bold in the given format.
+func Bold(format, s string) string {
+	switch format {
+	case FormatHTML:
+		return "<b>" + Escape(format, s) + "</b>"
+	case FormatMarkdownV2, FormatSlack:
+		return "*" + Escape(format, s) + "*"
+	}
+	return s
+}
+
+func code(format, s string) string {
+	switch format {
+	case FormatHTML:
+		return "<code>" + Escape(format, s) + "</code>"
+	case FormatMarkdownV2:
+		return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(s) + "`"
+	case FormatSlack:
+		return "`" + Escape(format, s) + "`"
+	}
+	return s
+}
+
+func icon(status string) string {
+	switch status {
+	case StatusFailure:
+		return "❌"
+	case StatusWarning:
+		return "⚠️"
+	}
+	return "✅"
+}
+
+// Template parses a report template for the given format; DefaultTemplate when text is empty.
+func Template(format, text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	return parse(format, text)
+}
+
+// DigestTemplate parses a digest template for the given format; DefaultDigestTemplate when text is empty.
+func DigestTemplate(format, text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultDigestTemplate
+	}
+	return parse(format, text)
+}
+
+func parse(format, text string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"esc":      func(s string) string { return Escape(format, s) },
+		"bold":     func(s string) string { return Bold(format, s) },
+		"code":     func(s string) string { return code(format, s) },
+		"icon":     icon,
+		"bytes":    FormatBytes,
+		"rate":     func(r float64) string { return FormatBytes(int64(r)) },
+		"duration": func(d time.Duration) string { return d.Round(time.Second).String() },
+		"join":     strings.Join,
+	}
+	t, err := template.New("report").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid report template: %w", err)
+	}
+	return t, nil
+}
+
+// Render renders a report with a template returned by Template, or a digest with one returned
+// by DigestTemplate.
+func Render(t *template.Template, data any) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render report: %w", err)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
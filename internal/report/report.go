@@ -0,0 +1,183 @@
+// Package report describes the outcome of a backup run and renders it for notifications.
+package report
+
+import (
+	"fmt"
+	"time"
+)
+
+// Run statuses, from best to worst.
+const (
+	StatusSuccess = "success"
+	StatusWarning = "warning"
+	StatusFailure = "failure"
+)
+
+// Report is the outcome of one backup run.
+type Report struct {
+	// RunID is attached to every log line of the run.
+	RunID     string     `json:"run_id,omitempty"`
+	Hostname  string     `json:"hostname"`
+	Started   time.Time  `json:"started"`
+	Finished  time.Time  `json:"finished"`
+	Sets      []Set      `json:"sets"`
+	Rotations []Rotation `json:"rotations,omitempty"`
+	// Errors are failures not tied to a backup set, e.g. unreachable destinations.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Set is the outcome of backing up one set.
+type Set struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`                  // files, postgres, mysql or docker
+	BackupType string        `json:"backup_type,omitempty"` // full or inc
+	Archive    string        `json:"archive,omitempty"`
+	Size       int64         `json:"size,omitempty"`  // Bytes uploaded, after encryption
+	Files      int           `json:"files,omitempty"` // Files stored in the archive, 0 for dumps
+	Duration   time.Duration `json:"duration"`
+	// Chain is the number of archives a restore of this one needs: 1 for full backups, 1 plus the
+	// preceding incrementals since the last full backup otherwise.
+	Chain    int      `json:"chain,omitempty"`
+	Uploads  []Upload `json:"uploads,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	// Stage is where the set first failed: destination, hook, archive, encrypt or upload.
+	Stage string `json:"stage,omitempty"`
+}
+
+// Upload is the transfer of a set's archive to one destination.
+type Upload struct {
+	Destination string        `json:"destination"`
+	Bytes       int64         `json:"bytes"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Rate returns the upload throughput in bytes per second.
+func (u Upload) Rate() float64 {
+	if u.Duration <= 0 {
+		return 0
+	}
+	return float64(u.Bytes) / u.Duration.Seconds()
+}
+
+// Rotation lists the archives retention deleted from a destination.
+type Rotation struct {
+	Destination string   `json:"destination"`
+	Deleted     []string `json:"deleted"`
+}
+
+// Status returns the status of the set.
+func (s Set) Status() string {
+	switch {
+	case len(s.Errors) > 0:
+		return StatusFailure
+	case len(s.Warnings) > 0:
+		return StatusWarning
+	}
+	return StatusSuccess
+}
+
+// Status returns the worst status of the run and its sets.
+func (r *Report) Status() string {
+	if len(r.Errors) > 0 {
+		return StatusFailure
+	}
+	status := StatusSuccess
+	for _, s := range r.Sets {
+		switch s.Status() {
+		case StatusFailure:
+			return StatusFailure
+		case StatusWarning:
+			status = StatusWarning
+		}
+	}
+	return status
+}
+
+// Set returns the outcome of the named set, if the run included it.
+func (r *Report) Set(name string) (*Set, bool) {
+	for i := range r.Sets {
+		if r.Sets[i].Name == name {
+			return &r.Sets[i], true
+		}
+	}
+	return nil, false
+}
+
+// Duration returns how long the run took.
+func (r *Report) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// Subject is a one-line summary of the run.
+func (r *Report) Subject() string {
+	switch r.Status() {
+	case StatusFailure:
+		return "❌ Backup Failed"
+	case StatusWarning:
+		return "⚠️ Backup completed with warnings"
+	}
+	return "✅ Backup completed successfully"
+}
+
+// AllErrors returns the run errors followed by the errors of every set.
+func (r *Report) AllErrors() []string {
+	errs := append([]string(nil), r.Errors...)
+	for _, s := range r.Sets {
+		errs = append(errs, s.Errors...)
+	}
+	return errs
+}
+
+// AllWarnings returns the warnings of every set, prefixed with the set name.
+func (r *Report) AllWarnings() []string {
+	var warnings []string
+	for _, s := range r.Sets {
+		for _, w := range s.Warnings {
+			warnings = append(warnings, s.Name+": "+w)
+		}
+	}
+	return warnings
+}
+
+// Digest collects the reports of several runs, sent together on a schedule.
+type Digest struct {
+	Since time.Time
+	Until time.Time
+	Runs  []Report
+}
+
+// Count returns the number of runs with the given status.
+func (d *Digest) Count(status string) int {
+	n := 0
+	for i := range d.Runs {
+		if d.Runs[i].Status() == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Subject is a one-line summary of the digest.
+func (d *Digest) Subject() string {
+	subject := fmt.Sprintf("📋 Backup digest: %d run(s)", len(d.Runs))
+	if n := d.Count(StatusFailure); n > 0 {
+		subject += fmt.Sprintf(", %d failed", n)
+	}
+	return subject
+}
+
+// FormatBytes renders a byte count with binary units, e.g. "1.5 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,112 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *Report {
+	return &Report{
+		Hostname: "srv1",
+		Started:  time.Date(2025, 1, 2, 3, 4, 0, 0, time.UTC),
+		Finished: time.Date(2025, 1, 2, 3, 5, 30, 0, time.UTC),
+		Sets: []Set{{
+			Name: "web_app", Type: "files", BackupType: "full", Archive: "web_app_20250102030400.full.tar.gz.gpg",
+			Size: 3 << 20, Files: 12, Duration: 20 * time.Second,
+			Uploads:  []Upload{{Destination: "cloud", Bytes: 3 << 20, Duration: 2 * time.Second}},
+			Warnings: []string{"/var/log/a.log: file changed as we read it"},
+		}},
+		Rotations: []Rotation{{Destination: "cloud", Deleted: []string{"old"}}},
+	}
+}
+
+func TestStatus(t *testing.T) {
+	r := testReport()
+	if r.Status() != StatusWarning || r.Subject() != "⚠️ Backup completed with warnings" {
+		t.Errorf("expected warning status, got %s", r.Status())
+	}
+	r.Sets = append(r.Sets, Set{Name: "db", Errors: []string{"dump failed"}})
+	if r.Status() != StatusFailure || len(r.AllErrors()) != 1 || len(r.AllWarnings()) != 1 {
+		t.Errorf("expected failure status, got %s", r.Status())
+	}
+	if (&Report{}).Status() != StatusSuccess {
+		t.Error("expected an empty run to succeed")
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatText, []string{"srv1 · 2025-01-02 03:04 · 1m30s", "⚠️ web_app (files, full)", "web_app_20250102030400.full.tar.gz.gpg 3.0 MiB, 12 files in 20s", "→ cloud: 1.5 MiB/s", "🗑 cloud: rotated out 1 archive(s)"}},
+		{FormatHTML, []string{"<b>web_app</b> (files, full)", "<code>web_app_20250102030400.full.tar.gz.gpg</code>"}},
+		{FormatMarkdownV2, []string{`*web\_app* \(files, full\)`, "`web_app_20250102030400.full.tar.gz.gpg` 3\\.0 MiB", `2025\-01\-02`}},
+	}
+	for _, tt := range tests {
+		tmpl, err := Template(tt.format, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Render(tmpl, testReport())
+		if err != nil {
+			t.Fatalf("%s: render failed: %v", tt.format, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: output lacks %q:\n%s", tt.format, want, got)
+			}
+		}
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	tmpl, err := Template(FormatHTML, `{{range .Sets}}{{bold .Name}}: {{bytes .Size}}{{end}} <{{esc "&"}}>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Render(tmpl, testReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "<b>web_app</b>: 3.0 MiB <&amp;>" {
+		t.Errorf("unexpected output %q", got)
+	}
+	if _, err := Template(FormatText, "{{.Broken"); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"} {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %s, expected %s", n, got, want)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	ok := Report{Hostname: "srv1", Started: time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC), Sets: []Set{{Name: "docs"}}}
+	digest := &Digest{
+		Since: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+		Runs:  []Report{ok, *testReport()},
+	}
+	if got := digest.Count(StatusSuccess); got != 1 {
+		t.Errorf("expected 1 successful run, got %d", got)
+	}
+	tmpl, err := DigestTemplate(FormatText, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Render(tmpl, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2025-01-01 00:00 – 2025-01-03 00:00", "2 run(s): 1 succeeded", "Wed 2025-01-01 03:00"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("digest lacks %q:\n%s", want, got)
+		}
+	}
+}
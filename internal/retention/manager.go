@@ -1,50 +1,54 @@
-// Package retention manages the rotation and cleanup of old backups in S3.
+// Package retention manages the rotation and cleanup of old backups in storage.
 package retention
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
 
-	"github.com/mikhail-angelov/backup-service/internal/s3"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
 )
 
 // Manager handles the retention and rotation of backups.
 type Manager struct {
-	s3Client *s3.Client
-	daily    int
-	monthly  int
+	store   storage.Backend
+	daily   int
+	monthly int
 }
 
 // NewManager creates a new retention manager.
-func NewManager(s3Client *s3.Client, daily, monthly int) *Manager {
+func NewManager(store storage.Backend, daily, monthly int) *Manager {
 	return &Manager{
-		s3Client: s3Client,
-		daily:    daily,
-		monthly:  monthly,
+		store:   store,
+		daily:   daily,
+		monthly: monthly,
 	}
 }
 
-// Rotate performs backup rotation based on the configured daily and monthly retention policies.
-func (m *Manager) Rotate(ctx context.Context) error {
-	keys, err := m.s3Client.ListBackups(ctx)
+// Rotate performs backup rotation based on the configured daily and monthly retention policies
+// and returns the keys it deleted. A backup that cannot be deleted, e.g. one under S3 Object Lock
+// retention, does not stop the others from being rotated out; the failures are returned joined.
+func (m *Manager) Rotate(ctx context.Context) ([]string, error) {
+	keys, err := m.store.List(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list backups for rotation: %w", err)
+		return nil, fmt.Errorf("failed to list backups for rotation: %w", err)
 	}
 
 	// Filter and sort backups by date (assuming filename contains timestamp)
 	// Example filename: backup_20251228075027.tar.gz
 	backups := make([]string, 0)
 	for _, key := range keys {
-		if strings.HasSuffix(key, ".tar.gz") {
+		if strings.HasSuffix(key, ".tar.gz") || strings.HasSuffix(key, ".sql.gz") {
 			backups = append(backups, key)
 		}
 	}
 	sort.Strings(backups)
 
 	if len(backups) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// Logic for 10 daily / 1 monthly
@@ -96,14 +100,20 @@ func (m *Manager) Rotate(ctx context.Context) error {
 	}
 
 	// Delete others
+	logger := logging.FromContext(ctx)
+	var deleted []string
+	var errs []error
 	for _, b := range backups {
 		if !toKeep[b] {
-			fmt.Printf("Rotating out old backup: %s\n", b)
-			if err := m.s3Client.DeleteFile(ctx, b); err != nil {
-				return fmt.Errorf("failed to delete old backup %s: %w", b, err)
+			logger.Info("Rotating out old backup", "key", b)
+			if err := m.store.Delete(ctx, b); err != nil {
+				logger.Warn("Failed to delete old backup", "key", b, "error", err)
+				errs = append(errs, fmt.Errorf("failed to delete old backup %s: %w", b, err))
+				continue
 			}
+			deleted = append(deleted, b)
 		}
 	}
 
-	return nil
+	return deleted, errors.Join(errs...)
 }
@@ -1,12 +1,60 @@
 package retention
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/storage"
 )
 
-// We can't easily test rotation without mocking S3, but we can test the date parsing logic
-// and the selection algorithm if we refactor it slightly.
-// For now, let's just make sure the manager can be initialized.
+// fakeBackend is an in-memory storage.Backend used to exercise rotation.
+type fakeBackend struct {
+	keys map[string]bool
+	// locked keys cannot be deleted, like objects under S3 Object Lock retention.
+	locked map[string]bool
+}
+
+func newFakeBackend(keys ...string) *fakeBackend {
+	f := &fakeBackend{keys: make(map[string]bool)}
+	for _, k := range keys {
+		f.keys[k] = true
+	}
+	return f
+}
+
+func (f *fakeBackend) Put(_ context.Context, filePath string) error {
+	f.keys[filePath] = true
+	return nil
+}
+
+func (f *fakeBackend) Get(_ context.Context, _, _ string) error { return nil }
+
+func (f *fakeBackend) List(_ context.Context) ([]string, error) {
+	keys := make([]string, 0, len(f.keys))
+	for k := range f.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (f *fakeBackend) Delete(_ context.Context, key string) error {
+	if f.locked[key] {
+		return fmt.Errorf("%s is locked", key)
+	}
+	delete(f.keys, key)
+	return nil
+}
+
+func (f *fakeBackend) Stat(_ context.Context, key string) (*storage.ObjectInfo, error) {
+	if !f.keys[key] {
+		return nil, fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+	}
+	return &storage.ObjectInfo{Key: key}, nil
+}
 
 func TestNewManager(t *testing.T) {
 	m := NewManager(nil, 10, 1)
@@ -19,7 +67,70 @@ func TestNewManager(t *testing.T) {
 }
 
 func TestRotateEmpty(t *testing.T) {
-	// This would fail if we don't mock the S3 client
-	// But let's skip it since it requires a mock
-	t.Skip("Skipping rotation test as it requires S3 mock")
+	m := NewManager(newFakeBackend(), 10, 1)
+	if _, err := m.Rotate(context.Background()); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	store := newFakeBackend(
+		"srv/app_20250115000000.full.tar.gz",
+		"srv/app_20250201000000.full.tar.gz",
+		"srv/app_20250202000000.full.tar.gz",
+		"srv/app_20250203000000.full.tar.gz",
+		"srv/notes.txt",
+	)
+	m := NewManager(store, 2, 1)
+	deleted, err := m.Rotate(context.Background())
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if fmt.Sprint(deleted) != "[srv/app_20250115000000.full.tar.gz srv/app_20250201000000.full.tar.gz]" {
+		t.Errorf("unexpected deleted keys %v", deleted)
+	}
+
+	keys, _ := store.List(context.Background())
+	expected := []string{
+		"srv/app_20250202000000.full.tar.gz",
+		"srv/app_20250203000000.full.tar.gz",
+		"srv/notes.txt",
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestRotateSkipsUndeletableBackups(t *testing.T) {
+	store := newFakeBackend(
+		"srv/app_20250101000000.full.tar.gz",
+		"srv/app_20250102000000.full.tar.gz",
+		"srv/app_20250103000000.full.tar.gz",
+		"srv/app_20250104000000.full.tar.gz",
+	)
+	store.locked = map[string]bool{"srv/app_20250101000000.full.tar.gz": true}
+	deleted, err := NewManager(store, 1, 1).Rotate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "app_20250101000000") {
+		t.Errorf("expected the locked backup to be reported, got %v", err)
+	}
+	if fmt.Sprint(deleted) != "[srv/app_20250102000000.full.tar.gz srv/app_20250103000000.full.tar.gz]" {
+		t.Errorf("expected the other old backups to be deleted, got %v", deleted)
+	}
+}
+
+func TestRotateDatabaseDumps(t *testing.T) {
+	store := newFakeBackend(
+		"srv/shop_20250201000000.full.sql.gz",
+		"srv/shop_20250202000000.full.sql.gz",
+		"srv/shop_20250203000000.full.sql.gz",
+	)
+	if _, err := NewManager(store, 2, 1).Rotate(context.Background()); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	keys, _ := store.List(context.Background())
+	expected := []string{"srv/shop_20250202000000.full.sql.gz", "srv/shop_20250203000000.full.sql.gz"}
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
 }
@@ -0,0 +1,72 @@
+// Package retry runs operations with exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy configures how often and how long an operation is retried.
+type Policy struct {
+	// Attempts is the total number of tries, including the first one. Values below 1 mean a single try.
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it succeeds, returns a permanent error, the attempts are exhausted or ctx is done.
+// The delay before retry n is a random duration up to InitialDelay*2^(n-1), capped at MaxDelay.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	attempts := max(p.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		var permanent *permanentError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &permanent):
+			return err
+		case attempt >= attempts:
+			if attempt > 1 {
+				return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (retry aborted: %w)", err, ctx.Err())
+		case <-time.After(p.backoff(attempt)):
+		}
+	}
+}
+
+// backoff returns a "full jitter" delay for the given attempt number.
+func (p Policy) backoff(attempt int) time.Duration {
+	if p.InitialDelay <= 0 {
+		return 0
+	}
+	ceiling := p.InitialDelay << min(attempt-1, 30)
+	if p.MaxDelay > 0 && (ceiling > p.MaxDelay || ceiling <= 0) {
+		ceiling = p.MaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1)) // #nosec G404
+}
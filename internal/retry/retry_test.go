@@ -0,0 +1,75 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{Attempts: 5, InitialDelay: time.Millisecond}, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestDoGivesUp(t *testing.T) {
+	calls := 0
+	sentinel := errors.New("still failing")
+	err := Do(context.Background(), Policy{Attempts: 3}, func(context.Context) error {
+		calls++
+		return sentinel
+	})
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("expected wrapped sentinel error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestDoPermanent(t *testing.T) {
+	calls := 0
+	sentinel := errors.New("not found")
+	err := Do(context.Background(), Policy{Attempts: 5}, func(context.Context) error {
+		calls++
+		return Permanent(sentinel)
+	})
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("expected sentinel error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single call, got %d", calls)
+	}
+}
+
+func TestDoStopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Do(ctx, Policy{Attempts: 5, InitialDelay: time.Hour}, func(context.Context) error {
+		return errors.New("temporary")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	p := Policy{InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt := 1; attempt < 40; attempt++ {
+		if d := p.backoff(attempt); d < 0 || d > p.MaxDelay {
+			t.Fatalf("attempt %d: delay %s outside [0, %s]", attempt, d, p.MaxDelay)
+		}
+	}
+}
@@ -3,48 +3,197 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mikhail-angelov/backup-service/internal/backup"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/state"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+var (
+	_ storage.Backend          = (*Client)(nil)
+	_ storage.GarbageCollector = (*Client)(nil)
+	_ storage.PlainPutter      = (*Client)(nil)
 )
 
 // Client is a wrapper around the AWS S3 client.
 type Client struct {
-	client *s3.Client
-	bucket string
-	prefix string
+	client      *s3.Client
+	bucket      string
+	prefix      string
+	upload      UploadOptions
+	full        UploadOptions
+	incremental UploadOptions
+	state       *state.Store
+	partSize    int64
+	concurrency int
+	upLimit     *ratelimit.Limiter
+	downLimit   *ratelimit.Limiter
+}
+
+// Options configures the S3 client. When no static keys are set, credentials are resolved through
+// the default AWS chain: environment variables, shared config profiles, SSO, web identity tokens
+// and EC2/ECS instance roles.
+type Options struct {
+	Bucket          string
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Profile selects a named profile from the shared AWS config and credentials files.
+	Profile string
+	// RoleARN, if set, is assumed via STS using the credentials resolved above.
+	RoleARN         string
+	ExternalID      string
+	RoleSessionName string
+	Prefix          string
+	// Upload applies to every archive; Full and Incremental override it per backup type.
+	Upload      UploadOptions
+	Full        UploadOptions
+	Incremental UploadOptions
+	// StateDir, if set, persists multipart upload progress so that an interrupted upload
+	// continues with the missing parts instead of starting over.
+	StateDir string
+	// PartSize is the multipart chunk size in bytes (default DefaultPartSize).
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel (default 4).
+	Concurrency int
+	// UploadLimiter and DownloadLimiter, if set, throttle the data streams. They may be shared
+	// between clients to cap the total bandwidth.
+	UploadLimiter   *ratelimit.Limiter
+	DownloadLimiter *ratelimit.Limiter
+}
+
+// UploadOptions controls how archives are stored in S3.
+type UploadOptions struct {
+	StorageClass string // e.g. STANDARD_IA, GLACIER_IR
+	SSE          string // AES256 or aws:kms
+	SSEKMSKeyID  string
+	// ObjectLockMode (GOVERNANCE or COMPLIANCE) and ObjectLockDays apply an Object Lock retention period.
+	ObjectLockMode string
+	ObjectLockDays int
+	Tags           map[string]string
+}
+
+// merge returns o with the non-empty fields of override applied on top.
+func (o UploadOptions) merge(override UploadOptions) UploadOptions {
+	if override.StorageClass != "" {
+		o.StorageClass = override.StorageClass
+	}
+	if override.SSE != "" {
+		o.SSE = override.SSE
+	}
+	if override.SSEKMSKeyID != "" {
+		o.SSEKMSKeyID = override.SSEKMSKeyID
+	}
+	if override.ObjectLockMode != "" {
+		o.ObjectLockMode = override.ObjectLockMode
+	}
+	if override.ObjectLockDays != 0 {
+		o.ObjectLockDays = override.ObjectLockDays
+	}
+	if len(override.Tags) > 0 {
+		tags := make(map[string]string, len(o.Tags)+len(override.Tags))
+		for k, v := range o.Tags {
+			tags[k] = v
+		}
+		for k, v := range override.Tags {
+			tags[k] = v
+		}
+		o.Tags = tags
+	}
+	return o
 }
 
 // NewClient creates a new S3 client with the given credentials and configuration.
-func NewClient(ctx context.Context, bucket, region, endpoint, accessKey, secretKey, prefix string) (*Client, error) {
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
-	)
+func NewClient(ctx context.Context, opts Options) (*Client, error) {
+	if (opts.AccessKeyID == "") != (opts.SecretAccessKey == "") {
+		return nil, errors.New("both access_key_id and secret_access_key must be set to use static credentials")
+	}
+
+	var loadOpts []func(*config.LoadOptions) error
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(opts.Region))
+	}
+	if opts.Profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(opts.Profile))
+	}
+	if opts.AccessKeyID != "" {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, opts.SessionToken),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load SDK config: %w", err)
 	}
 
-	return &Client{
+	if opts.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = opts.RoleSessionName
+			if o.RoleSessionName == "" {
+				o.RoleSessionName = "backup-service"
+			}
+			if opts.ExternalID != "" {
+				o.ExternalID = aws.String(opts.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	c := &Client{
 		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
 			o.UsePathStyle = true
-			if endpoint != "" {
-				o.BaseEndpoint = aws.String(endpoint)
+			if opts.Endpoint != "" {
+				o.BaseEndpoint = aws.String(opts.Endpoint)
 			}
 		}),
-		bucket: bucket,
-		prefix: prefix,
-	}, nil
+		bucket:      opts.Bucket,
+		prefix:      opts.Prefix,
+		upload:      opts.Upload,
+		full:        opts.Upload.merge(opts.Full),
+		incremental: opts.Upload.merge(opts.Incremental),
+		partSize:    opts.PartSize,
+		concurrency: opts.Concurrency,
+		upLimit:     opts.UploadLimiter,
+		downLimit:   opts.DownloadLimiter,
+	}
+	if c.partSize <= 0 {
+		c.partSize = DefaultPartSize
+	}
+	if c.concurrency <= 0 {
+		c.concurrency = manager.DefaultUploadConcurrency
+	}
+	if opts.StateDir != "" {
+		c.state, err = state.NewStore(filepath.Join(opts.StateDir, "s3"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
-// UploadFile uploads a local file to S3.
-func (c *Client) UploadFile(ctx context.Context, filePath string) error {
+// Put uploads a local file to S3.
+func (c *Client) Put(ctx context.Context, filePath string) error {
 	file, err := os.Open(filePath) // #nosec G304
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
@@ -53,12 +202,26 @@ func (c *Client) UploadFile(ctx context.Context, filePath string) error {
 
 	key := filepath.Join(c.prefix, filepath.Base(filePath))
 
-	uploader := manager.NewUploader(c.client)
-	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
-		Body:   file,
+		Body:   c.upLimit.Reader(ctx, file),
+	}
+	c.applyUploadOptions(input, filePath)
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if c.state != nil && info.Size() > c.partSize {
+		return c.resumableUpload(ctx, file, key, input)
+	}
+
+	uploader := manager.NewUploader(c.client, func(u *manager.Uploader) {
+		u.PartSize = c.partSize
+		u.Concurrency = c.concurrency
 	})
+	_, err = uploader.Upload(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to upload to S3: %w", err)
 	}
@@ -66,8 +229,72 @@ func (c *Client) UploadFile(ctx context.Context, filePath string) error {
 	return nil
 }
 
-// ListBackups lists all backup files in the S3 bucket under the specified prefix.
-func (c *Client) ListBackups(ctx context.Context) ([]string, error) {
+// PutPlain uploads a small local file to S3 with a single request, in the standard storage class
+// and without the encryption, Object Lock and tags configured for archives, nor bandwidth limits.
+func (c *Client) PutPlain(ctx context.Context, filePath string) error {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	_, err = c.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(filepath.Join(c.prefix, filepath.Base(filePath))),
+		Body:   file,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+	return nil
+}
+
+// applyUploadOptions sets storage class, encryption, Object Lock and tags on input
+// according to the backup set and type encoded in the archive name.
+func (c *Client) applyUploadOptions(input *s3.PutObjectInput, filePath string) {
+	name, _, backupType := backup.ParseArchiveName(filePath)
+	opts := c.upload
+	switch backupType {
+	case "full":
+		opts = c.full
+	case "inc":
+		opts = c.incremental
+	}
+
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(strings.ToUpper(opts.StorageClass))
+	}
+	if opts.SSE != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(opts.SSE)
+	}
+	if opts.SSEKMSKeyID != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(opts.SSEKMSKeyID)
+	}
+	if opts.ObjectLockMode != "" && opts.ObjectLockDays > 0 {
+		input.ObjectLockMode = types.ObjectLockMode(strings.ToUpper(opts.ObjectLockMode))
+		input.ObjectLockRetainUntilDate = aws.Time(time.Now().AddDate(0, 0, opts.ObjectLockDays))
+		// Object Lock requests must carry an integrity checksum.
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+
+	tags := url.Values{}
+	for k, v := range opts.Tags {
+		tags.Set(k, v)
+	}
+	if name != "" {
+		tags.Set("backup-set", name)
+	}
+	if backupType != "" {
+		tags.Set("backup-type", backupType)
+	}
+	if len(tags) > 0 {
+		input.Tagging = aws.String(tags.Encode())
+	}
+}
+
+// List lists all backup files in the S3 bucket under the specified prefix.
+func (c *Client) List(ctx context.Context) ([]string, error) {
 	var backups []string
 	paginator := s3.NewListObjectsV2Paginator(c.client, &s3.ListObjectsV2Input{
 		Bucket: aws.String(c.bucket),
@@ -88,8 +315,8 @@ func (c *Client) ListBackups(ctx context.Context) ([]string, error) {
 	return backups, nil
 }
 
-// DeleteFile deletes a file from S3 by its key.
-func (c *Client) DeleteFile(ctx context.Context, key string) error {
+// Delete deletes a file from S3 by its key.
+func (c *Client) Delete(ctx context.Context, key string) error {
 	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
@@ -100,22 +327,100 @@ func (c *Client) DeleteFile(ctx context.Context, key string) error {
 	return nil
 }
 
-// DownloadFile downloads a file from S3 to a local target path.
-func (c *Client) DownloadFile(ctx context.Context, key, targetPath string) error {
-	file, err := os.Create(targetPath) // #nosec G304
+// Get downloads a file from S3 to a local target path. The object is first written to
+// targetPath+".part"; if such a file is left over from an interrupted download of the same
+// object version, the download continues from where it stopped using a ranged GET.
+func (c *Client) Get(ctx context.Context, key, targetPath string) error {
+	head, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+		}
+		return fmt.Errorf("failed to stat S3 object: %w", err)
+	}
+	size := aws.ToInt64(head.ContentLength)
+	etag := aws.ToString(head.ETag)
+
+	partPath := targetPath + ".part"
+	etagPath := partPath + ".etag"
+	var offset int64
+	if prev, err := os.ReadFile(etagPath); err == nil && string(prev) == etag { // #nosec G304
+		if info, err := os.Stat(partPath); err == nil && info.Size() <= size {
+			offset = info.Size()
+		}
+	}
+	if offset == 0 {
+		if err := os.WriteFile(etagPath, []byte(etag), 0o600); err != nil {
+			return fmt.Errorf("failed to write download state: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0o600) // #nosec G304
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 	defer func() { _ = file.Close() }()
+	if err := file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to prepare file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to prepare file: %w", err)
+	}
+
+	if offset < size {
+		if offset > 0 {
+			logging.FromContext(ctx).Info("Resuming download", "key", key, "offset", offset, "size", size)
+		}
+		input := &s3.GetObjectInput{
+			Bucket:  aws.String(c.bucket),
+			Key:     aws.String(key),
+			IfMatch: aws.String(etag),
+		}
+		if offset > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+		}
+		out, err := c.client.GetObject(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to download from S3: %w", err)
+		}
+		_, err = io.Copy(file, c.downLimit.Reader(ctx, out.Body))
+		_ = out.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to download from S3: %w", err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(partPath, targetPath); err != nil {
+		return fmt.Errorf("failed to move downloaded file: %w", err)
+	}
+	_ = os.Remove(etagPath)
+	return nil
+}
 
-	downloader := manager.NewDownloader(c.client)
-	_, err = downloader.Download(ctx, file, &s3.GetObjectInput{
+// Stat returns the size and modification time of an S3 object.
+func (c *Client) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	out, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to download from S3: %w", err)
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to stat S3 object: %w", err)
 	}
 
-	return nil
+	info := &storage.ObjectInfo{Key: key, Size: aws.ToInt64(out.ContentLength)}
+	if out.LastModified != nil {
+		info.ModTime = *out.LastModified
+	}
+	return info, nil
 }
@@ -0,0 +1,103 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestNewClientRequiresBothKeys(t *testing.T) {
+	_, err := NewClient(context.Background(), Options{Bucket: "b", Region: "us-east-1", AccessKeyID: "AKID"})
+	if err == nil {
+		t.Fatal("expected error when only the access key is set")
+	}
+}
+
+func TestNewClientFallsBackToDefaultChain(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENV_AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "ENV_SECRET")
+	t.Setenv("AWS_SESSION_TOKEN", "ENV_TOKEN")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+
+	c, err := NewClient(context.Background(), Options{Bucket: "b", Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := c.client.Options().Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("failed to retrieve credentials: %v", err)
+	}
+	if creds.AccessKeyID != "ENV_AKID" || creds.SessionToken != "ENV_TOKEN" {
+		t.Errorf("expected credentials from environment, got %s", creds.AccessKeyID)
+	}
+}
+
+func TestNewClientStaticSessionToken(t *testing.T) {
+	c, err := NewClient(context.Background(), Options{
+		Bucket:          "b",
+		Region:          "us-east-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := c.client.Options().Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("failed to retrieve credentials: %v", err)
+	}
+	if creds.AccessKeyID != "AKID" || creds.SessionToken != "TOKEN" {
+		t.Errorf("expected static credentials, got %s/%s", creds.AccessKeyID, creds.SessionToken)
+	}
+}
+
+func TestApplyUploadOptions(t *testing.T) {
+	c, err := NewClient(context.Background(), Options{
+		Bucket:          "b",
+		Region:          "us-east-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Upload: UploadOptions{
+			SSEKMSKeyID: "kms-key",
+			Tags:        map[string]string{"env": "prod"},
+		},
+		Full: UploadOptions{
+			StorageClass:   "GLACIER_IR",
+			ObjectLockMode: "compliance",
+			ObjectLockDays: 30,
+		},
+		Incremental: UploadOptions{StorageClass: "STANDARD_IA"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full := &s3.PutObjectInput{}
+	c.applyUploadOptions(full, "/tmp/web_20250101000000.full.tar.gz.gpg")
+	if full.StorageClass != types.StorageClassGlacierIr {
+		t.Errorf("expected GLACIER_IR for full, got %s", full.StorageClass)
+	}
+	if full.ServerSideEncryption != types.ServerSideEncryptionAwsKms || aws.ToString(full.SSEKMSKeyId) != "kms-key" {
+		t.Errorf("expected SSE-KMS with kms-key, got %s/%s", full.ServerSideEncryption, aws.ToString(full.SSEKMSKeyId))
+	}
+	if full.ObjectLockMode != types.ObjectLockModeCompliance || full.ObjectLockRetainUntilDate == nil {
+		t.Errorf("expected compliance object lock, got %s", full.ObjectLockMode)
+	}
+	if got := aws.ToString(full.Tagging); got != "backup-set=web&backup-type=full&env=prod" {
+		t.Errorf("unexpected tagging %q", got)
+	}
+
+	inc := &s3.PutObjectInput{}
+	c.applyUploadOptions(inc, "/tmp/web_20250102000000.inc.tar.gz")
+	if inc.StorageClass != types.StorageClassStandardIa {
+		t.Errorf("expected STANDARD_IA for incremental, got %s", inc.StorageClass)
+	}
+	if inc.ObjectLockMode != "" {
+		t.Errorf("expected no object lock for incremental, got %s", inc.ObjectLockMode)
+	}
+}
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/lock"
+)
+
+// bucketS3 is an in-memory bucket that, like S3, refuses to read objects stored in Glacier.
+type bucketS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	classes map[string]string
+	headers []http.Header // of every PUT
+}
+
+func (f *bucketS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/b/")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		b.WriteString(`<ListBucketResult><IsTruncated>false</IsTruncated>`)
+		for _, k := range keys {
+			fmt.Fprintf(&b, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, k, len(f.objects[k]))
+		}
+		b.WriteString(`</ListBucketResult>`)
+		_, _ = fmt.Fprint(w, b.String())
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+		f.classes[key] = r.Header.Get("X-Amz-Storage-Class")
+		f.headers = append(f.headers, r.Header.Clone())
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case f.objects[key] == nil:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", fmt.Sprint(len(f.objects[key])))
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet && f.classes[key] == "GLACIER":
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprint(w, `<Error><Code>InvalidObjectState</Code><Message>archived</Message></Error>`)
+	case r.Method == http.MethodGet:
+		_, _ = w.Write(f.objects[key])
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestRemoteLockIgnoresUploadOptions(t *testing.T) {
+	f := &bucketS3{objects: make(map[string][]byte), classes: make(map[string]string)}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+	c, err := NewClient(context.Background(), Options{
+		Bucket:          "b",
+		Region:          "us-east-1",
+		Endpoint:        srv.URL,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Prefix:          "host1/",
+		Upload: UploadOptions{
+			StorageClass:   "GLACIER",
+			SSE:            "AES256",
+			ObjectLockMode: "compliance",
+			ObjectLockDays: 30,
+			Tags:           map[string]string{"env": "prod"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	l, err := lock.AcquireRemote(ctx, c, time.Hour)
+	if err != nil {
+		t.Fatalf("expected to acquire the lock: %v", err)
+	}
+	if owner, key, err := lock.Inspect(ctx, c); err != nil || owner == nil || key != "host1/"+lock.ObjectName {
+		t.Fatalf("expected to read the lock back, got %v, %q, %v", owner, key, err)
+	}
+	if err := l.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.objects) != 0 {
+		t.Errorf("expected the lock object to be deleted, got %v", f.objects)
+	}
+
+	for _, h := range f.headers {
+		for _, name := range []string{"X-Amz-Storage-Class", "X-Amz-Server-Side-Encryption", "X-Amz-Object-Lock-Mode", "X-Amz-Tagging"} {
+			if v := h.Get(name); v != "" {
+				t.Errorf("expected the lock object without %s, got %q", name, v)
+			}
+		}
+	}
+}
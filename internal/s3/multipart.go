@@ -0,0 +1,287 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+)
+
+// DefaultPartSize is the multipart chunk size used when none is configured.
+const DefaultPartSize = 16 << 20
+
+// uploadState is persisted after every completed part so that an interrupted upload
+// can continue with the remaining parts on the next attempt, even from another process.
+type uploadState struct {
+	Bucket   string          `json:"bucket"`
+	Key      string          `json:"key"`
+	UploadID string          `json:"upload_id"`
+	Size     int64           `json:"size"`
+	ModTime  time.Time       `json:"mod_time"`
+	PartSize int64           `json:"part_size"`
+	Parts    []completedPart `json:"parts"`
+}
+
+type completedPart struct {
+	Number        int32  `json:"number"`
+	ETag          string `json:"etag"`
+	ChecksumCRC32 string `json:"checksum_crc32,omitempty"`
+}
+
+func (c *Client) uploadStateName(key string) string {
+	sum := sha256.Sum256([]byte(c.bucket + "/" + key))
+	return "uploads/" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// resumableUpload uploads file in parts, resuming a previously interrupted multipart upload of the
+// same file when its state is found.
+func (c *Client) resumableUpload(ctx context.Context, file *os.File, key string, input *s3.PutObjectInput) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	name := c.uploadStateName(key)
+	var st uploadState
+	if err := c.state.Load(name, &st); err != nil {
+		return err
+	}
+
+	resumed := false
+	if st.UploadID != "" && st.Size == info.Size() && st.ModTime.Equal(info.ModTime()) && st.PartSize == c.partSize {
+		parts, err := c.listUploadedParts(ctx, key, st.UploadID)
+		if err == nil {
+			st.Parts = parts
+			resumed = true
+			logging.FromContext(ctx).Info("Resuming upload", "key", key, "parts", len(parts))
+		}
+	}
+	if !resumed {
+		if st.UploadID != "" {
+			c.abortUpload(ctx, st.Key, st.UploadID)
+		}
+		out, err := c.client.CreateMultipartUpload(ctx, createInput(input))
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+		st = uploadState{
+			Bucket:   c.bucket,
+			Key:      key,
+			UploadID: aws.ToString(out.UploadId),
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			PartSize: c.partSize,
+		}
+		if err := c.state.Save(name, &st); err != nil {
+			return err
+		}
+	}
+
+	done := make(map[int32]bool, len(st.Parts))
+	for _, p := range st.Parts {
+		done[p.Number] = true
+	}
+	if err := c.uploadParts(ctx, file, &st, name, done, input.ChecksumAlgorithm); err != nil {
+		return err
+	}
+
+	sort.Slice(st.Parts, func(i, j int) bool { return st.Parts[i].Number < st.Parts[j].Number })
+	parts := make([]types.CompletedPart, 0, len(st.Parts))
+	for _, p := range st.Parts {
+		part := types.CompletedPart{PartNumber: aws.Int32(p.Number), ETag: aws.String(p.ETag)}
+		if p.ChecksumCRC32 != "" {
+			part.ChecksumCRC32 = aws.String(p.ChecksumCRC32)
+		}
+		parts = append(parts, part)
+	}
+	_, err = c.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(c.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(st.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return c.state.Remove(name)
+}
+
+// uploadParts uploads the parts missing from st with up to c.concurrency requests in flight,
+// saving the state after each completed part.
+func (c *Client) uploadParts(ctx context.Context, file *os.File, st *uploadState, stateName string, done map[int32]bool, checksum types.ChecksumAlgorithm) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type part struct {
+		number       int32
+		offset, size int64
+	}
+	parts := make(chan part)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	for range c.concurrency {
+		wg.Go(func() {
+			for p := range parts {
+				out, err := c.client.UploadPart(ctx, &s3.UploadPartInput{
+					Bucket:            aws.String(c.bucket),
+					Key:               aws.String(st.Key),
+					UploadId:          aws.String(st.UploadID),
+					PartNumber:        aws.Int32(p.number),
+					Body:              c.upLimit.ReadSeeker(ctx, io.NewSectionReader(file, p.offset, p.size)),
+					ContentLength:     aws.Int64(p.size),
+					ChecksumAlgorithm: checksum,
+				})
+				if err != nil {
+					fail(fmt.Errorf("failed to upload part %d: %w", p.number, err))
+					continue
+				}
+				mu.Lock()
+				st.Parts = append(st.Parts, completedPart{
+					Number:        p.number,
+					ETag:          aws.ToString(out.ETag),
+					ChecksumCRC32: aws.ToString(out.ChecksumCRC32),
+				})
+				err = c.state.Save(stateName, st)
+				mu.Unlock()
+				if err != nil {
+					fail(err)
+				}
+			}
+		})
+	}
+
+feed:
+	for offset, number := int64(0), int32(1); offset < st.Size; offset, number = offset+c.partSize, number+1 {
+		if done[number] {
+			continue
+		}
+		select {
+		case parts <- part{number: number, offset: offset, size: min(c.partSize, st.Size-offset)}:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(parts)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("upload interrupted: %w", err)
+	}
+	return nil
+}
+
+// listUploadedParts returns the parts S3 already holds for an upload.
+func (c *Client) listUploadedParts(ctx context.Context, key, uploadID string) ([]completedPart, error) {
+	var parts []completedPart
+	paginator := s3.NewListPartsPaginator(c.client, &s3.ListPartsInput{
+		Bucket:   aws.String(c.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+		for _, p := range page.Parts {
+			parts = append(parts, completedPart{
+				Number:        aws.ToInt32(p.PartNumber),
+				ETag:          aws.ToString(p.ETag),
+				ChecksumCRC32: aws.ToString(p.ChecksumCRC32),
+			})
+		}
+	}
+	return parts, nil
+}
+
+func (c *Client) abortUpload(ctx context.Context, key, uploadID string) {
+	_, err := c.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(c.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		logging.FromContext(ctx).Warn("Failed to abort stale multipart upload", "key", key, "error", err)
+	}
+}
+
+// createInput copies the object settings of a PutObject request into a multipart upload request.
+func createInput(in *s3.PutObjectInput) *s3.CreateMultipartUploadInput {
+	return &s3.CreateMultipartUploadInput{
+		Bucket:                    in.Bucket,
+		Key:                       in.Key,
+		StorageClass:              in.StorageClass,
+		ServerSideEncryption:      in.ServerSideEncryption,
+		SSEKMSKeyId:               in.SSEKMSKeyId,
+		ObjectLockMode:            in.ObjectLockMode,
+		ObjectLockRetainUntilDate: in.ObjectLockRetainUntilDate,
+		ChecksumAlgorithm:         in.ChecksumAlgorithm,
+		Tagging:                   in.Tagging,
+	}
+}
+
+// AbortStaleUploads aborts multipart uploads under the prefix that were started before the cutoff
+// and forgets their local resume state. It returns the keys of the aborted uploads.
+func (c *Client) AbortStaleUploads(ctx context.Context, olderThan time.Duration) ([]string, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var aborted []string
+	paginator := s3.NewListMultipartUploadsPaginator(c.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(c.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return aborted, fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+		for _, u := range page.Uploads {
+			if u.Initiated == nil || u.Initiated.After(cutoff) {
+				continue
+			}
+			key := aws.ToString(u.Key)
+			if _, err := c.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(c.bucket),
+				Key:      u.Key,
+				UploadId: u.UploadId,
+			}); err != nil {
+				return aborted, fmt.Errorf("failed to abort multipart upload of %s: %w", key, err)
+			}
+			if c.state != nil {
+				var st uploadState
+				name := c.uploadStateName(key)
+				if err := c.state.Load(name, &st); err == nil && st.UploadID == aws.ToString(u.UploadId) {
+					_ = c.state.Remove(name)
+				}
+			}
+			aborted = append(aborted, key)
+		}
+	}
+	return aborted, nil
+}
@@ -0,0 +1,178 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // #nosec G501
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/storage/storagetest"
+)
+
+// fakeS3 implements the handful of S3 calls used by resumable transfers for a single object.
+type fakeS3 struct {
+	mu       sync.Mutex
+	object   []byte
+	parts    map[int][]byte
+	uploads  map[int]int // part number -> times uploaded
+	failPart int
+	ranges   []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	etag := func(b []byte) string {
+		sum := md5.Sum(b) // #nosec G401
+		return `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.parts = make(map[int][]byte)
+		_, _ = fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		if n == f.failPart {
+			f.failPart = 0
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `<Error><Code>InvalidRequest</Code><Message>dropped</Message></Error>`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.parts[n] = body
+		f.uploads[n]++
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodGet && q.Has("uploadId"):
+		var b strings.Builder
+		b.WriteString(`<ListPartsResult><IsTruncated>false</IsTruncated>`)
+		for n, body := range f.parts {
+			fmt.Fprintf(&b, `<Part><PartNumber>%d</PartNumber><ETag>%s</ETag><Size>%d</Size></Part>`, n, etag(body), len(body))
+		}
+		b.WriteString(`</ListPartsResult>`)
+		_, _ = fmt.Fprint(w, b.String())
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		var numbers []int
+		for n := range f.parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		f.object = nil
+		for _, n := range numbers {
+			f.object = append(f.object, f.parts[n]...)
+		}
+		_, _ = fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodHead && f.object == nil:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", strconv.Itoa(len(f.object)))
+		w.Header().Set("ETag", etag(f.object))
+	case r.Method == http.MethodGet:
+		body := f.object
+		if rng := r.Header.Get("Range"); rng != "" {
+			f.ranges = append(f.ranges, rng)
+			start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			body = body[start:]
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(f.object)-1, len(f.object)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		_, _ = w.Write(body)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newFakeClient(t *testing.T, f http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+	c, err := NewClient(context.Background(), Options{
+		Bucket:          "b",
+		Region:          "us-east-1",
+		Endpoint:        srv.URL,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		StateDir:        t.TempDir(),
+		PartSize:        5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPutResumesMultipartUpload(t *testing.T) {
+	f := &fakeS3{uploads: make(map[int]int), failPart: 2}
+	c := newFakeClient(t, f)
+
+	content := []byte("0123456789abcdefg")
+	path := filepath.Join(t.TempDir(), "app_20250101000000.full.tar.gz")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Put(context.Background(), path); err == nil {
+		t.Fatal("expected first upload to fail")
+	}
+	if err := c.Put(context.Background(), path); err != nil {
+		t.Fatalf("resumed upload failed: %v", err)
+	}
+
+	if !bytes.Equal(f.object, content) {
+		t.Errorf("expected object %q, got %q", content, f.object)
+	}
+	if f.uploads[1] != 1 {
+		t.Errorf("expected part 1 to be uploaded once, got %d", f.uploads[1])
+	}
+	if _, err := os.Stat(c.state.Path(c.uploadStateName("app_20250101000000.full.tar.gz"))); !os.IsNotExist(err) {
+		t.Errorf("expected upload state to be removed, got %v", err)
+	}
+}
+
+func TestGetResumesDownload(t *testing.T) {
+	f := &fakeS3{uploads: make(map[int]int), object: []byte("0123456789")}
+	c := newFakeClient(t, f)
+
+	target := filepath.Join(t.TempDir(), "archive.tar.gz")
+	sum := md5.Sum(f.object) // #nosec G401
+	if err := os.WriteFile(target+".part.etag", []byte(`"`+hex.EncodeToString(sum[:])+`"`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target+".part", []byte("01234"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Get(context.Background(), "archive.tar.gz", target); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0123456789" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if len(f.ranges) != 1 || f.ranges[0] != "bytes=5-" {
+		t.Errorf("expected a ranged request from byte 5, got %v", f.ranges)
+	}
+}
+
+func TestGetMissingObject(t *testing.T) {
+	c := newFakeClient(t, &fakeS3{uploads: make(map[int]int)})
+	storagetest.GetMissing(t, c, "missing.tar.gz")
+}
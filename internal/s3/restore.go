@@ -0,0 +1,137 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+var _ storage.Rehydrator = (*Client)(nil)
+
+// RehydrationStatus reports whether an object sits in Glacier Flexible Retrieval, Deep Archive or an
+// Intelligent-Tiering archive tier, and whether a restored copy is available.
+func (c *Client) RehydrationStatus(ctx context.Context, key string) (*storage.RehydrationStatus, error) {
+	out, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to stat S3 object: %w", err)
+	}
+
+	status := &storage.RehydrationStatus{StorageClass: string(out.StorageClass)}
+	switch {
+	case out.StorageClass == types.StorageClassGlacier, out.StorageClass == types.StorageClassDeepArchive:
+		status.Archived = true
+	case out.ArchiveStatus != "":
+		status.Archived = true
+		status.StorageClass = string(out.ArchiveStatus)
+	}
+	if !status.Archived {
+		status.Available = true
+		return status, nil
+	}
+
+	// The x-amz-restore header looks like `ongoing-request="false", expiry-date="..."`.
+	restore := aws.ToString(out.Restore)
+	switch {
+	case strings.Contains(restore, `ongoing-request="true"`):
+		status.InProgress = true
+	case strings.Contains(restore, `ongoing-request="false"`):
+		status.Available = true
+	}
+	return status, nil
+}
+
+// Rehydrate issues a RestoreObject request with the given retrieval tier (Expedited, Standard or Bulk).
+// Deep Archive has no Expedited tier, so such objects are restored with Standard instead.
+func (c *Client) Rehydrate(ctx context.Context, key, tier string, days int) (time.Duration, error) {
+	tier, err := normalizeTier(tier)
+	if err != nil {
+		return 0, err
+	}
+	status, err := c.RehydrationStatus(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if tier == string(types.TierExpedited) && isDeepArchive(status.StorageClass) {
+		logging.FromContext(ctx).Warn("Expedited retrieval is not available for Deep Archive, using Standard", "key", key, "storage_class", status.StorageClass)
+		tier = string(types.TierStandard)
+	}
+
+	input := &s3.RestoreObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &types.RestoreRequest{
+			GlacierJobParameters: &types.GlacierJobParameters{Tier: types.Tier(tier)},
+		},
+	}
+	// Intelligent-Tiering archive tiers move the object back instead of creating a temporary copy.
+	if !isIntelligentTieringArchive(status.StorageClass) {
+		input.RestoreRequest.Days = aws.Int32(int32(days)) // #nosec G115
+	}
+
+	if _, err := c.client.RestoreObject(ctx, input); err != nil {
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "RestoreAlreadyInProgress" {
+			return 0, fmt.Errorf("failed to request restore of %s: %w", key, err)
+		}
+	}
+	return EstimatedRestoreTime(status.StorageClass, tier), nil
+}
+
+// EstimatedRestoreTime returns the upper bound of the typical retrieval time AWS documents for a storage
+// class and retrieval tier. Unknown tiers are estimated as Standard.
+func EstimatedRestoreTime(storageClass, tier string) time.Duration {
+	tier, _ = normalizeTier(tier)
+	switch {
+	case isDeepArchive(storageClass):
+		if tier == string(types.TierBulk) {
+			return 48 * time.Hour
+		}
+		return 12 * time.Hour
+	default:
+		switch tier {
+		case string(types.TierExpedited):
+			return 5 * time.Minute
+		case string(types.TierBulk):
+			return 12 * time.Hour
+		default:
+			return 5 * time.Hour
+		}
+	}
+}
+
+func normalizeTier(tier string) (string, error) {
+	switch strings.ToLower(tier) {
+	case "expedited":
+		return string(types.TierExpedited), nil
+	case "bulk":
+		return string(types.TierBulk), nil
+	case "standard", "":
+		return string(types.TierStandard), nil
+	default:
+		return "", fmt.Errorf("unsupported restore tier %q, use Expedited, Standard or Bulk", tier)
+	}
+}
+
+func isDeepArchive(class string) bool {
+	return class == string(types.StorageClassDeepArchive) || class == string(types.ArchiveStatusDeepArchiveAccess)
+}
+
+func isIntelligentTieringArchive(class string) bool {
+	return class == string(types.ArchiveStatusArchiveAccess) || class == string(types.ArchiveStatusDeepArchiveAccess)
+}
@@ -0,0 +1,70 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeColdS3 serves one object in a given storage class and records RestoreObject requests.
+type fakeColdS3 struct {
+	mu           sync.Mutex
+	storageClass string
+	restores     []string
+}
+
+func (f *fakeColdS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", "0")
+		w.Header().Set("x-amz-storage-class", f.storageClass)
+	case r.Method == http.MethodPost && r.URL.Query().Has("restore"):
+		body, _ := io.ReadAll(r.Body)
+		f.restores = append(f.restores, string(body))
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestRehydrateTiers(t *testing.T) {
+	tests := []struct {
+		class, tier, sent string
+		estimate          time.Duration
+	}{
+		{"GLACIER", "expedited", "<Tier>Expedited</Tier>", 5 * time.Minute},
+		{"DEEP_ARCHIVE", "Expedited", "<Tier>Standard</Tier>", 12 * time.Hour},
+		{"DEEP_ARCHIVE", "Bulk", "<Tier>Bulk</Tier>", 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		f := &fakeColdS3{storageClass: tt.class}
+		c := newFakeClient(t, f)
+		estimate, err := c.Rehydrate(context.Background(), "h/app_20250101000000.full.tar.gz", tt.tier, 7)
+		if err != nil {
+			t.Fatalf("%s/%s: rehydrate failed: %v", tt.class, tt.tier, err)
+		}
+		if len(f.restores) != 1 || !strings.Contains(f.restores[0], tt.sent) {
+			t.Errorf("%s/%s: expected a restore request with %s, got %v", tt.class, tt.tier, tt.sent, f.restores)
+		}
+		if estimate != tt.estimate {
+			t.Errorf("%s/%s: expected an estimate of %s, got %s", tt.class, tt.tier, tt.estimate, estimate)
+		}
+	}
+}
+
+func TestRehydrateRejectsUnknownTier(t *testing.T) {
+	f := &fakeColdS3{storageClass: "GLACIER"}
+	c := newFakeClient(t, f)
+	if _, err := c.Rehydrate(context.Background(), "h/app_20250101000000.full.tar.gz", "Fast", 7); err == nil {
+		t.Error("expected an unknown tier to be rejected")
+	}
+	if len(f.restores) != 0 {
+		t.Errorf("expected no restore request, got %v", f.restores)
+	}
+}
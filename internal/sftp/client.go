@@ -0,0 +1,287 @@
+// Package sftp stores backups on a remote host over SFTP.
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var _ storage.Backend = (*Client)(nil)
+
+// connectTimeout bounds connecting and the SSH handshake, so that an unreachable host does not
+// hold up a run.
+const connectTimeout = 30 * time.Second
+
+// Options configures the SFTP connection.
+type Options struct {
+	Host           string
+	Port           int
+	User           string
+	Password       string
+	PrivateKeyPath string
+	KnownHostsPath string
+	// InsecureIgnoreHostKey disables host key verification. Only meant for testing.
+	InsecureIgnoreHostKey bool
+	// Path is the remote directory the prefix is resolved against.
+	Path   string
+	Prefix string
+	// UploadLimiter and DownloadLimiter, if set, throttle the data streams. They may be shared
+	// with other clients.
+	UploadLimiter   *ratelimit.Limiter
+	DownloadLimiter *ratelimit.Limiter
+}
+
+// Client is a wrapper around an SFTP session.
+type Client struct {
+	ssh       *ssh.Client
+	client    *sftp.Client
+	root      string
+	prefix    string
+	upLimit   *ratelimit.Limiter
+	downLimit *ratelimit.Limiter
+}
+
+// NewClient connects to the SFTP server described by opts.
+func NewClient(ctx context.Context, opts Options) (*Client, error) {
+	if opts.Host == "" {
+		return nil, errors.New("sftp host is not configured")
+	}
+	if opts.Port == 0 {
+		opts.Port = 22
+	}
+
+	auth, err := authMethods(opts)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := hostKeyCallback(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+	conn, err := (&net.Dialer{Timeout: connectTimeout}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	// NewClientConn does not apply the config timeout, so bound the handshake with a deadline.
+	_ = conn.SetDeadline(time.Now().Add(connectTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            opts.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         connectTimeout,
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, fmt.Errorf("failed to start sftp session: %w", err)
+	}
+
+	root := opts.Path
+	if root == "" {
+		root = "."
+	}
+	return &Client{
+		ssh:       sshClient,
+		client:    client,
+		root:      root,
+		prefix:    opts.Prefix,
+		upLimit:   opts.UploadLimiter,
+		downLimit: opts.DownloadLimiter,
+	}, nil
+}
+
+func authMethods(opts Options) ([]ssh.AuthMethod, error) {
+	var auth []ssh.AuthMethod
+	if opts.PrivateKeyPath != "" {
+		key, err := os.ReadFile(filepath.Clean(opts.PrivateKeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		var signer ssh.Signer
+		if opts.Password != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(opts.Password))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else if opts.Password != "" {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("sftp requires a password or a private key")
+	}
+	return auth, nil
+}
+
+func hostKeyCallback(opts Options) (ssh.HostKeyCallback, error) {
+	if opts.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil // #nosec G106
+	}
+	knownHostsPath := opts.KnownHostsPath
+	if knownHostsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+		}
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// Close terminates the SFTP session and the underlying SSH connection.
+func (c *Client) Close() error {
+	_ = c.client.Close()
+	if err := c.ssh.Close(); err != nil {
+		return fmt.Errorf("failed to close ssh connection: %w", err)
+	}
+	return nil
+}
+
+// Put uploads a local file to the remote directory.
+func (c *Client) Put(ctx context.Context, filePath string) error {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	key := path.Join(c.prefix, filepath.Base(filePath))
+	target := c.path(key)
+	if err := c.client.MkdirAll(path.Dir(target)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+
+	// Upload under a temporary name so that an interrupted transfer never looks like a complete backup.
+	tmpPath := target + ".partial"
+	remote, err := c.client.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file: %w", err)
+	}
+	if _, err := remote.ReadFrom(c.upLimit.Reader(ctx, file)); err != nil {
+		_ = remote.Close()
+		_ = c.client.Remove(tmpPath)
+		return fmt.Errorf("failed to upload via sftp: %w", err)
+	}
+	if err := remote.Close(); err != nil {
+		_ = c.client.Remove(tmpPath)
+		return fmt.Errorf("failed to close remote file: %w", err)
+	}
+	if err := c.client.PosixRename(tmpPath, target); err != nil {
+		_ = c.client.Remove(tmpPath)
+		return fmt.Errorf("failed to move remote file into place: %w", err)
+	}
+	return nil
+}
+
+// Get downloads a remote file to a local target path.
+func (c *Client) Get(ctx context.Context, key, targetPath string) error {
+	remote, err := c.client.Open(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open remote file: %w", err)
+	}
+	defer func() { _ = remote.Close() }()
+
+	file, err := os.Create(targetPath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := io.Copy(file, c.downLimit.Reader(ctx, remote)); err != nil {
+		return fmt.Errorf("failed to download via sftp: %w", err)
+	}
+	return nil
+}
+
+// List returns the keys of all remote files under the prefix.
+func (c *Client) List(_ context.Context) ([]string, error) {
+	start := c.root
+	if c.prefix != "" {
+		dir := c.prefix
+		if !strings.HasSuffix(dir, "/") {
+			dir = path.Dir(dir)
+		}
+		start = c.path(dir)
+	}
+
+	var keys []string
+	walker := c.client.Walk(start)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list remote files: %w", err)
+		}
+		if walker.Stat().IsDir() || strings.HasSuffix(walker.Path(), ".partial") {
+			continue
+		}
+		key := walker.Path()
+		if c.root != "." {
+			key = strings.TrimPrefix(strings.TrimPrefix(key, c.root), "/")
+		}
+		if strings.HasPrefix(key, c.prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Delete removes a remote file.
+func (c *Client) Delete(_ context.Context, key string) error {
+	if err := c.client.Remove(c.path(key)); err != nil {
+		return fmt.Errorf("failed to delete remote file: %w", err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of a remote file.
+func (c *Client) Stat(_ context.Context, key string) (*storage.ObjectInfo, error) {
+	info, err := c.client.Stat(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat remote file: %w", err)
+	}
+	return &storage.ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (c *Client) path(key string) string {
+	return path.Join(c.root, path.Clean("/"+key))
+}
@@ -0,0 +1,136 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/mikhail-angelov/backup-service/internal/storage/storagetest"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestServer starts an SFTP server accepting the password "secret" and returns its address.
+func newTestServer(t *testing.T) (host string, port int) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, config)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			_ = newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(ch)
+				if err != nil {
+					return
+				}
+				_ = server.Serve()
+				_ = server.Close()
+			}
+		}()
+	}
+}
+
+func TestBackend(t *testing.T) {
+	host, port := newTestServer(t)
+	storagetest.Run(t, func(t *testing.T, prefix string) storage.Backend {
+		client, err := NewClient(context.Background(), Options{
+			Host:                  host,
+			Port:                  port,
+			User:                  "backup",
+			Password:              "secret",
+			InsecureIgnoreHostKey: true,
+			Path:                  t.TempDir(),
+			Prefix:                prefix,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	})
+}
+
+func TestNewClientWrongPassword(t *testing.T) {
+	host, port := newTestServer(t)
+	_, err := NewClient(context.Background(), Options{
+		Host:                  host,
+		Port:                  port,
+		User:                  "backup",
+		Password:              "wrong",
+		InsecureIgnoreHostKey: true,
+	})
+	if err == nil {
+		t.Error("expected the handshake to fail")
+	}
+}
+
+func TestNewClientUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	_, err = NewClient(context.Background(), Options{Host: "127.0.0.1", Port: port, Password: "secret", InsecureIgnoreHostKey: true})
+	if err == nil {
+		t.Error("expected connecting to a closed port to fail")
+	}
+}
@@ -0,0 +1,230 @@
+// Package snapshot creates short-lived LVM, Btrfs and ZFS snapshots, so that archives are taken from a
+// frozen view of a filesystem instead of live folders.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Filesystem magic numbers reported by statfs.
+const (
+	btrfsMagic = 0x9123683e
+	zfsMagic   = 0x2fc12fc1
+)
+
+// DefaultLVMSize is the copy-on-write space reserved for LVM snapshots when none is configured.
+const DefaultLVMSize = "1G"
+
+// Options describe the snapshot taken for a backup set.
+type Options struct {
+	// Type is lvm, btrfs or zfs.
+	Type string
+	// Volume is the logical volume as vg/lv, the Btrfs subvolume path, or the ZFS dataset.
+	Volume string
+	// Mountpoint is where the volume is normally mounted. It is required for LVM; Btrfs uses the
+	// subvolume path and ZFS asks the dataset when it is empty.
+	Mountpoint string
+	// Size is the copy-on-write space of LVM snapshots, DefaultLVMSize by default.
+	Size string
+	// MountOptions are used to mount LVM snapshots, "ro" by default. XFS needs "ro,nouuid".
+	MountOptions string
+}
+
+// Snapshot is a snapshot mounted or otherwise readable at Path, which mirrors Mountpoint.
+type Snapshot struct {
+	Mountpoint string
+	Path       string
+	teardown   []func(context.Context) error
+}
+
+// fsMagic returns the filesystem magic number of path. Tests replace it.
+var fsMagic = func(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Type), nil
+}
+
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...) // #nosec G204
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %w, output: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Create takes a snapshot named after the backup set. If it fails half way, whatever was already
+// set up is torn down again.
+func Create(ctx context.Context, opts Options, name string) (*Snapshot, error) {
+	snapName := fmt.Sprintf("%s-backup-%s", name, time.Now().Format("20060102150405"))
+	s := &Snapshot{}
+	var err error
+	switch opts.Type {
+	case "lvm":
+		err = s.createLVM(ctx, opts, snapName)
+	case "btrfs":
+		err = s.createBtrfs(ctx, opts, snapName)
+	case "zfs":
+		err = s.createZFS(ctx, opts, snapName)
+	default:
+		err = fmt.Errorf("unknown snapshot type %q, expected lvm, btrfs or zfs", opts.Type)
+	}
+	if err != nil {
+		if rerr := s.Remove(context.WithoutCancel(ctx)); rerr != nil {
+			err = errors.Join(err, rerr)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Snapshot) createLVM(ctx context.Context, opts Options, snapName string) error {
+	vg, lv, ok := strings.Cut(opts.Volume, "/")
+	if !ok || vg == "" || lv == "" {
+		return fmt.Errorf("lvm volume %q must be given as volume-group/logical-volume", opts.Volume)
+	}
+	if opts.Mountpoint == "" {
+		return errors.New("lvm snapshots need the mountpoint of the logical volume")
+	}
+	if _, err := run(ctx, "lvs", "--noheadings", "-o", "lv_name", opts.Volume); err != nil {
+		return fmt.Errorf("%s is not an LVM logical volume: %w", opts.Volume, err)
+	}
+	size := opts.Size
+	if size == "" {
+		size = DefaultLVMSize
+	}
+	if _, err := run(ctx, "lvcreate", "--snapshot", "--name", snapName, "--size", size, opts.Volume); err != nil {
+		return err
+	}
+	snapVolume := vg + "/" + snapName
+	s.teardown = append(s.teardown, func(ctx context.Context) error {
+		_, err := run(ctx, "lvremove", "-f", snapVolume)
+		return err
+	})
+
+	dir, err := os.MkdirTemp("", snapName+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot mount dir: %w", err)
+	}
+	s.teardown = append(s.teardown, func(context.Context) error {
+		if err := os.Remove(dir); err != nil {
+			return fmt.Errorf("failed to remove snapshot mount dir: %w", err)
+		}
+		return nil
+	})
+
+	mountOptions := opts.MountOptions
+	if mountOptions == "" {
+		mountOptions = "ro"
+	}
+	if _, err := run(ctx, "mount", "-o", mountOptions, "/dev/"+snapVolume, dir); err != nil {
+		return err
+	}
+	s.teardown = append(s.teardown, func(ctx context.Context) error {
+		_, err := run(ctx, "umount", dir)
+		return err
+	})
+
+	s.Mountpoint, s.Path = filepath.Clean(opts.Mountpoint), dir
+	return nil
+}
+
+func (s *Snapshot) createBtrfs(ctx context.Context, opts Options, snapName string) error {
+	volume := filepath.Clean(opts.Volume)
+	if err := requireFS(volume, btrfsMagic, "btrfs"); err != nil {
+		return err
+	}
+	if _, err := run(ctx, "btrfs", "subvolume", "show", volume); err != nil {
+		return fmt.Errorf("%s is not a btrfs subvolume: %w", volume, err)
+	}
+	// The snapshot lives inside the subvolume; snapshots do not include nested subvolumes.
+	path := filepath.Join(volume, "."+snapName)
+	if _, err := run(ctx, "btrfs", "subvolume", "snapshot", "-r", volume, path); err != nil {
+		return err
+	}
+	s.teardown = append(s.teardown, func(ctx context.Context) error {
+		_, err := run(ctx, "btrfs", "subvolume", "delete", path)
+		return err
+	})
+
+	s.Mountpoint, s.Path = volume, path
+	return nil
+}
+
+func (s *Snapshot) createZFS(ctx context.Context, opts Options, snapName string) error {
+	mountpoint := opts.Mountpoint
+	if mountpoint == "" {
+		out, err := run(ctx, "zfs", "get", "-H", "-o", "value", "mountpoint", opts.Volume)
+		if err != nil {
+			return fmt.Errorf("%s is not a ZFS dataset: %w", opts.Volume, err)
+		}
+		if out == "none" || out == "legacy" || out == "-" {
+			return fmt.Errorf("ZFS dataset %s has no usable mountpoint (%s), set it in the config", opts.Volume, out)
+		}
+		mountpoint = out
+	}
+	mountpoint = filepath.Clean(mountpoint)
+	if err := requireFS(mountpoint, zfsMagic, "zfs"); err != nil {
+		return err
+	}
+	snapshot := opts.Volume + "@" + snapName
+	if _, err := run(ctx, "zfs", "snapshot", snapshot); err != nil {
+		return err
+	}
+	s.teardown = append(s.teardown, func(ctx context.Context) error {
+		_, err := run(ctx, "zfs", "destroy", snapshot)
+		return err
+	})
+
+	s.Mountpoint, s.Path = mountpoint, filepath.Join(mountpoint, ".zfs", "snapshot", snapName)
+	return nil
+}
+
+// requireFS fails with a readable error unless path lives on the filesystem with the given magic.
+func requireFS(path string, magic int64, name string) error {
+	got, err := fsMagic(path)
+	if err != nil {
+		return fmt.Errorf("failed to inspect filesystem of %s: %w", path, err)
+	}
+	if got != magic {
+		return fmt.Errorf("%s is not on a %s filesystem (type 0x%x), %s snapshots are not supported there", path, name, got, name)
+	}
+	return nil
+}
+
+// Translate maps a folder below the mountpoint to the same folder inside the snapshot.
+func (s *Snapshot) Translate(folder string) (string, error) {
+	rel, err := filepath.Rel(s.Mountpoint, filepath.Clean(folder))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is not below the snapshotted mountpoint %s", folder, s.Mountpoint)
+	}
+	return filepath.Join(s.Path, rel), nil
+}
+
+// Remove tears the snapshot down in the reverse order it was set up, attempting every step.
+func (s *Snapshot) Remove(ctx context.Context) error {
+	var errs []error
+	for i := len(s.teardown) - 1; i >= 0; i-- {
+		if err := s.teardown[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.teardown = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to remove snapshot: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTools puts stand-ins for lvs, lvcreate, lvremove, mount, umount, btrfs and zfs first in PATH.
+// Each records its arguments in the calls file; the tool named by FAKE_FAIL exits with an error.
+func fakeTools(t *testing.T) (calls string) {
+	t.Helper()
+	dir := t.TempDir()
+	calls = filepath.Join(dir, "calls")
+	for _, tool := range []string{"lvs", "lvcreate", "lvremove", "mount", "umount", "btrfs", "zfs"} {
+		script := "#!/bin/sh\necho \"" + tool + " $*\" >> " + calls + "\n" +
+			"[ \"$FAKE_FAIL\" = " + tool + " ] && { echo " + tool + " broke >&2; exit 1; }\n" +
+			"[ \"$1 $2\" = \"get -H\" ] && echo /tank/data\nexit 0\n"
+		if err := os.WriteFile(filepath.Join(dir, tool), []byte(script), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	t.Setenv("FAKE_FAIL", "")
+	return calls
+}
+
+func setMagic(t *testing.T, magic int64) {
+	t.Helper()
+	orig := fsMagic
+	fsMagic = func(string) (int64, error) { return magic, nil }
+	t.Cleanup(func() { fsMagic = orig })
+}
+
+func readCalls(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestBtrfsSnapshot(t *testing.T) {
+	calls := fakeTools(t)
+	setMagic(t, btrfsMagic)
+
+	s, err := Create(context.Background(), Options{Type: "btrfs", Volume: "/home/"}, "home")
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !strings.HasPrefix(s.Path, "/home/.home-backup-") {
+		t.Errorf("unexpected snapshot path %s", s.Path)
+	}
+	path, err := s.Translate("/home/alice/docs")
+	if err != nil || path != s.Path+"/alice/docs" {
+		t.Errorf("unexpected translation %s, %v", path, err)
+	}
+	if _, err := s.Translate("/etc"); err == nil {
+		t.Error("expected an error for a folder outside the snapshot")
+	}
+	if err := s.Remove(context.Background()); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+
+	got := readCalls(t, calls)
+	want := []string{
+		"btrfs subvolume show /home",
+		"btrfs subvolume snapshot -r /home " + s.Path,
+		"btrfs subvolume delete " + s.Path,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected calls %q, got %q", want, got)
+	}
+}
+
+func TestZFSSnapshot(t *testing.T) {
+	calls := fakeTools(t)
+	setMagic(t, zfsMagic)
+
+	s, err := Create(context.Background(), Options{Type: "zfs", Volume: "tank/data"}, "data")
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if s.Mountpoint != "/tank/data" || !strings.HasPrefix(s.Path, "/tank/data/.zfs/snapshot/data-backup-") {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	if err := s.Remove(context.Background()); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	got := readCalls(t, calls)
+	if len(got) != 3 || !strings.HasPrefix(got[1], "zfs snapshot tank/data@data-backup-") || !strings.HasPrefix(got[2], "zfs destroy tank/data@data-backup-") {
+		t.Errorf("unexpected calls %q", got)
+	}
+}
+
+func TestUnsupportedFilesystem(t *testing.T) {
+	calls := fakeTools(t)
+	setMagic(t, 0xef53) // ext4
+
+	_, err := Create(context.Background(), Options{Type: "btrfs", Volume: "/srv"}, "srv")
+	if err == nil || !strings.Contains(err.Error(), "not on a btrfs filesystem") {
+		t.Errorf("expected a clear error for a non-btrfs volume, got %v", err)
+	}
+	if _, err := os.Stat(calls); !os.IsNotExist(err) {
+		t.Errorf("expected no snapshot tool to run, got %q", readCalls(t, calls))
+	}
+}
+
+func TestLVMSnapshotTornDownOnFailure(t *testing.T) {
+	calls := fakeTools(t)
+	t.Setenv("FAKE_FAIL", "mount")
+
+	_, err := Create(context.Background(), Options{Type: "lvm", Volume: "vg0/srv", Mountpoint: "/srv"}, "srv")
+	if err == nil || !strings.Contains(err.Error(), "mount broke") {
+		t.Fatalf("expected the mount failure, got %v", err)
+	}
+	got := readCalls(t, calls)
+	if len(got) != 4 || !strings.HasPrefix(got[1], "lvcreate --snapshot --name srv-backup-") || !strings.HasSuffix(got[1], "--size 1G vg0/srv") ||
+		!strings.HasPrefix(got[3], "lvremove -f vg0/srv-backup-") {
+		t.Errorf("expected the snapshot to be removed after the failed mount, got %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Package state persists small JSON documents that must survive between runs.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Store keeps JSON state files in a directory.
+type Store struct {
+	dir string
+}
+
+// NewStore creates a state store rooted at dir, creating the directory if needed.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Path returns the location of a named state file.
+func (s *Store) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// Load decodes the named state file into v. A missing file leaves v untouched and is not an error.
+func (s *Store) Load(name string, v any) error {
+	data, err := os.ReadFile(s.Path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse state %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save atomically replaces the named state file with the JSON encoding of v.
+func (s *Store) Save(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state %s: %w", name, err)
+	}
+	path := s.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state %s: %w", name, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write state %s: %w", name, err)
+	}
+	return nil
+}
+
+// Remove deletes the named state file if it exists.
+func (s *Store) Remove(name string) error {
+	if err := os.Remove(s.Path(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove state %s: %w", name, err)
+	}
+	return nil
+}
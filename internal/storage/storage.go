@@ -0,0 +1,70 @@
+// Package storage defines the interface implemented by backup destinations.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a requested object does not exist in the backend.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored backup object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend is a destination where backup archives are stored.
+// Keys returned by List include the backend prefix and are accepted as-is by Get, Delete and Stat.
+type Backend interface {
+	// Put uploads a local file, storing it under the backend prefix with the file's base name.
+	Put(ctx context.Context, filePath string) error
+	// Get downloads the object stored under key to a local target path.
+	Get(ctx context.Context, key, targetPath string) error
+	// List returns the keys of all objects under the backend prefix.
+	List(ctx context.Context) ([]string, error)
+	// Delete removes the object stored under key.
+	Delete(ctx context.Context, key string) error
+	// Stat returns metadata of the object stored under key, or ErrNotFound.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+// RehydrationStatus describes whether an object is readable or sits in an archival tier.
+type RehydrationStatus struct {
+	StorageClass string
+	// Archived is true when the object is stored in a tier that must be restored before download.
+	Archived bool
+	// InProgress is true while a restore request is being processed.
+	InProgress bool
+	// Available is true when the object can be downloaded right away.
+	Available bool
+}
+
+// Rehydrator is implemented by backends with archival tiers such as S3 Glacier and Deep Archive.
+type Rehydrator interface {
+	// RehydrationStatus reports whether the object stored under key can be downloaded.
+	RehydrationStatus(ctx context.Context, key string) (*RehydrationStatus, error)
+	// Rehydrate requests a temporary readable copy of an archived object, kept for the given number of days.
+	// It returns the typical time the restore takes for the object's tier. Requesting an object
+	// whose restore is already in progress is not an error.
+	Rehydrate(ctx context.Context, key, tier string, days int) (time.Duration, error)
+}
+
+// PlainPutter is implemented by backends whose Put applies settings meant for archives, such as
+// S3 storage classes and Object Lock. Small control objects like the lock are written with
+// PutPlain instead, so that they stay readable right away and can be overwritten and deleted.
+type PlainPutter interface {
+	// PutPlain uploads a local file like Put, without the archive upload options.
+	PutPlain(ctx context.Context, filePath string) error
+}
+
+// GarbageCollector is implemented by backends where interrupted uploads leave data behind,
+// such as incomplete S3 multipart uploads that are billed until aborted.
+type GarbageCollector interface {
+	// AbortStaleUploads discards incomplete uploads started longer ago than olderThan
+	// and returns the keys they were meant for.
+	AbortStaleUploads(ctx context.Context, olderThan time.Duration) ([]string, error)
+}
@@ -0,0 +1,91 @@
+// Package storagetest provides a conformance test shared by storage.Backend implementations.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+// Run checks a backend created by newBackend, once with a prefix ending in a slash and once
+// without one. Each backend must start out empty.
+func Run(t *testing.T, newBackend func(t *testing.T, prefix string) storage.Backend) {
+	t.Helper()
+	for _, prefix := range []string{"server1/", "server1"} {
+		t.Run(prefix, func(t *testing.T) {
+			run(t, newBackend(t, prefix), prefix)
+		})
+	}
+}
+
+// run uploads, lists, stats, downloads and deletes an archive through b, which is configured
+// with the given prefix.
+func run(t *testing.T, b storage.Backend, prefix string) {
+	t.Helper()
+	ctx := context.Background()
+	content := []byte("archive content")
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app_20250101000000.full.tar.gz")
+	if err := os.WriteFile(src, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(ctx, src); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	keys, err := b.List(ctx)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	expected := path.Join(prefix, "app_20250101000000.full.tar.gz")
+	if len(keys) != 1 || keys[0] != expected {
+		t.Fatalf("expected [%s], got %v", expected, keys)
+	}
+
+	info, err := b.Stat(ctx, expected)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Size != int64(len(content)) {
+		t.Errorf("expected size %d, got %d", len(content), info.Size)
+	}
+
+	dst := filepath.Join(dir, "restored")
+	if err := b.Get(ctx, expected, dst); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	data, err := os.ReadFile(dst) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(content) {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	if err := b.Delete(ctx, expected); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := b.Stat(ctx, expected); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if keys, err := b.List(ctx); err != nil || len(keys) != 0 {
+		t.Errorf("expected empty listing after delete, got %v (err %v)", keys, err)
+	}
+	GetMissing(t, b, expected)
+}
+
+// GetMissing checks that getting a key that does not exist fails with storage.ErrNotFound, which
+// callers do not retry.
+func GetMissing(t *testing.T, b storage.Backend, key string) {
+	t.Helper()
+	dst := filepath.Join(t.TempDir(), "missing")
+	if err := b.Get(context.Background(), key, dst); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound getting a missing key, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package telegram
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/logging"
+)
+
+// Request is a command received by a Bot, e.g. "/list web_app" has the command "list" and the
+// arguments ["web_app"].
+type Request struct {
+	ChatID  string
+	Command string
+	Args    []string
+	bot     *Bot
+	ctx     context.Context
+}
+
+// Reply sends an HTML formatted message to the chat the request came from. Handlers of
+// long-running commands use it to acknowledge the request before returning their result.
+func (r *Request) Reply(text string) {
+	if err := r.bot.Client.SendTo(r.ctx, r.ChatID, text, ParseModeHTML); err != nil {
+		logging.FromContext(r.ctx).Warn("Failed to answer command", "command", r.Command, "chat", r.ChatID, "error", err)
+	}
+}
+
+// Handler answers a command. The returned text, if any, is sent to the chat as HTML.
+type Handler func(ctx context.Context, req *Request) string
+
+// Bot long-polls the Bot API for commands and answers those sent from allowed chats. Messages
+// from other chats are ignored.
+type Bot struct {
+	Client *Client
+	// AllowedChats lists the chat IDs the bot answers.
+	AllowedChats []string
+	// PollTimeout is how long each getUpdates call waits for updates.
+	PollTimeout time.Duration
+	// Handlers maps command names, without the slash, to their handlers.
+	Handlers map[string]Handler
+	// Unknown answers commands without a handler, e.g. with a list of the known ones.
+	Unknown Handler
+}
+
+// Run polls for commands until ctx is done. Each command is handled in its own goroutine, so
+// that a long backup does not hold up /status; Run waits for them before returning.
+func (b *Bot) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var offset int64
+	delay := time.Second
+	for {
+		updates, err := b.Client.GetUpdates(ctx, offset, b.PollTimeout)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn("Polling failed, retrying", "error", err, "delay", delay)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, time.Minute)
+			continue
+		}
+		delay = time.Second
+
+		for _, u := range updates {
+			offset = max(offset, u.UpdateID+1)
+			req, ok := b.request(ctx, u)
+			if !ok {
+				continue
+			}
+			wg.Go(func() { b.handle(ctx, req) })
+		}
+	}
+}
+
+// request extracts the command of an update from an allowed chat.
+func (b *Bot) request(ctx context.Context, u Update) (*Request, bool) {
+	if u.Message == nil || !strings.HasPrefix(u.Message.Text, "/") {
+		return nil, false
+	}
+	chatID := strconv.FormatInt(u.Message.Chat.ID, 10)
+	if !slices.Contains(b.AllowedChats, chatID) {
+		logging.FromContext(ctx).Warn("Ignoring message from unauthorized chat", "chat", chatID, "text", u.Message.Text)
+		return nil, false
+	}
+	fields := strings.Fields(u.Message.Text)
+	// Commands in groups may be addressed as /command@botname.
+	command, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	return &Request{ChatID: chatID, Command: command, Args: fields[1:], bot: b, ctx: ctx}, true
+}
+
+func (b *Bot) handle(ctx context.Context, req *Request) {
+	handler, ok := b.Handlers[req.Command]
+	if !ok {
+		handler = b.Unknown
+	}
+	if handler == nil {
+		return
+	}
+	logging.FromContext(ctx).Info("Telegram command", "command", req.Command, "args", strings.Join(req.Args, " "), "chat", req.ChatID)
+	if text := handler(ctx, req); text != "" {
+		req.Reply(text)
+	}
+}
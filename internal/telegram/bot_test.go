@@ -0,0 +1,64 @@
+package telegram_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/telegram"
+	"github.com/mikhail-angelov/backup-service/internal/telegram/telegramtest"
+)
+
+func TestBot(t *testing.T) {
+	srv := telegramtest.NewServer(t)
+	client := telegram.NewClient("T", "")
+	client.BaseURL = srv.URL
+	bot := &telegram.Bot{
+		Client:       client,
+		AllowedChats: []string{"42"},
+		PollTimeout:  time.Second,
+		Handlers: map[string]telegram.Handler{
+			"echo": func(_ context.Context, req *telegram.Request) string {
+				return strings.Join(req.Args, " ")
+			},
+			"slow": func(_ context.Context, req *telegram.Request) string {
+				req.Reply("working")
+				return "done"
+			},
+		},
+		Unknown: func(_ context.Context, req *telegram.Request) string { return "unknown /" + req.Command },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- bot.Run(ctx) }()
+
+	srv.Send(7, "/echo intruder")
+	srv.Send(42, "hello")
+	srv.Send(42, "/echo@backup_bot a  b")
+	sent := srv.Wait(t, 1, 5*time.Second)
+	if sent[0].ChatID != "42" || sent[0].Text != "a b" || sent[0].ParseMode != telegram.ParseModeHTML {
+		t.Errorf("unexpected reply %+v", sent[0])
+	}
+
+	srv.Send(42, "/slow")
+	sent = srv.Wait(t, 3, 5*time.Second)
+	if sent[1].Text != "working" || sent[2].Text != "done" {
+		t.Errorf("unexpected replies %+v", sent[1:])
+	}
+
+	srv.Send(42, "/nope")
+	sent = srv.Wait(t, 4, 5*time.Second)
+	if sent[3].Text != "unknown /nope" {
+		t.Errorf("unexpected reply %+v", sent[3])
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("bot stopped with %v", err)
+	}
+	if sent := srv.Wait(t, 0, 0); len(sent) != 4 {
+		t.Errorf("expected the unauthorized chat to be ignored, got %+v", sent)
+	}
+}
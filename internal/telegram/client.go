@@ -1,50 +1,266 @@
-// Package telegram provides a client for sending messages via the Telegram Bot API.
+// Package telegram provides a client for the Telegram Bot API and a bot answering commands.
 package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
+// DefaultBaseURL is the address of the Telegram Bot API.
+const DefaultBaseURL = "https://api.telegram.org"
+
 // Client is a wrapper for the Telegram Bot API.
 type Client struct {
-	token  string
-	chatID string
+	// BaseURL is the Bot API address, DefaultBaseURL unless pointed at a local Bot API server or a test double.
+	BaseURL string
+	token   string
+	chatID  string
 }
 
 // NewClient creates a new Telegram client.
 func NewClient(token, chatID string) *Client {
-	return &Client{token: token, chatID: chatID}
+	return &Client{BaseURL: DefaultBaseURL, token: token, chatID: chatID}
 }
 
+// MaxMessageLength is the longest text the Bot API accepts in one message.
+const MaxMessageLength = 4096
+
+// Parse modes of formatted messages.
+const (
+	ParseModeHTML       = "HTML"
+	ParseModeMarkdownV2 = "MarkdownV2"
+)
+
 // SendMessage sends a text message to the configured Telegram chat.
 func (c *Client) SendMessage(text string) error {
-	if c.token == "" || c.chatID == "" {
+	return c.Send(context.Background(), text, "")
+}
+
+// Send sends text formatted with parseMode (empty for plain text) to the configured chat. Texts longer
+// than MaxMessageLength are split at line breaks and sent as several messages.
+func (c *Client) Send(ctx context.Context, text, parseMode string) error {
+	if c.chatID == "" {
+		return nil
+	}
+	return c.SendTo(ctx, c.chatID, text, parseMode)
+}
+
+// SendTo is Send to the given chat instead of the configured one.
+func (c *Client) SendTo(ctx context.Context, chatID, text, parseMode string) error {
+	if c.token == "" {
 		return nil
 	}
+	for _, part := range SplitMessage(text, MaxMessageLength) {
+		if err := c.send(ctx, chatID, part, parseMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", c.token)
+func (c *Client) send(ctx context.Context, chatID, text, parseMode string) error {
 	payload := map[string]string{
-		"chat_id": c.chatID,
+		"chat_id": chatID,
 		"text":    text,
 	}
+	if parseMode != "" {
+		payload["parse_mode"] = parseMode
+	}
+	if err := c.call(ctx, "sendMessage", payload, nil); err != nil {
+		return fmt.Errorf("failed to send telegram message: %w", err)
+	}
+	return nil
+}
+
+// Update is an incoming update received with GetUpdates. Only messages are of interest.
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message,omitempty"`
+}
+
+// Message is a message received by the bot.
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	Chat      Chat   `json:"chat"`
+	From      *User  `json:"from,omitempty"`
+	Text      string `json:"text"`
+}
+
+// Chat is the chat a message was sent in.
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// User is the sender of a message.
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username,omitempty"`
+}
+
+// GetUpdates long-polls for updates with an ID of at least offset, waiting up to timeout for
+// one to arrive.
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	payload := map[string]any{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}
+	var updates []Update
+	if err := c.call(ctx, "getUpdates", payload, &updates); err != nil {
+		return nil, fmt.Errorf("failed to get telegram updates: %w", err)
+	}
+	return updates, nil
+}
 
+// redact drops the request URL, which holds the bot token, from errors of the HTTP client.
+func redact(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// call invokes a Bot API method and decodes its result into result, unless nil.
+func (c *Client) call(ctx context.Context, method string, payload, result any) error {
+	endpoint := fmt.Sprintf("%s/bot%s/%s", c.BaseURL, c.token, method)
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal telegram payload: %w", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body)) // #nosec G107
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
 	if err != nil {
-		return fmt.Errorf("failed to send telegram message: %w", err)
+		return fmt.Errorf("failed to create telegram %s request: %w", method, redact(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req) // #nosec G107
+	if err != nil {
+		return fmt.Errorf("telegram %s request failed: %w", method, redact(err))
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("telegram API returned status %d", resp.StatusCode)
 	}
+	if result == nil {
+		return nil
+	}
 
-	return nil
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode telegram response: %w", err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram API error: %s", envelope.Description)
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
+
+// SplitMessage splits text into parts of at most limit UTF-16 code units, which is how Telegram
+// counts message length. It prefers line breaks so that formatting, which never spans lines in
+// generated reports, stays intact. Lines longer than limit are cut; see cutLine.
+func SplitMessage(text string, limit int) []string {
+	var parts []string
+	var current strings.Builder
+	size := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		n := utf16Len(line)
+		if size+n > limit && size > 0 {
+			parts = append(parts, strings.TrimRight(current.String(), "\n"))
+			current.Reset()
+			size = 0
+		}
+		for n > limit {
+			cut := cutLine(line, limit)
+			parts = append(parts, line[:cut])
+			line = line[cut:]
+			n = utf16Len(line)
+		}
+		current.WriteString(line)
+		size += n
+	}
+	if size > 0 || len(parts) == 0 {
+		parts = append(parts, strings.TrimRight(current.String(), "\n"))
+	}
+	return parts
+}
+
+// cutLine returns where to cut line so that the head fits into limit UTF-16 code units. It backs
+// up to before an HTML tag or entity such as &amp; that would be torn apart, and preferably to
+// before an element such as <code>...</code>, so that each part is valid HTML on its own. An
+// element longer than limit is cut outside its tags.
+func cutLine(line string, limit int) int {
+	var (
+		units, end, safe, outside, depth, tagStart int
+		inTag, inEntity                            bool
+	)
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if inEntity && r != ';' && r != '#' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			inEntity = false // a literal &
+		}
+		if !inTag && !inEntity {
+			outside = i
+			if depth == 0 {
+				safe = i
+			}
+		}
+		if units += utf16.RuneLen(r); units > limit {
+			break
+		}
+		end = i + size
+		switch {
+		case inEntity:
+			inEntity = r != ';'
+		case inTag:
+			if r == '>' {
+				inTag = false
+				if tag := line[tagStart:end]; strings.HasPrefix(tag, "</") {
+					depth = max(depth-1, 0)
+				} else if !strings.HasSuffix(tag, "/>") {
+					depth++
+				}
+			}
+		case r == '<':
+			inTag, tagStart = true, i
+		case r == '&':
+			inEntity = true
+		}
+		i = end
+	}
+	switch {
+	case safe > 0:
+		return safe
+	case outside > 0:
+		return outside
+	case end > 0:
+		return end
+	}
+	_, size := utf8.DecodeRuneInString(line)
+	return size
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
 }
@@ -0,0 +1,95 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		text     string
+		limit    int
+		expected []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"", 10, []string{""}},
+		{"line one\nline two\nline three", 18, []string{"line one\nline two", "line three"}},
+		{"abcdefghij\nxy", 4, []string{"abcd", "efgh", "ij", "xy"}},
+		{"ёжик\nёжик", 5, []string{"ёжик", "ёжик"}},
+		{"😀😀😀", 4, []string{"😀😀", "😀"}},
+		{"x <code>abc</code> y", 16, []string{"x ", "<code>abc</code>", " y"}},
+		{"AT&T a&amp;b", 10, []string{"AT&T a", "&amp;b"}},
+	}
+	for _, tt := range tests {
+		got := SplitMessage(tt.text, tt.limit)
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("SplitMessage(%q, %d) = %q, expected %q", tt.text, tt.limit, got, tt.expected)
+		}
+	}
+}
+
+func TestSplitMessageEntities(t *testing.T) {
+	line := strings.Repeat("<b>a</b> &lt;b&gt; &amp; ", 300)
+	parts := SplitMessage(line, 100)
+	if strings.Join(parts, "") != line {
+		t.Fatal("expected the parts to add up to the line")
+	}
+	for _, part := range parts {
+		if n := len(utf16.Encode([]rune(part))); n > 100 {
+			t.Errorf("part of %d units exceeds the limit: %q", n, part)
+		}
+		if strings.Count(part, "&") != strings.Count(part, ";") ||
+			strings.Count(part, "<") != strings.Count(part, ">") ||
+			strings.Count(part, "<b>") != strings.Count(part, "</b>") {
+			t.Errorf("part cuts an entity, tag or element: %q", part)
+		}
+	}
+}
+
+func TestSendSplitsLongMessages(t *testing.T) {
+	var payloads []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var p map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		payloads = append(payloads, p)
+	}))
+	defer srv.Close()
+
+	c := NewClient("T", "1")
+	c.BaseURL = srv.URL
+	text := strings.Repeat(strings.Repeat("x", 99)+"\n", 60) // 6000 characters
+	if err := c.Send(context.Background(), text, ParseModeHTML); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(payloads))
+	}
+	for _, p := range payloads {
+		if len(p["text"]) > MaxMessageLength || p["parse_mode"] != "HTML" {
+			t.Errorf("unexpected message of %d characters with parse mode %q", len(p["text"]), p["parse_mode"])
+		}
+	}
+}
+
+func TestErrorsDoNotLeakToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // Every request fails to connect.
+
+	const token = "123456:SECRET-TOKEN"
+	c := NewClient(token, "1")
+	c.BaseURL = srv.URL
+	_, err := c.GetUpdates(context.Background(), 0, time.Second)
+	if err == nil || strings.Contains(err.Error(), "SECRET-TOKEN") {
+		t.Errorf("expected an error without the token, got %v", err)
+	}
+	err = c.Send(context.Background(), "hi", ParseModeHTML)
+	if err == nil || strings.Contains(err.Error(), "SECRET-TOKEN") {
+		t.Errorf("expected an error without the token, got %v", err)
+	}
+}
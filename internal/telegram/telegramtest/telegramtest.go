@@ -0,0 +1,118 @@
+// Package telegramtest provides a fake Telegram Bot API server for testing bots.
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikhail-angelov/backup-service/internal/telegram"
+)
+
+// Sent is a message a bot sent through the fake server.
+type Sent struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+}
+
+// Server answers getUpdates with the messages queued by Send and records sendMessage calls.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	nextID  int64
+	updates []telegram.Update
+	sent    []Sent
+}
+
+// NewServer starts a fake Bot API server, closed when the test ends. Point a client at it by
+// setting its BaseURL to the server's URL.
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+	s := &Server{nextID: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(func() {
+		s.CloseClientConnections()
+		s.Close()
+	})
+	return s
+}
+
+// Send queues a text message from chatID for the bot to receive.
+func (s *Server) Send(chatID int64, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, telegram.Update{
+		UpdateID: s.nextID,
+		Message:  &telegram.Message{MessageID: s.nextID, Chat: telegram.Chat{ID: chatID}, Text: text},
+	})
+	s.nextID++
+}
+
+// Wait returns the messages sent by the bot once there are at least n of them, or fails the
+// test after timeout.
+func (s *Server) Wait(t *testing.T, n int, timeout time.Duration) []Sent {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		sent := append([]Sent(nil), s.sent...)
+		s.mu.Unlock()
+		if len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d messages, got %d: %+v", n, len(sent), sent)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/getUpdates"):
+		var req struct {
+			Offset int64 `json:"offset"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeResult(w, s.pending(r, req.Offset))
+	case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+		var msg Sent
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		s.mu.Lock()
+		s.sent = append(s.sent, msg)
+		s.mu.Unlock()
+		writeResult(w, map[string]any{"message_id": 1})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// pending returns the queued updates from offset on, waiting briefly for one like long polling does.
+func (s *Server) pending(r *http.Request, offset int64) []telegram.Update {
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for {
+		s.mu.Lock()
+		var updates []telegram.Update
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				updates = append(updates, u)
+			}
+		}
+		s.mu.Unlock()
+		if len(updates) > 0 || time.Now().After(deadline) || r.Context().Err() != nil {
+			return updates
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
@@ -0,0 +1,70 @@
+// Package tracing exports OpenTelemetry spans of backup runs over OTLP/HTTP, so that slow stages of a
+// run can be spotted in a tracing backend such as Jaeger, Tempo or Honeycomb.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name identifies the spans of this service's tracer.
+const Name = "github.com/mikhail-angelov/backup-service"
+
+// Options configures the exporter installed by Setup.
+type Options struct {
+	// Endpoint is the OTLP/HTTP URL of a collector; spans are not recorded when it is empty.
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+}
+
+// Setup makes a tracer provider exporting to opts.Endpoint the global one. The returned function
+// flushes the spans still buffered and stops the exporter; it must be called before exiting.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(opts.Endpoint),
+		otlptracehttp.WithHeaders(opts.Headers),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", opts.ServiceName)}
+	if hostname, err := os.Hostname(); err == nil {
+		attrs = append(attrs, attribute.String("host.name", hostname))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the global tracer provider as a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(Name).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, as the outcome of span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,63 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/tracing"
+	"github.com/mikhail-angelov/backup-service/internal/tracing/tracingtest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestSetupExportsSpans(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	ctx := context.Background()
+	shutdown, err := tracing.Setup(ctx, tracing.Options{
+		Endpoint:    collector.URL,
+		Headers:     map[string]string{"authorization": "Bearer x"},
+		ServiceName: "backup-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, run := tracing.Start(ctx, "backup.run", attribute.String("run_id", "abc"))
+	_, set := tracing.Start(runCtx, "backup.set", attribute.String("set", "app"))
+	tracing.End(set, errors.New("upload failed"))
+	tracing.End(run, nil)
+	if err := shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := collector.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", spans)
+	}
+	runs, sets := collector.Named("backup.run"), collector.Named("backup.set")
+	if len(runs) != 1 || len(sets) != 1 {
+		t.Fatalf("expected a run and a set span, got %+v", spans)
+	}
+	if runs[0].ParentID != "" || sets[0].ParentID != runs[0].SpanID || sets[0].TraceID != runs[0].TraceID {
+		t.Errorf("expected the set span to be a child of the run span, got %+v", spans)
+	}
+	if runs[0].Attributes["run_id"] != "abc" || sets[0].Attributes["set"] != "app" {
+		t.Errorf("unexpected attributes %+v", spans)
+	}
+	if sets[0].Error != "upload failed" || runs[0].Error != "" {
+		t.Errorf("expected only the set span to fail, got %+v", spans)
+	}
+	if runs[0].Resource["service.name"] != "backup-test" {
+		t.Errorf("unexpected resource %v", runs[0].Resource)
+	}
+}
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package tracingtest provides an in-process OTLP/HTTP collector for testing exported spans.
+package tracingtest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Span is a span received by the collector.
+type Span struct {
+	Name     string
+	TraceID  string
+	SpanID   string
+	ParentID string // Empty for root spans
+	// Attributes holds the span attributes formatted as strings, e.g. "42" for an int.
+	Attributes map[string]string
+	// Error is the status message of spans that ended with an error.
+	Error string
+	// Resource holds the attributes of the resource that exported the span, such as service.name.
+	Resource map[string]string
+}
+
+// Collector accepts OTLP/HTTP trace exports in protobuf encoding and keeps the spans.
+type Collector struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewCollector starts a collector, closed when the test ends. Exporters reach it at its URL.
+func NewCollector(t *testing.T) *Collector {
+	t.Helper()
+	c := &Collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.handle))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// Spans returns the spans received so far, in the order they arrived.
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// Named returns the received spans with the given name.
+func (c *Collector) Named(name string) []Span {
+	var spans []Span
+	for _, s := range c.Spans() {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func (c *Collector) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, rs := range req.GetResourceSpans() {
+		resource := attributes(rs.GetResource().GetAttributes())
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				span := Span{
+					Name:       s.GetName(),
+					TraceID:    hex.EncodeToString(s.GetTraceId()),
+					SpanID:     hex.EncodeToString(s.GetSpanId()),
+					Attributes: attributes(s.GetAttributes()),
+					Error:      s.GetStatus().GetMessage(),
+					Resource:   resource,
+				}
+				if len(s.GetParentSpanId()) > 0 {
+					span.ParentID = hex.EncodeToString(s.GetParentSpanId())
+				}
+				c.spans = append(c.spans, span)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	out, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(out)
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		v := kv.GetValue()
+		switch v.GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			m[kv.GetKey()] = v.GetStringValue()
+		case *commonpb.AnyValue_IntValue:
+			m[kv.GetKey()] = fmt.Sprint(v.GetIntValue())
+		case *commonpb.AnyValue_BoolValue:
+			m[kv.GetKey()] = fmt.Sprint(v.GetBoolValue())
+		case *commonpb.AnyValue_DoubleValue:
+			m[kv.GetKey()] = fmt.Sprint(v.GetDoubleValue())
+		default:
+			m[kv.GetKey()] = v.String()
+		}
+	}
+	return m
+}
@@ -0,0 +1,310 @@
+// Package webdav stores backups on a WebDAV server such as Nextcloud or a NAS WebDAV share.
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikhail-angelov/backup-service/internal/ratelimit"
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+)
+
+var _ storage.Backend = (*Client)(nil)
+
+// Options configures the WebDAV connection.
+type Options struct {
+	// URL is the collection backups are stored in.
+	URL      string
+	Username string
+	Password string
+	Prefix   string
+	// UploadLimiter and DownloadLimiter, if set, throttle the data streams. They may be shared
+	// with other clients.
+	UploadLimiter   *ratelimit.Limiter
+	DownloadLimiter *ratelimit.Limiter
+}
+
+// Client is a minimal WebDAV client covering the operations needed for backups.
+type Client struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	username   string
+	password   string
+	prefix     string
+	// dir is the collection archives are stored in, which is the prefix itself when it ends
+	// in a slash and its parent otherwise.
+	dir       string
+	upLimit   *ratelimit.Limiter
+	downLimit *ratelimit.Limiter
+}
+
+// NewClient creates a new WebDAV client for the collection at opts.URL.
+func NewClient(opts Options) (*Client, error) {
+	if opts.URL == "" {
+		return nil, errors.New("webdav url is not configured")
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(opts.URL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav url: %w", err)
+	}
+	return &Client{
+		httpClient: &http.Client{},
+		baseURL:    baseURL,
+		username:   opts.Username,
+		password:   opts.Password,
+		prefix:     opts.Prefix,
+		dir:        path.Dir(path.Join(opts.Prefix, "x")),
+		upLimit:    opts.UploadLimiter,
+		downLimit:  opts.DownloadLimiter,
+	}, nil
+}
+
+// Put uploads a local file to the WebDAV server.
+func (c *Client) Put(ctx context.Context, filePath string) error {
+	file, err := os.Open(filePath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	key := path.Join(c.prefix, filepath.Base(filePath))
+	if err := c.mkdirAll(ctx, path.Dir(key)); err != nil {
+		return err
+	}
+
+	// Upload to a temporary name first so that an interrupted transfer never looks like a complete backup.
+	tmpKey := key + ".partial"
+	req, err := c.newRequest(ctx, http.MethodPut, tmpKey, c.upLimit.Reader(ctx, file))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	resp, err := c.do(req, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("failed to upload to webdav: %w", err)
+	}
+	_ = resp.Body.Close()
+
+	if err := c.move(ctx, tmpKey, key); err != nil {
+		_ = c.Delete(context.WithoutCancel(ctx), tmpKey)
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	return nil
+}
+
+// Get downloads a file from the WebDAV server to a local target path.
+func (c *Client) Get(ctx context.Context, key, targetPath string) error {
+	req, err := c.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("failed to download from webdav: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	file, err := os.Create(targetPath) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := io.Copy(file, c.downLimit.Reader(ctx, resp.Body)); err != nil {
+		return fmt.Errorf("failed to download from webdav: %w", err)
+	}
+	return nil
+}
+
+// List returns the keys of all files in the prefix collection.
+func (c *Client) List(ctx context.Context) ([]string, error) {
+	entries, err := c.propfind(ctx, c.dir+"/", "1")
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webdav collection: %w", err)
+	}
+
+	var keys []string
+	for _, e := range entries {
+		if e.dir || strings.HasSuffix(e.Key, ".partial") || !strings.HasPrefix(e.Key, c.prefix) {
+			continue
+		}
+		keys = append(keys, e.Key)
+	}
+	return keys, nil
+}
+
+// Delete removes a file from the WebDAV server.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("failed to delete webdav file: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Stat returns the size and modification time of a file on the WebDAV server.
+func (c *Client) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	entries, err := c.propfind(ctx, key, "0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat webdav file: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: %w", key, storage.ErrNotFound)
+	}
+	info := entries[0].ObjectInfo
+	info.Key = key
+	return &info, nil
+}
+
+type entry struct {
+	storage.ObjectInfo
+	dir bool
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+		Prop struct {
+			ContentLength int64  `xml:"getcontentlength"`
+			LastModified  string `xml:"getlastmodified"`
+			ResourceType  struct {
+				Collection *struct{} `xml:"collection"`
+			} `xml:"resourcetype"`
+		} `xml:"propstat>prop"`
+	} `xml:"response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:getcontentlength/><d:getlastmodified/><d:resourcetype/></d:prop></d:propfind>`
+
+func (c *Client) propfind(ctx context.Context, key, depth string) ([]entry, error) {
+	req, err := c.newRequest(ctx, "PROPFIND", key, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml")
+	resp, err := c.do(req, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse PROPFIND response: %w", err)
+	}
+
+	entries := make([]entry, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		key := strings.TrimPrefix(href.Path, c.baseURL.Path)
+		e := entry{
+			ObjectInfo: storage.ObjectInfo{Key: key, Size: r.Prop.ContentLength},
+			dir:        r.Prop.ResourceType.Collection != nil,
+		}
+		if t, err := http.ParseTime(r.Prop.LastModified); err == nil {
+			e.ModTime = t
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (c *Client) move(ctx context.Context, src, dst string) error {
+	req, err := c.newRequest(ctx, "MOVE", src, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Destination", c.url(dst))
+	req.Header.Set("Overwrite", "T")
+	resp, err := c.do(req, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func (c *Client) mkdirAll(ctx context.Context, dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+	current := ""
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		current = path.Join(current, part)
+		req, err := c.newRequest(ctx, "MKCOL", current+"/", nil)
+		if err != nil {
+			return err
+		}
+		// 405 means the collection already exists.
+		resp, err := c.do(req, http.StatusCreated, http.StatusMethodNotAllowed)
+		if err != nil {
+			return fmt.Errorf("failed to create webdav collection %s: %w", current, err)
+		}
+		_ = resp.Body.Close()
+	}
+	return nil
+}
+
+// url resolves a key against the collection URL, keeping a trailing slash that marks a collection.
+func (c *Client) url(key string) string {
+	ref := &url.URL{Path: strings.TrimPrefix(path.Clean("/"+key), "/")}
+	if strings.HasSuffix(key, "/") && ref.Path != "" {
+		ref.Path += "/"
+	}
+	return c.baseURL.ResolveReference(ref).String()
+}
+
+func (c *Client) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(key), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webdav request: %w", err)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request, expected ...int) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webdav request failed: %w", err)
+	}
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", req.URL.Path, storage.ErrNotFound)
+	}
+	return nil, fmt.Errorf("webdav %s %s returned status %d", req.Method, req.URL.Path, resp.StatusCode)
+}
@@ -0,0 +1,79 @@
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mikhail-angelov/backup-service/internal/storage"
+	"github.com/mikhail-angelov/backup-service/internal/storage/storagetest"
+	"golang.org/x/net/webdav"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(&webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	})
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBackend(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, prefix string) storage.Backend {
+		srv := newTestServer(t)
+		client, err := NewClient(Options{URL: srv.URL + "/dav", Prefix: prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	})
+}
+
+func TestListMissingCollection(t *testing.T) {
+	srv := newTestServer(t)
+	client, err := NewClient(Options{URL: srv.URL + "/dav", Prefix: "missing/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := client.List(context.Background())
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected no keys, got %v", keys)
+	}
+}
+
+func TestListSkipsPartialUpload(t *testing.T) {
+	srv := newTestServer(t)
+	client, err := NewClient(Options{URL: srv.URL + "/dav", Prefix: "server1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.mkdirAll(ctx, "server1"); err != nil {
+		t.Fatal(err)
+	}
+	req, err := client.newRequest(ctx, http.MethodPut, "server1/app_20250101000000.full.tar.gz.partial", strings.NewReader("trunc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.do(req, http.StatusCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	keys, err := client.List(ctx)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected the partial upload to be skipped, got %v", keys)
+	}
+}